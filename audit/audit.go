@@ -0,0 +1,169 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/auth"
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/database"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+const (
+	ActionCreateSecret = "create_secret"
+	ActionViewSecret   = "view_secret"
+	ActionExpireSecret = "expire_secret"
+	ActionDeleteSecret = "delete_secret"
+	ActionPurgeExpired = "purge_expired"
+	ActionRevokeApiKey = "revoke_api_key"
+
+	OutcomeSuccess   = "success"
+	OutcomeExhausted = "views_exhausted"
+	OutcomeTtl       = "ttl_elapsed"
+
+	anonymousActor = "anonymous"
+)
+
+const (
+	SinkDb     = "db"
+	SinkFile   = "file"
+	SinkSyslog = "syslog"
+)
+
+var auditCounter *prometheus.CounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "password_sharing_audit_events",
+	Help: "The total number of audit events written by sink and result",
+}, []string{"sink", "result"})
+
+// Event is recorded for every action worth auditing. Secrets are referred to
+// by their link hash, contents never reach the audit log.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Actor    string    `json:"actor"`
+	TenantId string    `json:"tenant,omitempty"`
+	Action   string    `json:"action"`
+	Target   string    `json:"target,omitempty"`
+	Outcome  string    `json:"outcome"`
+}
+
+type Recorder interface {
+	Record(context.Context, Event) error
+	// Close releases the sinks, events recorded afterwards may be lost.
+	Close() error
+}
+
+// Sink stores the audit log. Every sink keeps its own chain, so each of them
+// can be verified on its own.
+type Sink interface {
+	Name() string
+	// Append links event to the last entry of the sink and writes it.
+	Append(context.Context, Event) (Entry, error)
+	Close() error
+}
+
+type sinkRecorder struct {
+	sinks         []Sink
+	loggerFactory logger.LoggerFactory
+}
+
+// NewRecorder builds the sinks configured under audit.sinks, the database
+// is used when none are configured.
+func NewRecorder(conf *config.Config, dbFactory database.DbFactory, loggerFactory logger.LoggerFactory) (Recorder, error) {
+	names := conf.Audit.Sinks
+	if len(names) == 0 {
+		names = []string{SinkDb}
+	}
+
+	sinks := make([]Sink, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case SinkDb:
+			sinks = append(sinks, NewDbSink(dbFactory))
+		case SinkFile:
+			if conf.Audit.File == "" {
+				return nil, fmt.Errorf("audit.file is required for the file sink")
+			}
+
+			sinks = append(sinks, NewFileSink(conf.Audit.File))
+		case SinkSyslog:
+			syslog := conf.Audit.Syslog
+			sinks = append(sinks, NewSyslogSink(syslog.Network, syslog.Address, syslog.Tag))
+		default:
+			return nil, fmt.Errorf("unknown audit sink %s", name)
+		}
+	}
+
+	return NewSinkRecorder(loggerFactory, sinks...), nil
+}
+
+func NewSinkRecorder(loggerFactory logger.LoggerFactory, sinks ...Sink) Recorder {
+	return &sinkRecorder{
+		sinks:         sinks,
+		loggerFactory: loggerFactory,
+	}
+}
+
+// Record writes event to every sink. A failing sink does not keep the event
+// from the others, the first error is returned.
+func (r *sinkRecorder) Record(c context.Context, event Event) error {
+	appLogger, loggerClose, err := r.loggerFactory.NewLogger()
+	if err != nil {
+		return err
+	}
+	defer loggerClose()
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	// databases keep microseconds, hashes have to survive the round trip
+	event.Time = event.Time.UTC().Truncate(time.Microsecond)
+	if event.Actor == "" {
+		event.Actor = ActorOf(c)
+	}
+
+	var result error
+	for _, sink := range r.sinks {
+		if _, err := sink.Append(c, event); err != nil {
+			auditCounter.WithLabelValues(sink.Name(), "error").Inc()
+			appLogger.Error("failed to record audit event",
+				zap.Error(err),
+				zap.String("sink", sink.Name()),
+				zap.String("action", event.Action),
+			)
+
+			if result == nil {
+				result = err
+			}
+			continue
+		}
+
+		auditCounter.WithLabelValues(sink.Name(), "ok").Inc()
+	}
+
+	return result
+}
+
+func (r *sinkRecorder) Close() error {
+	var result error
+	for _, sink := range r.sinks {
+		if err := sink.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+
+	return result
+}
+
+// ActorOf returns the subject of the caller of a request.
+func ActorOf(c context.Context) string {
+	if principal := auth.PrincipalFrom(c); principal != nil {
+		return principal.Subject
+	}
+
+	return anonymousActor
+}
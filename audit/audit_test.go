@@ -0,0 +1,162 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/auth"
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/database"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/tests"
+)
+
+func newTestDb(t *testing.T) database.DbFactory {
+	c := &config.Config{}
+	c.Database.Provider = "sqlite"
+	c.Database.ConnectionString = filepath.Join(t.TempDir(), "audit.db")
+
+	dbf := database.NewFactory(c, logger.NewTestLoggerFactory())
+	if err := tests.MigrateDatabase(context.Background(), dbf); err != nil {
+		t.Fatal(err)
+	}
+
+	return dbf
+}
+
+func recordEvents(t *testing.T, r Recorder, count int) {
+	ctxt := auth.WithPrincipal(context.Background(), &auth.Principal{Subject: "user-1"})
+	for i := 0; i < count; i++ {
+		err := r.Record(ctxt, Event{
+			TenantId: "finance",
+			Action:   ActionCreateSecret,
+			Target:   strings.Repeat("a", i+1),
+			Outcome:  OutcomeSuccess,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDbSinkShouldDetectTampering(t *testing.T) {
+	dbf := newTestDb(t)
+	ctxt := context.Background()
+
+	db, dbClose, err := dbf.InitDB(ctxt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbClose()
+
+	// events recorded before chaining are not part of the chain
+	if err = db.Create(&model.AuditEvent{Time: time.Now(), Action: ActionDeleteSecret}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	recordEvents(t, NewSinkRecorder(logger.NewTestLoggerFactory(), NewDbSink(dbf)), 3)
+
+	v, err := VerifyDb(ctxt, dbf)
+	if err != nil || v.Count() != 3 || v.Tip().Seq != 3 || v.Tip().Actor != "user-1" {
+		t.Fatalf("expected a valid chain of 3 entries but was %v", err)
+	}
+
+	if err = db.Model(&model.AuditEvent{}).Where("seq = ?", 2).Update("actor", "someone else").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = VerifyDb(ctxt, dbf); err == nil || !strings.Contains(err.Error(), "entry 2 was modified") {
+		t.Errorf("expected modification to be detected but was %v", err)
+	}
+
+	if err = db.Where("seq = ?", 2).Delete(&model.AuditEvent{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = VerifyDb(ctxt, dbf); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expected deletion to be detected but was %v", err)
+	}
+}
+
+func TestFileSinkShouldContinueChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	loggerFactory := logger.NewTestLoggerFactory()
+
+	recordEvents(t, NewSinkRecorder(loggerFactory, NewFileSink(path)), 2)
+	// a restarted process continues the chain of the file
+	recordEvents(t, NewSinkRecorder(loggerFactory, NewFileSink(path)), 2)
+
+	v, err := VerifyFile(path)
+	if err != nil || v.Count() != 4 {
+		t.Fatalf("expected a valid chain of 4 entries but was %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	tampered := strings.Replace(lines[0], `"outcome":"success"`, `"outcome":"failure"`, 1)
+	if tampered == lines[0] {
+		t.Fatalf("unexpected entry %s", lines[0])
+	}
+
+	lines[0] = tampered
+	if err = os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = VerifyFile(path); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("expected modification to be detected but was %v", err)
+	}
+
+	// a broken chain is not extended
+	if err = NewSinkRecorder(loggerFactory, NewFileSink(path)).Record(context.Background(), Event{Action: ActionViewSecret}); err == nil {
+		t.Errorf("expected appending to a broken chain to fail")
+	}
+}
+
+func TestSyslogSinkShouldSendChainedEntries(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	recordEvents(t, NewSinkRecorder(logger.NewTestLoggerFactory(), NewSyslogSink("udp", conn.LocalAddr().String(), "")), 2)
+
+	v := &Verifier{}
+	buffer := make([]byte, 4096)
+	for i := 0; i < 2; i++ {
+		if err = conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		message := string(buffer[:n])
+		if !strings.Contains(message, defaultSyslogTag) {
+			t.Errorf("expected message to be tagged but was %s", message)
+		}
+
+		var entry Entry
+		if err = json.Unmarshal([]byte(message[strings.Index(message, "{"):]), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = v.Add(entry); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Entry is an event linked into the chain of a sink. Hash covers the event,
+// its sequence number and the hash of the previous entry, so editing or
+// removing an entry breaks every later link.
+type Entry struct {
+	Seq int64 `json:"seq"`
+	Event
+	PrevHash string `json:"prevHash"`
+	Hash     string `json:"hash"`
+}
+
+// link chains event to prev, prev is nil for the first entry of a sink.
+func link(prev *Entry, event Event) Entry {
+	entry := Entry{
+		Seq:   1,
+		Event: event,
+	}
+
+	if prev != nil {
+		entry.Seq = prev.Seq + 1
+		entry.PrevHash = prev.Hash
+	}
+
+	entry.Hash = entry.digest()
+	return entry
+}
+
+func (e *Entry) digest() string {
+	// a JSON array keeps field boundaries unambiguous
+	data, _ := json.Marshal([]interface{}{
+		e.Seq,
+		e.PrevHash,
+		e.Time.UTC().Format(time.RFC3339Nano),
+		e.Actor,
+		e.TenantId,
+		e.Action,
+		e.Target,
+		e.Outcome,
+	})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verifier checks a chain entry by entry in sequence order. Removing entries
+// from the end cannot be detected from the chain itself, compare the tip
+// with a copy kept elsewhere, e.g. in syslog.
+type Verifier struct {
+	tip   *Entry
+	count int64
+}
+
+func (v *Verifier) Add(e Entry) error {
+	if e.Hash != e.digest() {
+		return fmt.Errorf("entry %d was modified", e.Seq)
+	}
+
+	if v.tip == nil {
+		if e.Seq != 1 || e.PrevHash != "" {
+			return fmt.Errorf("chain starts at entry %d, earlier entries were removed", e.Seq)
+		}
+	} else {
+		if e.Seq <= v.tip.Seq {
+			return fmt.Errorf("entry %d is out of order", e.Seq)
+		}
+
+		if e.Seq != v.tip.Seq+1 {
+			return fmt.Errorf("entries %d to %d are missing", v.tip.Seq+1, e.Seq-1)
+		}
+
+		if e.PrevHash != v.tip.Hash {
+			return fmt.Errorf("entry %d does not follow entry %d", e.Seq, v.tip.Seq)
+		}
+	}
+
+	v.tip = &e
+	v.count++
+	return nil
+}
+
+func (v *Verifier) Count() int64 {
+	return v.count
+}
+
+// Tip is the last verified entry, nil for an empty chain.
+func (v *Verifier) Tip() *Entry {
+	return v.tip
+}
@@ -0,0 +1,145 @@
+package audit
+
+import (
+	"context"
+	"sync"
+
+	"github.com/misikdmitriy/password-sharing/database"
+	"github.com/misikdmitriy/password-sharing/model"
+	"gorm.io/gorm"
+)
+
+const (
+	maxAppendAttempts = 5
+	verifyBatchSize   = 500
+)
+
+type dbSink struct {
+	dbFactory database.DbFactory
+
+	// serializes appends of this process, appends of other instances are
+	// serialized by the unique sequence number
+	mu sync.Mutex
+}
+
+func NewDbSink(dbFactory database.DbFactory) Sink {
+	return &dbSink{
+		dbFactory: dbFactory,
+	}
+}
+
+func (s *dbSink) Name() string {
+	return SinkDb
+}
+
+func (s *dbSink) Append(c context.Context, event Event) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db, dbClose, err := s.dbFactory.InitDB(c)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer dbClose()
+
+	var entry Entry
+	for attempt := 0; attempt < maxAppendAttempts; attempt++ {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			last := &model.AuditEvent{}
+			query := tx.Where("seq IS NOT NULL").Order("seq DESC").Limit(1).Find(last)
+			if query.Error != nil {
+				return query.Error
+			}
+
+			var prev *Entry
+			if query.RowsAffected > 0 {
+				e := entryOf(last)
+				prev = &e
+			}
+
+			entry = link(prev, event)
+			return tx.Create(rowOf(entry)).Error
+		})
+
+		// another instance appended the same sequence number first
+		if err == nil || !database.IsUniqueViolation(err) {
+			break
+		}
+	}
+
+	return entry, err
+}
+
+// Close does nothing, connections are opened per append.
+func (s *dbSink) Close() error {
+	return nil
+}
+
+// VerifyDb checks the chain of the db sink. Events recorded before the log
+// was chained are skipped.
+func VerifyDb(c context.Context, dbFactory database.DbFactory) (*Verifier, error) {
+	db, dbClose, err := dbFactory.InitDB(c)
+	if err != nil {
+		return nil, err
+	}
+	defer dbClose()
+
+	v := &Verifier{}
+	rows := []model.AuditEvent{}
+	var after int64
+	for {
+		err := db.Where("seq > ?", after).Order("seq").Limit(verifyBatchSize).Find(&rows).Error
+		if err != nil {
+			return v, err
+		}
+
+		for i := range rows {
+			if err := v.Add(entryOf(&rows[i])); err != nil {
+				return v, err
+			}
+		}
+
+		if len(rows) < verifyBatchSize {
+			return v, nil
+		}
+
+		after = *rows[len(rows)-1].Seq
+	}
+}
+
+func entryOf(row *model.AuditEvent) Entry {
+	entry := Entry{
+		Event: Event{
+			Time:     row.Time,
+			Actor:    row.Actor,
+			TenantId: row.TenantId,
+			Action:   row.Action,
+			Target:   row.Target,
+			Outcome:  row.Outcome,
+		},
+		PrevHash: row.PrevHash,
+		Hash:     row.Hash,
+	}
+
+	if row.Seq != nil {
+		entry.Seq = *row.Seq
+	}
+
+	return entry
+}
+
+func rowOf(entry Entry) *model.AuditEvent {
+	seq := entry.Seq
+
+	return &model.AuditEvent{
+		Seq:      &seq,
+		Time:     entry.Time,
+		Actor:    entry.Actor,
+		TenantId: entry.TenantId,
+		Action:   entry.Action,
+		Target:   entry.Target,
+		Outcome:  entry.Outcome,
+		PrevHash: entry.PrevHash,
+		Hash:     entry.Hash,
+	}
+}
@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const maxLineSize = 1 << 20
+
+// fileSink appends entries as JSON lines. The file must be written by a
+// single process, every instance needs a file of its own.
+type fileSink struct {
+	path string
+
+	mu  sync.Mutex
+	tip *Entry
+	// loaded is set once the tip was read from an existing file
+	loaded bool
+}
+
+func NewFileSink(path string) Sink {
+	return &fileSink{
+		path: path,
+	}
+}
+
+func (s *fileSink) Name() string {
+	return SinkFile
+}
+
+func (s *fileSink) Append(_ context.Context, event Event) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded {
+		v, err := VerifyFile(s.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return Entry{}, fmt.Errorf("cannot continue audit file %s: %w", s.path, err)
+		}
+
+		s.tip = v.Tip()
+		s.loaded = true
+	}
+
+	entry := link(s.tip, event)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer file.Close()
+
+	if _, err = file.Write(append(data, '\n')); err != nil {
+		return Entry{}, err
+	}
+
+	if err = file.Sync(); err != nil {
+		return Entry{}, err
+	}
+
+	s.tip = &entry
+	return entry, nil
+}
+
+// Close does nothing, the file is only open while an entry is written.
+func (s *fileSink) Close() error {
+	return nil
+}
+
+// VerifyFile checks the chain of a JSONL audit file.
+func VerifyFile(path string) (*Verifier, error) {
+	v := &Verifier{}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return v, err
+	}
+	defer file.Close()
+
+	return v, verifyLines(v, file)
+}
+
+func verifyLines(v *Verifier, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxLineSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if err := v.Add(entry); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+
+	return scanner.Err()
+}
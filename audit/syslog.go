@@ -0,0 +1,86 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log/syslog"
+	"sync"
+)
+
+const defaultSyslogTag = "password-sharing"
+
+// syslogSink forwards entries to syslog as JSON. Syslog cannot be read back,
+// so the chain starts over with every process and is verified downstream.
+type syslogSink struct {
+	network string
+	address string
+	tag     string
+
+	mu     sync.Mutex
+	writer *syslog.Writer
+	tip    *Entry
+}
+
+// NewSyslogSink writes to the local syslog daemon when network and address
+// are empty.
+func NewSyslogSink(network string, address string, tag string) Sink {
+	if tag == "" {
+		tag = defaultSyslogTag
+	}
+
+	return &syslogSink{
+		network: network,
+		address: address,
+		tag:     tag,
+	}
+}
+
+func (s *syslogSink) Name() string {
+	return SinkSyslog
+}
+
+func (s *syslogSink) Append(_ context.Context, event Event) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writer == nil {
+		writer, err := syslog.Dial(s.network, s.address, syslog.LOG_INFO|syslog.LOG_AUTH, s.tag)
+		if err != nil {
+			return Entry{}, err
+		}
+
+		s.writer = writer
+	}
+
+	entry := link(s.tip, event)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	if err = s.writer.Info(string(data)); err != nil {
+		// dial again on the next event
+		s.writer.Close()
+		s.writer = nil
+
+		return Entry{}, err
+	}
+
+	s.tip = &entry
+	return entry, nil
+}
+
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writer == nil {
+		return nil
+	}
+
+	err := s.writer.Close()
+	s.writer = nil
+	return err
+}
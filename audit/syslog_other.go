@@ -0,0 +1,26 @@
+//go:build windows || plan9
+
+package audit
+
+import (
+	"context"
+	"errors"
+)
+
+type syslogSink struct{}
+
+func NewSyslogSink(string, string, string) Sink {
+	return &syslogSink{}
+}
+
+func (s *syslogSink) Name() string {
+	return SinkSyslog
+}
+
+func (s *syslogSink) Append(context.Context, Event) (Entry, error) {
+	return Entry{}, errors.New("syslog is not supported on this platform")
+}
+
+func (s *syslogSink) Close() error {
+	return nil
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"strings"
+)
+
+type Scope string
+
+const (
+	ScopeCreate Scope = "create"
+	ScopeStatus Scope = "status"
+	// ScopeAdminRead lets operators inspect the service, ScopeAdmin also
+	// lets them change it and implies ScopeAdminRead.
+	ScopeAdminRead Scope = "admin:read"
+	ScopeAdmin     Scope = "admin"
+)
+
+func Scopes() []Scope {
+	return []Scope{ScopeCreate, ScopeStatus, ScopeAdminRead, ScopeAdmin}
+}
+
+// implied lists the scopes granted along with a scope.
+var implied = map[Scope][]Scope{
+	ScopeAdmin: {ScopeAdminRead},
+}
+
+func ParseScopes(value string) ([]Scope, bool) {
+	result := make([]Scope, 0)
+	for _, s := range strings.Split(value, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		scope := Scope(s)
+		if !scope.Valid() {
+			return nil, false
+		}
+
+		result = append(result, scope)
+	}
+
+	return result, true
+}
+
+func JoinScopes(scopes []Scope) string {
+	values := make([]string, len(scopes))
+	for i, s := range scopes {
+		values[i] = string(s)
+	}
+
+	return strings.Join(values, ",")
+}
+
+func (s Scope) Valid() bool {
+	for _, known := range Scopes() {
+		if s == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Requirement is declared by every controller. A requirement without scopes
+// lets anonymous callers through.
+type Requirement struct {
+	Scopes []Scope
+}
+
+var Anonymous = Requirement{}
+
+func Require(scopes ...Scope) Requirement {
+	return Requirement{
+		Scopes: scopes,
+	}
+}
+
+func (r Requirement) IsAnonymous() bool {
+	return len(r.Scopes) == 0
+}
+
+type Method string
+
+const (
+	MethodApiKey Method = "apikey"
+)
+
+// Principal is the authenticated caller. Email and Groups are only known for
+// callers signed in with a JWT. Tenant is empty when the credential is not
+// bound to a tenant.
+type Principal struct {
+	Subject string
+	Method  Method
+	KeyId   string
+	Tenant  string
+	Email   string
+	Groups  []string
+	Scopes  []Scope
+}
+
+func (p *Principal) InAnyGroup(groups []string) bool {
+	for _, g := range groups {
+		for _, own := range p.Groups {
+			if g == own {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (p *Principal) HasScope(scope Scope) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+
+		for _, i := range implied[s] {
+			if i == scope {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Satisfies reports whether the principal has every scope of the requirement.
+func (p *Principal) Satisfies(r Requirement) bool {
+	for _, s := range r.Scopes {
+		if !p.HasScope(s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type Authenticator interface {
+	Authenticate(context.Context, string) (*Principal, error)
+}
+
+type compositeAuthenticator struct {
+	apiKeys Authenticator
+	jwt     Authenticator
+}
+
+// NewCompositeAuthenticator sends JWTs to jwt and everything else to apiKeys.
+// jwt may be nil when JWT authentication is disabled.
+func NewCompositeAuthenticator(apiKeys Authenticator, jwt Authenticator) Authenticator {
+	return &compositeAuthenticator{
+		apiKeys: apiKeys,
+		jwt:     jwt,
+	}
+}
+
+func (a *compositeAuthenticator) Authenticate(c context.Context, credential string) (*Principal, error) {
+	if a.jwt != nil && strings.Count(credential, ".") == 2 {
+		return a.jwt.Authenticate(c, credential)
+	}
+
+	return a.apiKeys.Authenticate(c, credential)
+}
+
+type principalKey struct{}
+
+func WithPrincipal(c context.Context, p *Principal) context.Context {
+	return context.WithValue(c, principalKey{}, p)
+}
+
+// PrincipalFrom returns the caller or nil for anonymous requests.
+func PrincipalFrom(c context.Context) *Principal {
+	p, _ := c.Value(principalKey{}).(*Principal)
+	return p
+}
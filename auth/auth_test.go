@@ -0,0 +1,19 @@
+package auth
+
+import "testing"
+
+func TestAdminScopeShouldImplyAdminRead(t *testing.T) {
+	admin := &Principal{Scopes: []Scope{ScopeAdmin}}
+	if !admin.Satisfies(Require(ScopeAdminRead)) {
+		t.Errorf("expected admin to satisfy %s", ScopeAdminRead)
+	}
+
+	reader := &Principal{Scopes: []Scope{ScopeAdminRead}}
+	if reader.Satisfies(Require(ScopeAdmin)) {
+		t.Errorf("expected %s not to satisfy %s", ScopeAdminRead, ScopeAdmin)
+	}
+
+	if scopes, ok := ParseScopes("create, admin:read"); !ok || len(scopes) != 2 || scopes[1] != ScopeAdminRead {
+		t.Errorf("unexpected parsed scopes %v", scopes)
+	}
+}
@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// KeySource resolves the public key a token was signed with.
+type KeySource interface {
+	Key(context.Context, string) (crypto.PublicKey, error)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// ParseJwks returns the signing keys of a JWK set indexed by key id.
+func ParseJwks(data []byte) (map[string]crypto.PublicKey, error) {
+	set := &jwkSet{}
+	if err := json.Unmarshal(data, set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", k.Kid, err)
+		}
+
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
+
+type staticKeySource struct {
+	keys map[string]crypto.PublicKey
+}
+
+// NewFileKeySource loads a JWK set once from disk, meant for offline setups
+// and tests.
+func NewFileKeySource(path string) (KeySource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := ParseJwks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &staticKeySource{
+		keys: keys,
+	}, nil
+}
+
+func (s *staticKeySource) Key(_ context.Context, kid string) (crypto.PublicKey, error) {
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, ErrUnknownKey
+}
+
+// remoteKeySource caches the JWK set fetched from url. The set is refetched
+// when it is older than refresh, or earlier when a token refers to an
+// unknown key id, which happens after the issuer rotates keys. One fetch
+// runs at a time and outside of the lock, known keys are served from the
+// cache meanwhile.
+type remoteKeySource struct {
+	url        string
+	refresh    time.Duration
+	minRefetch time.Duration
+	client     *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	// fetching is closed when the running fetch is done, nil while none runs
+	fetching chan struct{}
+	fetchErr error
+}
+
+const (
+	defaultJwksRefresh = time.Hour
+	jwksMinRefetch     = 30 * time.Second
+	jwksFetchTimeout   = 10 * time.Second
+	maxJwksSize        = 1 << 20
+)
+
+func NewRemoteKeySource(url string, refresh time.Duration) KeySource {
+	if refresh <= 0 {
+		refresh = defaultJwksRefresh
+	}
+
+	return &remoteKeySource{
+		url:        url,
+		refresh:    refresh,
+		minRefetch: jwksMinRefetch,
+		client: &http.Client{
+			Timeout: jwksFetchTimeout,
+		},
+	}
+}
+
+func (s *remoteKeySource) Key(c context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+
+	age := time.Since(s.fetchedAt)
+	key, known := s.keys[kid]
+
+	if !known && (s.keys == nil || age > s.minRefetch) {
+		done := s.startFetch()
+		s.mu.Unlock()
+
+		select {
+		case <-done:
+		case <-c.Done():
+			return nil, c.Err()
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if key, known = s.keys[kid]; known {
+			return key, nil
+		}
+		if s.fetchErr != nil {
+			return nil, s.fetchErr
+		}
+
+		return nil, ErrUnknownKey
+	}
+
+	// a stale set is still better than refusing every token, it is served
+	// until the refresh is done
+	if age > s.refresh {
+		s.startFetch()
+	}
+	s.mu.Unlock()
+
+	if !known {
+		return nil, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+// startFetch starts a fetch unless one runs and returns the channel closed
+// when it is done. s.mu must be held.
+func (s *remoteKeySource) startFetch() <-chan struct{} {
+	if s.fetching != nil {
+		return s.fetching
+	}
+
+	done := make(chan struct{})
+	s.fetching = done
+
+	go func() {
+		// the fetch outlives the request that started it, the client
+		// timeout bounds it
+		keys, err := s.fetch(context.Background())
+
+		s.mu.Lock()
+		if err == nil {
+			s.keys = keys
+			s.fetchedAt = time.Now()
+		}
+		s.fetchErr = err
+		s.fetching = nil
+		s.mu.Unlock()
+
+		close(done)
+	}()
+
+	return done
+}
+
+func (s *remoteKeySource) fetch(c context.Context) (map[string]crypto.PublicKey, error) {
+	request, err := http.NewRequestWithContext(c, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks endpoint responded with %d", response.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxJwksSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseJwks(data)
+}
@@ -0,0 +1,295 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	MethodJwt Method = "jwt"
+
+	defaultGroupsClaim = "groups"
+	defaultEmailClaim  = "email"
+	clockLeeway        = 30 * time.Second
+)
+
+type jwtAuthenticator struct {
+	keys          KeySource
+	configuration *config.Config
+	loggerFactory logger.LoggerFactory
+}
+
+func NewJwtAuthenticator(keys KeySource, conf *config.Config, loggerFactory logger.LoggerFactory) Authenticator {
+	return &jwtAuthenticator{
+		keys:          keys,
+		configuration: conf,
+		loggerFactory: loggerFactory,
+	}
+}
+
+// NewKeySource picks the JWKS file when configured, otherwise the JWKS url.
+func NewKeySource(conf *config.Config) (KeySource, error) {
+	jwt := conf.Auth.Jwt
+	if jwt.JwksFile != "" {
+		return NewFileKeySource(jwt.JwksFile)
+	}
+
+	if jwt.JwksUrl == "" {
+		return nil, errors.New("either jwks file or jwks url should be configured")
+	}
+
+	return NewRemoteKeySource(jwt.JwksUrl, jwt.JwksRefresh), nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func (a *jwtAuthenticator) Authenticate(c context.Context, token string) (*Principal, error) {
+	appLogger, loggerClose, err := a.loggerFactory.NewLogger()
+	if err != nil {
+		return nil, err
+	}
+	defer loggerClose()
+
+	claims, err := a.verify(c, token)
+	if err != nil {
+		const message = "invalid credentials"
+
+		appLogger.Warn(message,
+			zap.String("reason", "invalid jwt"),
+			zap.Error(err),
+		)
+
+		return nil, &pserror.PasswordSharingError{
+			Code:    pserror.InvalidCredentials,
+			Message: message,
+			Cause:   err,
+		}
+	}
+
+	jwt := a.configuration.Auth.Jwt
+	groupsClaim := jwt.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = defaultGroupsClaim
+	}
+
+	emailClaim := jwt.EmailClaim
+	if emailClaim == "" {
+		emailClaim = defaultEmailClaim
+	}
+
+	principal := &Principal{
+		Subject: stringClaim(claims, "sub"),
+		Method:  MethodJwt,
+		Email:   stringClaim(claims, emailClaim),
+		Tenant:  stringClaim(claims, jwt.TenantClaim),
+		Groups:  stringsClaim(claims, groupsClaim),
+	}
+
+	// empty group lists grant create and status to every user, admin must
+	// always be granted explicitly
+	if len(jwt.CreateGroups) == 0 || principal.InAnyGroup(jwt.CreateGroups) {
+		principal.Scopes = append(principal.Scopes, ScopeCreate)
+	}
+	if len(jwt.StatusGroups) == 0 || principal.InAnyGroup(jwt.StatusGroups) {
+		principal.Scopes = append(principal.Scopes, ScopeStatus)
+	}
+	if principal.InAnyGroup(jwt.AdminReadGroups) {
+		principal.Scopes = append(principal.Scopes, ScopeAdminRead)
+	}
+	if principal.InAnyGroup(jwt.AdminGroups) {
+		principal.Scopes = append(principal.Scopes, ScopeAdmin)
+	}
+
+	return principal, nil
+}
+
+func (a *jwtAuthenticator) verify(c context.Context, token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	header := &jwtHeader{}
+	if err := decodeSegment(parts[0], header); err != nil {
+		return nil, fmt.Errorf("malformed header: %w", err)
+	}
+
+	key, err := a.keys.Key(c, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature: %w", err)
+	}
+
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed claims: %w", err)
+	}
+
+	jwt := a.configuration.Auth.Jwt
+	if jwt.Issuer != "" && stringClaim(claims, "iss") != jwt.Issuer {
+		return nil, errors.New("unexpected issuer")
+	}
+
+	if jwt.Audience != "" && !contains(stringsClaim(claims, "aud"), jwt.Audience) {
+		return nil, errors.New("unexpected audience")
+	}
+
+	now := time.Now()
+	exp, ok := timeClaim(claims, "exp")
+	if !ok {
+		return nil, errors.New("token has no expiry")
+	}
+	if now.After(exp.Add(clockLeeway)) {
+		return nil, errors.New("token expired")
+	}
+
+	if nbf, ok := timeClaim(claims, "nbf"); ok && now.Add(clockLeeway).Before(nbf) {
+		return nil, errors.New("token is not valid yet")
+	}
+
+	if stringClaim(claims, "sub") == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	return claims, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported algorithm %s", alg)
+	}
+
+	var h hash.Hash
+	var hashType crypto.Hash
+	switch alg[2:] {
+	case "256":
+		h, hashType = sha256.New(), crypto.SHA256
+	case "384":
+		h, hashType = sha512.New384(), crypto.SHA384
+	case "512":
+		h, hashType = sha512.New(), crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %s", alg)
+	}
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch {
+	case strings.HasPrefix(alg, "RS"):
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("algorithm does not match key type")
+		}
+
+		return rsa.VerifyPKCS1v15(rsaKey, hashType, digest, signature)
+	case strings.HasPrefix(alg, "PS"):
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("algorithm does not match key type")
+		}
+
+		return rsa.VerifyPSS(rsaKey, hashType, digest, signature, nil)
+	case strings.HasPrefix(alg, "ES"):
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("algorithm does not match key type")
+		}
+
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid signature length")
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+
+		return nil
+	default:
+		// "none" and HMAC algorithms are rejected on purpose
+		return fmt.Errorf("unsupported algorithm %s", alg)
+	}
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// stringsClaim reads claims which may be a single string or a list, like
+// aud or groups.
+func stringsClaim(claims map[string]interface{}, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		result := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				result = append(result, s)
+			}
+		}
+
+		return result
+	default:
+		return nil
+	}
+}
+
+func timeClaim(claims map[string]interface{}, name string) (time.Time, bool) {
+	value, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(value), 0), true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
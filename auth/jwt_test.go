@@ -0,0 +1,398 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/logger"
+)
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signRs256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := encodeSegment(t, map[string]string{"alg": "RS256", "kid": kid}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func signEs256(t *testing.T, key *ecdsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := encodeSegment(t, map[string]string{"alg": "ES256", "kid": kid}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func jwksOf(rsaKey *rsa.PublicKey, rsaKid string, ecKey *ecdsa.PublicKey, ecKid string) []byte {
+	encode := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+
+	keys := []map[string]string{}
+	if rsaKey != nil {
+		keys = append(keys, map[string]string{
+			"kty": "RSA", "kid": rsaKid, "use": "sig",
+			"n": encode(rsaKey.N), "e": encode(big.NewInt(int64(rsaKey.E))),
+		})
+	}
+	if ecKey != nil {
+		keys = append(keys, map[string]string{
+			"kty": "EC", "kid": ecKid, "crv": "P-256",
+			"x": encode(ecKey.X), "y": encode(ecKey.Y),
+		})
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	return data
+}
+
+func jwtConfig() *config.Config {
+	c := &config.Config{}
+	c.Auth.Jwt.Enabled = true
+	c.Auth.Jwt.Issuer = "https://sso.example.com"
+	c.Auth.Jwt.Audience = "password-sharing"
+	c.Auth.Jwt.CreateGroups = []string{"engineering"}
+	c.Auth.Jwt.AdminGroups = []string{"security"}
+	c.Auth.Jwt.AdminReadGroups = []string{"support"}
+
+	return c
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":    "https://sso.example.com",
+		"aud":    []string{"password-sharing", "other"},
+		"sub":    "user-1",
+		"email":  "user@example.com",
+		"groups": []string{"engineering"},
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"nbf":    time.Now().Add(-time.Minute).Unix(),
+	}
+}
+
+func TestJwtShouldAuthenticateWithJwksFile(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err = os.WriteFile(path, jwksOf(&rsaKey.PublicKey, "rsa", &ecKey.PublicKey, "ec"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := jwtConfig()
+	c.Auth.Jwt.JwksFile = path
+
+	keys, err := NewKeySource(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewJwtAuthenticator(keys, c, logger.NewTestLoggerFactory())
+
+	for _, token := range []string{
+		signRs256(t, rsaKey, "rsa", validClaims()),
+		signEs256(t, ecKey, "ec", validClaims()),
+	} {
+		principal, err := a.Authenticate(context.Background(), token)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if principal.Subject != "user-1" || principal.Email != "user@example.com" || principal.Method != MethodJwt {
+			t.Errorf("unexpected principal %+v", principal)
+		}
+
+		if !principal.Satisfies(Require(ScopeCreate, ScopeStatus)) || principal.HasScope(ScopeAdmin) {
+			t.Errorf("unexpected scopes %v", principal.Scopes)
+		}
+	}
+}
+
+func TestJwtShouldRejectInvalidTokens(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := ParseJwks(jwksOf(&rsaKey.PublicKey, "rsa", nil, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewJwtAuthenticator(&staticKeySource{keys: keys}, jwtConfig(), logger.NewTestLoggerFactory())
+
+	withClaim := func(name string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+
+		return claims
+	}
+
+	valid := signRs256(t, rsaKey, "rsa", validClaims())
+	tampered := valid[:len(valid)-10] + "AAAAAAAAAA"
+
+	cases := []struct {
+		name  string
+		token string
+	}{
+		{"wrong key", signRs256(t, otherKey, "rsa", validClaims())},
+		{"unknown kid", signRs256(t, rsaKey, "missing", validClaims())},
+		{"tampered signature", tampered},
+		{"wrong issuer", signRs256(t, rsaKey, "rsa", withClaim("iss", "https://evil.example.com"))},
+		{"wrong audience", signRs256(t, rsaKey, "rsa", withClaim("aud", "other"))},
+		{"expired", signRs256(t, rsaKey, "rsa", withClaim("exp", time.Now().Add(-time.Hour).Unix()))},
+		{"no expiry", signRs256(t, rsaKey, "rsa", withClaim("exp", nil))},
+		{"not valid yet", signRs256(t, rsaKey, "rsa", withClaim("nbf", time.Now().Add(time.Hour).Unix()))},
+		{"no subject", signRs256(t, rsaKey, "rsa", withClaim("sub", nil))},
+		{"empty algorithm", encodeSegment(t, map[string]string{"kid": "rsa"}) + "." + encodeSegment(t, validClaims()) + "."},
+		{"none algorithm", encodeSegment(t, map[string]string{"alg": "none", "kid": "rsa"}) + "." + encodeSegment(t, validClaims()) + "."},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := a.Authenticate(context.Background(), tc.token)
+			if !errors.Is(err, pserror.InvalidCredentials) {
+				t.Errorf("expected invalid credentials, got %v", err)
+			}
+		})
+	}
+
+	// within the clock leeway
+	principal, err := a.Authenticate(context.Background(),
+		signRs256(t, rsaKey, "rsa", withClaim("exp", time.Now().Add(-10*time.Second).Unix())))
+	if err != nil || principal == nil {
+		t.Errorf("expected token within leeway to be accepted, got %v", err)
+	}
+}
+
+func TestJwtShouldMapGroupsToScopes(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := ParseJwks(jwksOf(&rsaKey.PublicKey, "rsa", nil, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewJwtAuthenticator(&staticKeySource{keys: keys}, jwtConfig(), logger.NewTestLoggerFactory())
+
+	cases := []struct {
+		groups interface{}
+		scopes []Scope
+	}{
+		{[]string{"engineering"}, []Scope{ScopeCreate, ScopeStatus}},
+		{[]string{"sales"}, []Scope{ScopeStatus}},
+		{"security", []Scope{ScopeStatus, ScopeAdmin}},
+		{"support", []Scope{ScopeStatus, ScopeAdminRead}},
+		{nil, []Scope{ScopeStatus}},
+	}
+
+	for _, tc := range cases {
+		claims := validClaims()
+		claims["groups"] = tc.groups
+
+		principal, err := a.Authenticate(context.Background(), signRs256(t, rsaKey, "rsa", claims))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if JoinScopes(principal.Scopes) != JoinScopes(tc.scopes) {
+			t.Errorf("groups %v: expected scopes %v, got %v", tc.groups, tc.scopes, principal.Scopes)
+		}
+	}
+}
+
+func TestRemoteKeySourceShouldRefetchOnUnknownKey(t *testing.T) {
+	first, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rotated atomic.Bool
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if rotated.Load() {
+			w.Write(jwksOf(&second.PublicKey, "second", nil, ""))
+			return
+		}
+
+		w.Write(jwksOf(&first.PublicKey, "first", nil, ""))
+	}))
+	defer server.Close()
+
+	source := NewRemoteKeySource(server.URL, time.Hour).(*remoteKeySource)
+	source.minRefetch = 0
+
+	c := jwtConfig()
+	a := NewJwtAuthenticator(source, c, logger.NewTestLoggerFactory())
+
+	if _, err = a.Authenticate(context.Background(), signRs256(t, first, "first", validClaims())); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = a.Authenticate(context.Background(), signRs256(t, first, "first", validClaims())); err != nil {
+		t.Fatal(err)
+	}
+
+	if fetches.Load() != 1 {
+		t.Errorf("expected jwks to be cached, fetched %d times", fetches.Load())
+	}
+
+	rotated.Store(true)
+	if _, err = a.Authenticate(context.Background(), signRs256(t, second, "second", validClaims())); err != nil {
+		t.Fatal(err)
+	}
+
+	if fetches.Load() != 2 {
+		t.Errorf("expected jwks to be refetched, fetched %d times", fetches.Load())
+	}
+}
+
+type stubAuthenticator struct {
+	method Method
+}
+
+func (s *stubAuthenticator) Authenticate(context.Context, string) (*Principal, error) {
+	return &Principal{Method: s.method}, nil
+}
+
+func TestCompositeAuthenticatorShouldRouteByCredential(t *testing.T) {
+	apiKeys := &stubAuthenticator{method: MethodApiKey}
+	jwt := &stubAuthenticator{method: MethodJwt}
+
+	cases := []struct {
+		jwt        Authenticator
+		credential string
+		expected   Method
+	}{
+		{jwt, "ps_abc_def", MethodApiKey},
+		{jwt, "a.b.c", MethodJwt},
+		{nil, "a.b.c", MethodApiKey},
+	}
+
+	for _, tc := range cases {
+		principal, err := NewCompositeAuthenticator(apiKeys, tc.jwt).Authenticate(context.Background(), tc.credential)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if principal.Method != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.credential, tc.expected, principal.Method)
+		}
+	}
+}
+
+func TestRemoteKeySourceShouldServeCachedKeysDuringRefresh(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// every fetch after the first one hangs until released
+		if fetches.Add(1) > 1 {
+			<-release
+		}
+
+		w.Write(jwksOf(&key.PublicKey, "first", nil, ""))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	source := NewRemoteKeySource(server.URL, time.Hour).(*remoteKeySource)
+	source.minRefetch = 0
+
+	if _, err = source.Key(context.Background(), "first"); err != nil {
+		t.Fatal(err)
+	}
+
+	source.mu.Lock()
+	source.fetchedAt = time.Now().Add(-2 * time.Hour)
+	source.mu.Unlock()
+
+	for i := 0; i < 3; i++ {
+		ctxt, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, err = source.Key(ctxt, "first")
+		cancel()
+
+		if err != nil {
+			t.Fatalf("expected the cached key while refreshing but was %v", err)
+		}
+	}
+
+	// unknown keys wait for the running fetch instead of starting another
+	ctxt, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = source.Key(ctxt, "second"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the lookup to wait for the fetch but was %v", err)
+	}
+
+	if fetches.Load() != 2 {
+		t.Errorf("expected one refresh to run, fetched %d times", fetches.Load())
+	}
+}
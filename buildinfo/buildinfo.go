@@ -0,0 +1,46 @@
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Version is set at build time, e.g.
+// go build -ldflags "-X github.com/misikdmitriy/password-sharing/buildinfo.Version=1.2.0"
+var Version = "dev"
+
+// Info describes the running binary. Revision, Time and Modified come from
+// the version control stamp of the Go toolchain and are empty for builds
+// outside a checkout.
+type Info struct {
+	Version   string
+	Revision  string
+	Time      string
+	Modified  bool
+	GoVersion string
+}
+
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		GoVersion: runtime.Version(),
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.Time = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+
+	return info
+}
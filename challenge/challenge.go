@@ -0,0 +1,294 @@
+package challenge
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/bits"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/database"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Algorithm names the hash a solution is checked with: the SHA-256 of the
+// token followed by the nonce has to start with Difficulty zero bits.
+const Algorithm = "sha256"
+
+const (
+	defaultTtl        = 2 * time.Minute
+	defaultDifficulty = 18
+	keyInfo           = "password-sharing challenge"
+	keyLength         = 32
+	idLength          = 16
+	maxNonceLength    = 64
+	// every cleanupInterval solutions the expired ones are deleted
+	cleanupInterval = 100
+)
+
+var difficultyGauge prometheus.Gauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "password_sharing_challenge_difficulty",
+	Help: "The number of leading zero bits new challenges need",
+})
+
+type Challenge struct {
+	Token      string
+	Difficulty int
+	ExpiresAt  time.Time
+}
+
+// Issuer hands out signed challenges, nothing has to be stored until one is
+// solved. Every instance with the same master secret accepts the challenges
+// of the others.
+type Issuer interface {
+	Issue() (Challenge, error)
+	// Verify checks the solution of an anonymous creation and counts it
+	// towards the creation rate, so it has to be called for every attempt.
+	// Solved challenges are recorded in the database, so a solution is
+	// accepted once by all instances.
+	Verify(c context.Context, token string, nonce string) error
+}
+
+type payload struct {
+	Id         string `json:"id"`
+	Difficulty int    `json:"d"`
+	Expires    int64  `json:"exp"`
+}
+
+type issuer struct {
+	key           []byte
+	ttl           time.Duration
+	difficulty    int
+	maxDifficulty int
+	threshold     int
+	now           func() time.Time
+
+	rate *window
+
+	dbFactory database.DbFactory
+	solved    atomic.Int64
+}
+
+// NewIssuer returns nil when challenges are disabled. The signing key is
+// derived from the master secret.
+func NewIssuer(conf *config.Config, dbFactory database.DbFactory) (Issuer, error) {
+	if !conf.Challenge.Enabled {
+		return nil, nil
+	}
+
+	key := make([]byte, keyLength)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(conf.Encrypt.Secret), nil, []byte(keyInfo)), key); err != nil {
+		return nil, err
+	}
+
+	i := &issuer{
+		key:           key,
+		ttl:           conf.Challenge.Ttl,
+		difficulty:    conf.Challenge.Difficulty,
+		maxDifficulty: conf.Challenge.MaxDifficulty,
+		threshold:     conf.Challenge.Threshold,
+		now:           time.Now,
+		rate:          newWindow(),
+		dbFactory:     dbFactory,
+	}
+
+	if i.ttl <= 0 {
+		i.ttl = defaultTtl
+	}
+	if i.difficulty <= 0 {
+		i.difficulty = defaultDifficulty
+	}
+	if i.maxDifficulty < i.difficulty {
+		i.maxDifficulty = i.difficulty
+	}
+
+	difficultyGauge.Set(float64(i.difficulty))
+
+	return i, nil
+}
+
+func (i *issuer) Issue() (Challenge, error) {
+	now := i.now()
+
+	id := make([]byte, idLength)
+	if _, err := rand.Read(id); err != nil {
+		return Challenge{}, &pserror.PasswordSharingError{
+			Code:    pserror.RandomizerError,
+			Message: "cannot create challenge",
+			Cause:   err,
+		}
+	}
+
+	p := payload{
+		Id:         hex.EncodeToString(id),
+		Difficulty: i.currentDifficulty(now),
+		Expires:    now.Add(i.ttl).Unix(),
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return Challenge{}, err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+
+	return Challenge{
+		Token:      encoded + "." + base64.RawURLEncoding.EncodeToString(i.sign(encoded)),
+		Difficulty: p.Difficulty,
+		ExpiresAt:  time.Unix(p.Expires, 0).UTC(),
+	}, nil
+}
+
+func (i *issuer) Verify(c context.Context, token string, nonce string) error {
+	now := i.now()
+	i.rate.add(now)
+	i.currentDifficulty(now)
+
+	if token == "" || nonce == "" {
+		return &pserror.PasswordSharingError{
+			Code:    pserror.ChallengeRequired,
+			Message: "solve a challenge from /challenge first",
+		}
+	}
+
+	if len(nonce) > maxNonceLength {
+		return invalidChallenge("nonce too long")
+	}
+
+	p, err := i.parse(token)
+	if err != nil {
+		return invalidChallenge(err.Error())
+	}
+
+	if now.Unix() >= p.Expires {
+		return invalidChallenge("challenge expired")
+	}
+
+	sum := sha256.Sum256([]byte(token + nonce))
+	if leadingZeros(sum[:]) < p.Difficulty {
+		return invalidChallenge("solution does not meet the difficulty")
+	}
+
+	return i.markSolved(c, p, now)
+}
+
+// markSolved records the challenge, the primary key makes the first of
+// concurrent solutions win.
+func (i *issuer) markSolved(c context.Context, p payload, now time.Time) error {
+	db, dbClose, err := i.dbFactory.InitDB(c)
+	if err != nil {
+		return &pserror.PasswordSharingError{
+			Code:    pserror.InitDbError,
+			Message: "cannot record challenge",
+			Cause:   err,
+		}
+	}
+	defer dbClose()
+
+	if i.solved.Add(1)%cleanupInterval == 0 {
+		if err = db.Where("expires_at <= ?", now.UTC()).Delete(&model.UsedChallenge{}).Error; err != nil {
+			return dbCommandError(err)
+		}
+	}
+
+	err = db.Create(&model.UsedChallenge{
+		Id:        p.Id,
+		ExpiresAt: time.Unix(p.Expires, 0).UTC(),
+	}).Error
+	if err != nil {
+		if database.IsUniqueViolation(err) {
+			return invalidChallenge("challenge already used")
+		}
+
+		return dbCommandError(err)
+	}
+
+	return nil
+}
+
+// currentDifficulty adds a bit every time the creation rate doubles beyond
+// the threshold.
+func (i *issuer) currentDifficulty(now time.Time) int {
+	difficulty := i.difficulty
+	if i.threshold > 0 {
+		rate := i.rate.count(now)
+		for limit := i.threshold; rate > limit && difficulty < i.maxDifficulty; limit *= 2 {
+			difficulty++
+		}
+	}
+
+	difficultyGauge.Set(float64(difficulty))
+
+	return difficulty
+}
+
+func (i *issuer) sign(data string) []byte {
+	mac := hmac.New(sha256.New, i.key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func (i *issuer) parse(token string) (payload, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return payload{}, errors.New("malformed challenge")
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, i.sign(encoded)) {
+		return payload{}, errors.New("invalid challenge signature")
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return payload{}, errors.New("malformed challenge")
+	}
+
+	var p payload
+	if err = json.Unmarshal(data, &p); err != nil {
+		return payload{}, errors.New("malformed challenge")
+	}
+
+	return p, nil
+}
+
+func invalidChallenge(message string) error {
+	return &pserror.PasswordSharingError{
+		Code:    pserror.InvalidChallenge,
+		Message: message,
+	}
+}
+
+func dbCommandError(err error) error {
+	return &pserror.PasswordSharingError{
+		Code:    pserror.DbCommandError,
+		Message: "cannot record challenge",
+		Cause:   err,
+	}
+}
+
+func leadingZeros(sum []byte) int {
+	result := 0
+	for _, b := range sum {
+		if b != 0 {
+			return result + bits.LeadingZeros8(b)
+		}
+
+		result += 8
+	}
+
+	return result
+}
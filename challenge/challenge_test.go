@@ -0,0 +1,173 @@
+package challenge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/database"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/model"
+)
+
+const testSecret = "bybBGV1Q1sSp9I2tVK0ysd1c"
+
+func newTestIssuer(t *testing.T, difficulty int, maxDifficulty int, threshold int) *issuer {
+	c := &config.Config{}
+	c.Encrypt.Secret = testSecret
+	c.Challenge.Enabled = true
+	c.Challenge.Difficulty = difficulty
+	c.Challenge.MaxDifficulty = maxDifficulty
+	c.Challenge.Threshold = threshold
+
+	c.Database.Provider = "sqlite"
+	c.Database.ConnectionString = "file:" + t.Name() + "?mode=memory&cache=shared"
+
+	dbf := database.NewFactory(c, logger.NewTestLoggerFactory())
+	// the in-memory database lives as long as a connection is open
+	db, dbClose, err := dbf.InitDB(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(dbClose)
+
+	if err = db.AutoMigrate(&model.UsedChallenge{}); err != nil {
+		t.Fatal(err)
+	}
+
+	i, err := NewIssuer(c, dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return i.(*issuer)
+}
+
+func solve(token string, difficulty int) string {
+	for n := 0; ; n++ {
+		nonce := strconv.Itoa(n)
+		sum := sha256.Sum256([]byte(token + nonce))
+		if leadingZeros(sum[:]) >= difficulty {
+			return nonce
+		}
+	}
+}
+
+func TestVerifyShouldAcceptSolutionOnce(t *testing.T) {
+	i := newTestIssuer(t, 8, 0, 0)
+
+	issued, err := i.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if issued.Difficulty != 8 {
+		t.Fatalf("expected difficulty 8 but was %d", issued.Difficulty)
+	}
+
+	nonce := solve(issued.Token, issued.Difficulty)
+	if err = i.Verify(context.Background(), issued.Token, nonce); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = i.Verify(context.Background(), issued.Token, nonce); !errors.Is(err, pserror.InvalidChallenge) {
+		t.Errorf("expected a used challenge to be rejected but was %v", err)
+	}
+
+	// another instance with the same secret and database
+	c := &config.Config{}
+	c.Encrypt.Secret = testSecret
+	c.Challenge.Enabled = true
+
+	other, err := NewIssuer(c, i.dbFactory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = other.Verify(context.Background(), issued.Token, nonce); !errors.Is(err, pserror.InvalidChallenge) {
+		t.Errorf("expected a challenge used on another instance to be rejected but was %v", err)
+	}
+}
+
+func TestVerifyShouldRejectInvalidSolutions(t *testing.T) {
+	i := newTestIssuer(t, 8, 0, 0)
+
+	issued, err := i.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonce := solve(issued.Token, issued.Difficulty)
+
+	// a trivial challenge with the signature of the real one
+	_, signature, _ := strings.Cut(issued.Token, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"id":"forged","d":0,"exp":9999999999}`)) + "." + signature
+
+	var wrongNonce string
+	for n := 0; ; n++ {
+		wrongNonce = strconv.Itoa(n)
+		sum := sha256.Sum256([]byte(issued.Token + wrongNonce))
+		if leadingZeros(sum[:]) < issued.Difficulty {
+			break
+		}
+	}
+
+	cases := []struct {
+		name     string
+		token    string
+		nonce    string
+		after    time.Duration
+		expected pserror.ErrorCodes
+	}{
+		{"missing", "", "", 0, pserror.ChallengeRequired},
+		{"unsolved", issued.Token, wrongNonce, 0, pserror.InvalidChallenge},
+		{"forged", forged, nonce, 0, pserror.InvalidChallenge},
+		{"malformed", "challenge", nonce, 0, pserror.InvalidChallenge},
+		{"expired", issued.Token, nonce, defaultTtl, pserror.InvalidChallenge},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Now().Add(tc.after)
+			i.now = func() time.Time { return now }
+
+			if err := i.Verify(context.Background(), tc.token, tc.nonce); !errors.Is(err, tc.expected) {
+				t.Errorf("expected %v but was %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestDifficultyShouldGrowWithRate(t *testing.T) {
+	i := newTestIssuer(t, 8, 10, 2)
+
+	now := time.Now()
+	i.now = func() time.Time { return now }
+
+	expected := []int{8, 8, 8, 9, 9, 10, 10, 10, 10, 10}
+	for n, difficulty := range expected {
+		issued, err := i.Issue()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if issued.Difficulty != difficulty {
+			t.Errorf("after %d attempts expected difficulty %d but was %d", n, difficulty, issued.Difficulty)
+		}
+
+		i.Verify(context.Background(), "", "")
+	}
+
+	// the rate is measured over the last minute
+	now = now.Add(time.Minute)
+	if issued, err := i.Issue(); err != nil || issued.Difficulty != 8 {
+		t.Errorf("expected difficulty to drop back to 8 but was %d", issued.Difficulty)
+	}
+}
@@ -0,0 +1,57 @@
+package challenge
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	windowSlots = 6
+	slotLength  = 10 * time.Second
+)
+
+// window counts events of the last minute in slots of ten seconds.
+type window struct {
+	mu     sync.Mutex
+	slots  [windowSlots]int
+	starts [windowSlots]int64
+}
+
+func newWindow() *window {
+	return &window{}
+}
+
+func (w *window) add(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	slot, start := slotOf(now)
+	if w.starts[slot] != start {
+		w.starts[slot] = start
+		w.slots[slot] = 0
+	}
+
+	w.slots[slot]++
+}
+
+func (w *window) count(now time.Time) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, start := slotOf(now)
+	oldest := start - int64(windowSlots-1)
+
+	result := 0
+	for i := range w.slots {
+		if w.starts[i] >= oldest && w.starts[i] <= start {
+			result += w.slots[i]
+		}
+	}
+
+	return result
+}
+
+func slotOf(now time.Time) (int, int64) {
+	start := now.UnixNano() / int64(slotLength)
+	return int(start % windowSlots), start
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/misikdmitriy/password-sharing/audit"
+	"github.com/misikdmitriy/password-sharing/auth"
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/database"
+	"github.com/misikdmitriy/password-sharing/service"
+	"github.com/misikdmitriy/password-sharing/tenant"
+)
+
+func runCommand(args []string, apiKeyService service.ApiKeyService, tenants tenant.Registry, dbFactory database.DbFactory) error {
+	switch args[0] {
+	case "apikey":
+		return apiKeyCommand(args[1:], apiKeyService, tenants)
+	case "audit":
+		return auditCommand(args[1:], dbFactory)
+	default:
+		return fmt.Errorf("unknown command %s", args[0])
+	}
+}
+
+func apiKeyCommand(args []string, apiKeyService service.ApiKeyService, tenants tenant.Registry) error {
+	if len(args) == 0 || args[0] != "create" {
+		return errors.New("usage: apikey create -name <name> [-tenant <id>] [-scopes create,status,admin:read,admin] [-ttl 720h]")
+	}
+
+	flags := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+	name := flags.String("name", "", "name of the key owner")
+	scopes := flags.String("scopes", string(auth.ScopeCreate), "comma separated scopes: create, status, admin:read, admin")
+	ttl := flags.Duration("ttl", 0, "lifetime of the key, 0 means it never expires")
+	tenantId := flags.String("tenant", tenants.Default().Id, "tenant the key acts for")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if *name == "" {
+		return errors.New("name is required")
+	}
+
+	parsed, ok := auth.ParseScopes(*scopes)
+	if !ok || len(parsed) == 0 {
+		return fmt.Errorf("invalid scopes %s", *scopes)
+	}
+
+	if _, ok := tenants.Get(*tenantId); !ok {
+		return fmt.Errorf("unknown tenant %s", *tenantId)
+	}
+
+	key, secret, err := apiKeyService.CreateApiKey(context.Background(), *name, *tenantId, parsed, *ttl)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("key id:  %s\napi key: %s\n", key.KeyId, secret)
+	fmt.Println("the api key is shown only once, store it now")
+
+	return nil
+}
+
+func auditCommand(args []string, dbFactory database.DbFactory) error {
+	if len(args) == 0 || args[0] != "verify" {
+		return errors.New("usage: audit verify [-file <path>]")
+	}
+
+	flags := flag.NewFlagSet("audit verify", flag.ContinueOnError)
+	file := flags.String("file", "", "verify this file sink instead of the database")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	var v *audit.Verifier
+	var err error
+	if *file != "" {
+		v, err = audit.VerifyFile(*file)
+	} else {
+		// events recorded before the log was chained are skipped
+		v, err = audit.VerifyDb(context.Background(), dbFactory)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("entries: %d\n", v.Count())
+	if tip := v.Tip(); tip != nil {
+		fmt.Printf("tip:     %d %s\n", tip.Seq, tip.Hash)
+	}
+	fmt.Println("audit log is intact")
+
+	return nil
+}
+
+// configCommand runs before anything else is set up, so a configuration can
+// be checked without its database.
+func configCommand(args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		return errors.New("usage: config check [-file <path>]")
+	}
+
+	flags := flag.NewFlagSet("config check", flag.ContinueOnError)
+	file := flags.String("file", config.FileName(), "configuration file, defaults to the one of WEB_ENV")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	kv, err := loadKv(*file)
+	if err != nil {
+		return err
+	}
+
+	c, err := config.Read(*file, kv)
+	if err != nil {
+		return err
+	}
+
+	effective, err := config.Redacted(c)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(string(effective))
+
+	if err = config.Validate(c); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%s is valid\n", *file)
+	return nil
+}
@@ -3,16 +3,25 @@ package config
 import (
 	"fmt"
 	"os"
+	"reflect"
 	"strings"
+	"time"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 	"go.uber.org/zap/zapcore"
 )
 
+// Config is the configuration of the service. Fields tagged secret may be
+// references to files or environment variables and are redacted whenever the
+// configuration is shown.
 type Config struct {
 	Database struct {
-		ConnectionString string `mapstructure:"connectionstring"`
-		Provider         string `mapstructure:"provider"`
+		ConnectionString string `mapstructure:"connectionstring" secret:"true"`
+		// Password is added to a pg connection string, so the string itself
+		// needs no secret.
+		Password string `mapstructure:"password" secret:"true"`
+		Provider string `mapstructure:"provider"`
 	} `mapstructure:"database"`
 	App struct {
 		LinkLength    int    `mapstructure:"linklength"`
@@ -21,24 +30,260 @@ type Config struct {
 		ConsulAddress string `mapstructure:"consuladdress"`
 		ServiceId     int    `mapstructure:"serviceid"`
 		BasePath      string `mapstructure:"basepath"`
+		// TrustedProxies may set the client address with X-Forwarded-For,
+		// the header is ignored from everyone else.
+		TrustedProxies []string `mapstructure:"trustedproxies"`
+		// DrainPeriod is how long a stopping instance keeps serving after it
+		// reported itself unhealthy, ShutdownTimeout bounds the wait for
+		// in-flight requests afterwards.
+		DrainPeriod     time.Duration `mapstructure:"drainperiod"`
+		ShutdownTimeout time.Duration `mapstructure:"shutdowntimeout"`
+		// AdminPort serves metrics, health, pprof and build info apart from
+		// the API, it is off when zero.
+		AdminPort int `mapstructure:"adminport"`
 	} `mapstructure:"app"`
+	Tls struct {
+		Enabled  bool   `mapstructure:"enabled"`
+		CertFile string `mapstructure:"certfile"`
+		KeyFile  string `mapstructure:"keyfile"`
+		// MinVersion is 1.2 or 1.3, CipherSuites are names of crypto/tls
+		// and only apply to TLS 1.2.
+		MinVersion   string   `mapstructure:"minversion"`
+		CipherSuites []string `mapstructure:"ciphersuites"`
+		// ReloadInterval is how often the files are checked for changes.
+		ReloadInterval time.Duration `mapstructure:"reloadinterval"`
+		// ClientCaFile turns on mutual TLS, the admin and creation routes
+		// then need a client certificate issued by one of these CAs.
+		ClientCaFile string `mapstructure:"clientcafile"`
+	} `mapstructure:"tls"`
+	Health struct {
+		// CacheInterval is how long probes reuse the results of their checks,
+		// Timeout bounds every single check.
+		CacheInterval time.Duration `mapstructure:"cacheinterval"`
+		Timeout       time.Duration `mapstructure:"timeout"`
+		// MinFreeDisk is the free space in bytes zap.logspath needs.
+		MinFreeDisk uint64 `mapstructure:"minfreedisk"`
+	} `mapstructure:"health"`
 	Zap struct {
 		Level    zapcore.Level `mapstructure:"level"`
 		LogsPath string        `mapstructure:"logspath"`
+		// File is the log in LogsPath, rotated files get the time of their
+		// rotation in the name.
+		File     string `mapstructure:"file"`
+		Rotation struct {
+			// MaxSize in megabytes rotates a file that grows beyond it, 100
+			// when zero. Interval rotates at every multiple of it, e.g. 1h.
+			MaxSize  int           `mapstructure:"maxsize"`
+			Interval time.Duration `mapstructure:"interval"`
+			// MaxAge, rounded up to days, and MaxBackups remove old rotated
+			// files, zero keeps them. Compress gzips them.
+			MaxAge     time.Duration `mapstructure:"maxage"`
+			MaxBackups int           `mapstructure:"maxbackups"`
+			Compress   bool          `mapstructure:"compress"`
+		} `mapstructure:"rotation"`
 	} `mapstructure:"zap"`
+	Auth struct {
+		AnonymousCreate bool `mapstructure:"anonymouscreate"`
+		Jwt             struct {
+			Enabled      bool          `mapstructure:"enabled"`
+			Issuer       string        `mapstructure:"issuer"`
+			Audience     string        `mapstructure:"audience"`
+			JwksUrl      string        `mapstructure:"jwksurl"`
+			JwksFile     string        `mapstructure:"jwksfile"`
+			JwksRefresh  time.Duration `mapstructure:"jwksrefresh"`
+			GroupsClaim  string        `mapstructure:"groupsclaim"`
+			EmailClaim   string        `mapstructure:"emailclaim"`
+			CreateGroups []string      `mapstructure:"creategroups"`
+			StatusGroups []string      `mapstructure:"statusgroups"`
+			AdminGroups  []string      `mapstructure:"admingroups"`
+			// AdminReadGroups may use the read-only part of the admin API.
+			AdminReadGroups []string `mapstructure:"adminreadgroups"`
+			TenantClaim     string   `mapstructure:"tenantclaim"`
+		} `mapstructure:"jwt"`
+	} `mapstructure:"auth"`
+	Request struct {
+		BasePath   string        `mapstructure:"basepath"`
+		DefaultTtl time.Duration `mapstructure:"defaultttl"`
+		MaxTtl     time.Duration `mapstructure:"maxttl"`
+	} `mapstructure:"request"`
+	Strength struct {
+		Enabled        bool   `mapstructure:"enabled"`
+		MinScore       int    `mapstructure:"minscore"`
+		RejectBreached bool   `mapstructure:"rejectbreached"`
+		BreachPath     string `mapstructure:"breachpath"`
+	} `mapstructure:"strength"`
 	Encrypt struct {
-		Secret string `mapstructure:"secret"`
-		IV     []byte `mapstructure:"iv"`
+		Secret string `mapstructure:"secret" secret:"true"`
+		IV     []byte `mapstructure:"iv" secret:"true"`
+		// KeyId selects the tenant data keys new secrets are encrypted with.
+		KeyId string `mapstructure:"keyid"`
 	} `mapstructure:"encrypt"`
+	Notify struct {
+		// Provider is smtp, or log which only writes messages to the log and
+		// is meant for development.
+		Provider string `mapstructure:"provider"`
+		Smtp     struct {
+			Host     string `mapstructure:"host"`
+			Port     int    `mapstructure:"port"`
+			Username string `mapstructure:"username"`
+			Password string `mapstructure:"password" secret:"true"`
+			From     string `mapstructure:"from"`
+		} `mapstructure:"smtp"`
+	} `mapstructure:"notify"`
+	Otp struct {
+		Ttl            time.Duration `mapstructure:"ttl"`
+		MaxAttempts    int           `mapstructure:"maxattempts"`
+		ResendInterval time.Duration `mapstructure:"resendinterval"`
+	} `mapstructure:"otp"`
+	Tenancy struct {
+		DefaultTenant string   `mapstructure:"defaulttenant"`
+		Tenants       []Tenant `mapstructure:"tenants"`
+	} `mapstructure:"tenancy"`
+	Audit struct {
+		// Sinks are db, file and syslog, every event is chained and written
+		// to each of them. The admin API reads the db sink.
+		Sinks  []string `mapstructure:"sinks"`
+		File   string   `mapstructure:"file"`
+		Syslog struct {
+			// Network and Address are empty for the local syslog daemon.
+			Network string `mapstructure:"network"`
+			Address string `mapstructure:"address"`
+			Tag     string `mapstructure:"tag"`
+		} `mapstructure:"syslog"`
+	} `mapstructure:"audit"`
+	RateLimit struct {
+		Enabled bool `mapstructure:"enabled"`
+		// Store is memory, or db to enforce limits together with the other
+		// instances.
+		Store   string       `mapstructure:"store"`
+		Default Limit        `mapstructure:"default"`
+		Routes  []RouteLimit `mapstructure:"routes"`
+		// Penalty blocks clients that ask for too many unknown links, every
+		// block is twice as long as the previous one.
+		Penalty struct {
+			Threshold int           `mapstructure:"threshold"`
+			Window    time.Duration `mapstructure:"window"`
+			Block     time.Duration `mapstructure:"block"`
+			MaxBlock  time.Duration `mapstructure:"maxblock"`
+		} `mapstructure:"penalty"`
+	} `mapstructure:"ratelimit"`
+	// Challenge makes anonymous clients solve a proof-of-work challenge
+	// before they create a link.
+	Challenge struct {
+		Enabled bool          `mapstructure:"enabled"`
+		Ttl     time.Duration `mapstructure:"ttl"`
+		// Difficulty is the number of leading zero bits a solution needs,
+		// it grows by a bit whenever the anonymous creation rate doubles
+		// beyond Threshold per minute, up to MaxDifficulty.
+		Difficulty    int `mapstructure:"difficulty"`
+		MaxDifficulty int `mapstructure:"maxdifficulty"`
+		Threshold     int `mapstructure:"threshold"`
+	} `mapstructure:"challenge"`
+	Idempotency struct {
+		// Ttl is how long a response is replayed for a repeated key.
+		Ttl time.Duration `mapstructure:"ttl"`
+	} `mapstructure:"idempotency"`
+	Discovery struct {
+		// Provider is consul, static which writes the instance to a file
+		// for file based discovery, or none. Consul is used when empty.
+		Provider string   `mapstructure:"provider"`
+		Tags     []string `mapstructure:"tags"`
+		Region   string   `mapstructure:"region"`
+		Consul   struct {
+			// Check is http when the agent polls /health, or ttl when the
+			// instance reports its health itself every Interval.
+			Check    string        `mapstructure:"check"`
+			Interval time.Duration `mapstructure:"interval"`
+			// DeregisterAfter removes instances that stayed critical this
+			// long, e.g. after a crash.
+			DeregisterAfter time.Duration `mapstructure:"deregisterafter"`
+			// TlsSkipVerify lets the agent poll an instance with a
+			// certificate it does not trust.
+			TlsSkipVerify bool `mapstructure:"tlsskipverify"`
+		} `mapstructure:"consul"`
+		Static struct {
+			// Path is written in the Prometheus file_sd format.
+			Path string `mapstructure:"path"`
+		} `mapstructure:"static"`
+	} `mapstructure:"discovery"`
+	// Kv reads keys from the Consul KV store at app.consuladdress, they
+	// override the file and are overridden by the environment.
+	Kv struct {
+		Enabled bool `mapstructure:"enabled"`
+		// Prefix is the folder of the keys, e.g. zap/level under it is
+		// zap.level. Values are YAML, so a key may hold a whole section.
+		Prefix string `mapstructure:"prefix"`
+		// Wait bounds a blocking query for changes.
+		Wait time.Duration `mapstructure:"wait"`
+	} `mapstructure:"kv"`
 }
 
-func LoadConfig() (*Config, error) {
+// Layer supplies keys between the file and the environment, the values are
+// nested the way they are in the file.
+type Layer interface {
+	Values() map[string]interface{}
+}
+
+// Tenant is a business unit with its own data keys and secret policy. Zero
+// policy values mean no limit.
+type Tenant struct {
+	Id                string        `mapstructure:"id"`
+	Name              string        `mapstructure:"name"`
+	Hosts             []string      `mapstructure:"hosts"`
+	BasePath          string        `mapstructure:"basepath"`
+	RequestBasePath   string        `mapstructure:"requestbasepath"`
+	MaxTtl            time.Duration `mapstructure:"maxttl"`
+	MaxViews          int           `mapstructure:"maxviews"`
+	MaxSize           int           `mapstructure:"maxsize"`
+	RequirePassphrase bool          `mapstructure:"requirepassphrase"`
+	// AllowedCidrs restricts retrieval of every secret of the tenant to
+	// these networks.
+	AllowedCidrs []string `mapstructure:"allowedcidrs"`
+}
+
+// Limit allows Requests per Period on average and Burst requests at once.
+// Burst defaults to Requests.
+type Limit struct {
+	Requests int           `mapstructure:"requests"`
+	Period   time.Duration `mapstructure:"period"`
+	Burst    int           `mapstructure:"burst"`
+}
+
+// RouteLimit overrides the default limit of a route, an empty Method
+// matches every method.
+type RouteLimit struct {
+	Method string `mapstructure:"method"`
+	Route  string `mapstructure:"route"`
+	Limit  `mapstructure:",squash"`
+}
+
+// LoadConfig reads the configuration of WEB_ENV with layers applied in
+// order and validates it.
+func LoadConfig(layers ...Layer) (*Config, error) {
+	c, err := Read(FileName(), layers...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = Validate(c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Read reads file with defaults, layers and PSCONFIG_ environment overrides
+// applied and secret references resolved, it does not validate.
+func Read(file string, layers ...Layer) (*Config, error) {
 	conf := viper.New()
 
-	configname := fmt.Sprintf("%s.yaml", getWebEnv())
-	conf.SetConfigFile(configname)
+	conf.SetConfigFile(file)
 	conf.SetConfigType("yaml")
 
+	for key, value := range defaults {
+		conf.SetDefault(key, value)
+	}
+
 	conf.SetEnvPrefix("psconfig")
 	conf.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	conf.AutomaticEnv()
@@ -47,10 +292,41 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	for _, layer := range layers {
+		if err := conf.MergeConfigMap(layer.Values()); err != nil {
+			return nil, err
+		}
+	}
+
 	c := &Config{}
-	err := conf.Unmarshal(c)
+	if err := conf.Unmarshal(c, viper.DecodeHook(decodeHook)); err != nil {
+		return nil, err
+	}
+
+	if err := resolveSecrets(reflect.ValueOf(c).Elem(), ""); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// decodeHook adds strings to byte slices to the hooks of viper, so a byte
+// secret can be a reference. It goes first as viper would split the string.
+var decodeHook = mapstructure.ComposeDecodeHookFunc(
+	func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+		if from.Kind() == reflect.String && to == reflect.TypeOf([]byte(nil)) {
+			return []byte(data.(string)), nil
+		}
+
+		return data, nil
+	},
+	mapstructure.StringToTimeDurationHookFunc(),
+	mapstructure.StringToSliceHookFunc(","),
+)
 
-	return c, err
+// FileName is the configuration file of WEB_ENV.
+func FileName() string {
+	return fmt.Sprintf("%s.yaml", getWebEnv())
 }
 
 const defaultEnv = "dev"
@@ -0,0 +1,35 @@
+package config
+
+// defaults apply to keys missing from the file and the environment. Being
+// known to viper, they can also be set with PSCONFIG_ variables.
+var defaults = map[string]interface{}{
+	"app.port":                  80,
+	"app.linklength":            16,
+	"app.shutdowntimeout":       "30s",
+	"database.provider":         "pg",
+	"encrypt.keyid":             "v1",
+	"zap.logspath":              "./logs/",
+	"zap.file":                  "password-sharing.log",
+	"zap.rotation.maxsize":      100,
+	"zap.rotation.interval":     "1h",
+	"zap.rotation.maxage":       "168h",
+	"zap.rotation.compress":     true,
+	"auth.jwt.jwksrefresh":      "1h",
+	"auth.jwt.groupsclaim":      "groups",
+	"auth.jwt.emailclaim":       "email",
+	"otp.ttl":                   "10m",
+	"otp.maxattempts":           5,
+	"otp.resendinterval":        "1m",
+	"challenge.ttl":             "2m",
+	"challenge.difficulty":      18,
+	"idempotency.ttl":           "24h",
+	"tls.minversion":            "1.2",
+	"tls.reloadinterval":        "30s",
+	"health.cacheinterval":      "5s",
+	"health.timeout":            "2s",
+	"discovery.provider":        "consul",
+	"discovery.consul.check":    "http",
+	"discovery.consul.interval": "15s",
+	"kv.prefix":                 "passwordsharing/config/",
+	"kv.wait":                   "5m",
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "[redacted]"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Redacted renders c as YAML in the layout of the configuration files with
+// every secret replaced, empty secrets stay empty to show they are unset.
+func Redacted(c *Config) ([]byte, error) {
+	node, err := nodeOf(reflect.ValueOf(*c))
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+
+	if err = encoder.Encode(node); err != nil {
+		return nil, err
+	}
+
+	if err = encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func nodeOf(v reflect.Value) (*yaml.Node, error) {
+	if v.Type() == durationType {
+		return scalar("!!str", time.Duration(v.Int()).String()), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		if err := appendFields(node, v); err != nil {
+			return nil, err
+		}
+
+		return node, nil
+	case reflect.Slice:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for i := 0; i < v.Len(); i++ {
+			item, err := nodeOf(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+
+			if item.Kind == yaml.MappingNode {
+				node.Style = 0
+			}
+
+			node.Content = append(node.Content, item)
+		}
+
+		return node, nil
+	case reflect.String:
+		return scalar("!!str", v.String()), nil
+	case reflect.Bool:
+		return scalar("!!bool", strconv.FormatBool(v.Bool())), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return scalar("!!int", strconv.FormatInt(v.Int(), 10)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return scalar("!!int", strconv.FormatUint(v.Uint(), 10)), nil
+	default:
+		return nil, fmt.Errorf("cannot render %s", v.Type())
+	}
+}
+
+func appendFields(node *yaml.Node, v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name, squash := keyOf(field)
+
+		if squash {
+			if err := appendFields(node, v.Field(i)); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		value, err := nodeOf(v.Field(i))
+		if err != nil {
+			return err
+		}
+
+		if field.Tag.Get("secret") == "true" && !v.Field(i).IsZero() {
+			value = scalar("!!str", redacted)
+		}
+
+		node.Content = append(node.Content, scalar("!!str", name), value)
+	}
+
+	return nil
+}
+
+func scalar(tag string, value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
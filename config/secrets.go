@@ -0,0 +1,114 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Secret values may be references resolved when the configuration is read:
+// file:///run/secrets/db_password is the content of the file without the
+// trailing newline, env:VAR is the value of the environment variable, and
+// base64: and hex: decode what follows, e.g. hex:file:///run/secrets/iv.
+const (
+	filePrefix   = "file://"
+	envPrefix    = "env:"
+	base64Prefix = "base64:"
+	hexPrefix    = "hex:"
+)
+
+// resolveSecrets replaces the references of every field tagged secret in v.
+// Errors name the key and the reference but never a resolved value.
+func resolveSecrets(v reflect.Value, key string) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+
+		fieldKey := key
+		if name, squash := keyOf(field); !squash {
+			fieldKey = joinKey(key, name)
+		}
+
+		value := v.Field(i)
+		switch {
+		case value.Kind() == reflect.Struct:
+			if err := resolveSecrets(value, fieldKey); err != nil {
+				return err
+			}
+		case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Struct:
+			for j := 0; j < value.Len(); j++ {
+				if err := resolveSecrets(value.Index(j), fmt.Sprintf("%s[%d]", fieldKey, j)); err != nil {
+					return err
+				}
+			}
+		case field.Tag.Get("secret") != "true":
+		case value.Kind() == reflect.String:
+			resolved, err := resolveSecret(value.String())
+			if err != nil {
+				return fmt.Errorf("cannot resolve %s: %w", fieldKey, err)
+			}
+
+			value.SetString(resolved)
+		case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8:
+			// a reference in place of a list of bytes is decoded as its text
+			resolved, err := resolveSecret(string(value.Bytes()))
+			if err != nil {
+				return fmt.Errorf("cannot resolve %s: %w", fieldKey, err)
+			}
+
+			value.SetBytes([]byte(resolved))
+		}
+	}
+
+	return nil
+}
+
+func resolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, filePrefix):
+		content, err := os.ReadFile(strings.TrimPrefix(value, filePrefix))
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimRight(string(content), "\r\n"), nil
+	case strings.HasPrefix(value, envPrefix):
+		name := strings.TrimPrefix(value, envPrefix)
+		resolved, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+
+		return resolved, nil
+	case strings.HasPrefix(value, base64Prefix):
+		encoded, err := resolveSecret(strings.TrimPrefix(value, base64Prefix))
+		if err != nil {
+			return "", err
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return "", fmt.Errorf("invalid base64: %w", err)
+		}
+
+		return string(decoded), nil
+	case strings.HasPrefix(value, hexPrefix):
+		encoded, err := resolveSecret(strings.TrimPrefix(value, hexPrefix))
+		if err != nil {
+			return "", err
+		}
+
+		decoded, err := hex.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			// the error of hex quotes the offending character
+			return "", errors.New("invalid hex")
+		}
+
+		return string(decoded), nil
+	default:
+		return value, nil
+	}
+}
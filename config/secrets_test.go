@@ -0,0 +1,102 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadShouldResolveSecretReferences(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"db_password":    "p@ss'word\n",
+		"encrypt_secret": "bybBGV1Q1sSp9I2tVK0ysd1c\n",
+		"encrypt_iv":     "f3abd06fb08def6ea489ce7012e4c778\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("TEST_SMTP_PASSWORD", "c210cC1wYXNzd29yZA==")
+
+	file := filepath.Join(dir, "test.yaml")
+	content := `
+database:
+  connectionstring: host=localhost user=postgres
+  password: file://` + filepath.Join(dir, "db_password") + `
+encrypt:
+  secret: file://` + filepath.Join(dir, "encrypt_secret") + `
+  iv: hex:file://` + filepath.Join(dir, "encrypt_iv") + `
+notify:
+  smtp:
+    username: mailer
+    password: base64:env:TEST_SMTP_PASSWORD
+`
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Read(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Database.Password != "p@ss'word" {
+		t.Errorf("expected the password of the file but was %q", c.Database.Password)
+	}
+
+	if c.Encrypt.Secret != "bybBGV1Q1sSp9I2tVK0ysd1c" {
+		t.Errorf("expected the secret of the file but was %q", c.Encrypt.Secret)
+	}
+
+	iv := []byte{243, 171, 208, 111, 176, 141, 239, 110, 164, 137, 206, 112, 18, 228, 199, 120}
+	if !bytes.Equal(c.Encrypt.IV, iv) {
+		t.Errorf("expected the decoded iv but was %v", c.Encrypt.IV)
+	}
+
+	if c.Notify.Smtp.Password != "smtp-password" || c.Notify.Smtp.Username != "mailer" {
+		t.Errorf("expected the decoded smtp password but was %q", c.Notify.Smtp.Password)
+	}
+
+	rendered, err := Redacted(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"p@ss", "bybBGV1Q1sSp9I2tVK0ysd1c", "smtp-password", "243"} {
+		if strings.Contains(string(rendered), secret) {
+			t.Errorf("expected %s to be redacted but was\n%s", secret, rendered)
+		}
+	}
+}
+
+func TestReadShouldFailOnBrokenReferences(t *testing.T) {
+	cases := []struct {
+		name     string
+		secret   string
+		expected string
+	}{
+		{"missing variable", "env:TEST_MISSING_SECRET", "cannot resolve encrypt.secret: environment variable TEST_MISSING_SECRET is not set"},
+		{"missing file", "file:///nonexistent/secret", "cannot resolve encrypt.secret: open /nonexistent/secret: no such file or directory"},
+		{"invalid hex", "hex:not-a-secret", "cannot resolve encrypt.secret: invalid hex"},
+		{"invalid base64", "base64:not*a*secret", "cannot resolve encrypt.secret: invalid base64: illegal base64 data at input byte 3"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "test.yaml")
+			if err := os.WriteFile(file, []byte("encrypt:\n  secret: "+tc.secret+"\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := Read(file)
+			if err == nil || err.Error() != tc.expected {
+				t.Errorf("expected %q but was %v", tc.expected, err)
+			}
+		})
+	}
+}
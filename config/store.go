@@ -0,0 +1,197 @@
+package config
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// reloadable are the keys a running instance applies, changes of every
+// other key need a restart. A * stands for the index of a list item.
+var reloadable = []string{
+	"zap.level",
+	"ratelimit.default",
+	"ratelimit.routes",
+	"ratelimit.penalty",
+	"request.defaultttl",
+	"request.maxttl",
+	"encrypt.keyid",
+	"tenancy.tenants.*.maxttl",
+	"tenancy.tenants.*.maxviews",
+	"tenancy.tenants.*.maxsize",
+	"tenancy.tenants.*.requirepassphrase",
+	"tenancy.tenants.*.allowedcidrs",
+}
+
+// Source hands out the current configuration.
+type Source interface {
+	// Current returns the latest snapshot, it must not be modified.
+	Current() *Config
+	// Subscribe calls fn with every snapshot applied from now on.
+	Subscribe(fn func(*Config))
+}
+
+// Store is a Source whose snapshot is replaced while the service runs.
+type Store interface {
+	Source
+	// Apply replaces the snapshot with c when only reloadable keys changed
+	// and returns the keys that did.
+	Apply(c *Config) ([]string, error)
+}
+
+// UnsafeChangeError lists the changed keys that need a restart.
+type UnsafeChangeError struct {
+	Keys []string
+}
+
+func (e *UnsafeChangeError) Error() string {
+	return "changes need a restart: " + strings.Join(e.Keys, ", ")
+}
+
+type store struct {
+	current atomic.Pointer[Config]
+
+	mu          sync.Mutex
+	subscribers []func(*Config)
+}
+
+// NewStore returns a Store holding c. Components take a Source when they
+// apply reloadable keys, the rest may keep the *Config they start with.
+func NewStore(c *Config) Store {
+	s := &store{}
+	s.current.Store(c)
+
+	return s
+}
+
+func (s *store) Current() *Config {
+	return s.current.Load()
+}
+
+func (s *store) Subscribe(fn func(*Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subscribers = append(s.subscribers, fn)
+}
+
+func (s *store) Apply(c *Config) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := Changes(s.current.Load(), c)
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	var unsafe []string
+	for _, key := range changed {
+		if !isReloadable(key) {
+			unsafe = append(unsafe, key)
+		}
+	}
+
+	if len(unsafe) > 0 {
+		return nil, &UnsafeChangeError{Keys: unsafe}
+	}
+
+	s.current.Store(c)
+	for _, fn := range s.subscribers {
+		fn(c)
+	}
+
+	return changed, nil
+}
+
+// Changes returns the keys whose values differ between a and b. Lists of
+// structs of the same length are compared item by item, e.g.
+// tenancy.tenants.0.maxttl, other lists and values as a whole.
+func Changes(a *Config, b *Config) []string {
+	return changes(reflect.ValueOf(*a), reflect.ValueOf(*b), "")
+}
+
+func changes(a reflect.Value, b reflect.Value, key string) []string {
+	var result []string
+	for i := 0; i < a.NumField(); i++ {
+		fieldKey := key
+		if name, squash := keyOf(a.Type().Field(i)); !squash {
+			fieldKey = joinKey(key, name)
+		}
+
+		result = append(result, valueChanges(a.Field(i), b.Field(i), fieldKey)...)
+	}
+
+	return result
+}
+
+func valueChanges(a reflect.Value, b reflect.Value, key string) []string {
+	if a.Kind() == reflect.Struct {
+		return changes(a, b, key)
+	}
+
+	if a.Kind() == reflect.Slice && a.Type().Elem().Kind() == reflect.Struct && a.Len() == b.Len() {
+		var result []string
+		for i := 0; i < a.Len(); i++ {
+			result = append(result, valueChanges(a.Index(i), b.Index(i), joinKey(key, strconv.Itoa(i)))...)
+		}
+
+		return result
+	}
+
+	if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+		return []string{key}
+	}
+
+	return nil
+}
+
+func isReloadable(key string) bool {
+	for _, r := range reloadable {
+		if matchesKey(key, r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesKey reports whether key is pattern or below it.
+func matchesKey(key string, pattern string) bool {
+	keyParts, patternParts := strings.Split(key, "."), strings.Split(pattern, ".")
+	if len(keyParts) < len(patternParts) {
+		return false
+	}
+
+	for i, p := range patternParts {
+		if p != "*" && p != keyParts[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// keyOf returns the name of field in the configuration files and whether
+// its fields are squashed into the parent.
+func keyOf(field reflect.StructField) (string, bool) {
+	name, options, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+	if options == "squash" {
+		return "", true
+	}
+
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+
+	return name, false
+}
+
+func joinKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+
+	return prefix + "." + name
+}
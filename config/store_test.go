@@ -0,0 +1,76 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestApplyShouldReplaceReloadableKeys(t *testing.T) {
+	s := NewStore(validConfig())
+
+	var observed []*Config
+	s.Subscribe(func(c *Config) {
+		observed = append(observed, c)
+	})
+
+	next := *s.Current()
+	next.Zap.Level = zapcore.WarnLevel
+	next.Request.MaxTtl = time.Hour
+	next.RateLimit.Routes = []RouteLimit{{Route: "/link", Limit: Limit{Requests: 1, Period: time.Second}}}
+
+	changed, err := s.Apply(&next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "zap.level, request.maxttl, ratelimit.routes"
+	if strings.Join(changed, ", ") != expected {
+		t.Errorf("expected changes %s but was %v", expected, changed)
+	}
+
+	if s.Current() != &next || len(observed) != 1 || observed[0] != &next {
+		t.Errorf("expected the new snapshot to be current and observed")
+	}
+
+	same := next
+	changed, err = s.Apply(&same)
+	if err != nil || len(changed) != 0 || len(observed) != 1 {
+		t.Errorf("expected an unchanged configuration to be ignored but was %v, %v", changed, err)
+	}
+}
+
+func TestApplyShouldRejectUnsafeChanges(t *testing.T) {
+	initial := validConfig()
+	s := NewStore(initial)
+
+	observed := 0
+	s.Subscribe(func(*Config) {
+		observed++
+	})
+
+	next := *initial
+	next.Zap.Level = zapcore.WarnLevel
+	next.App.Port = 8080
+	next.Database.Provider = "sqlite"
+	next.Encrypt.Secret = strings.Repeat("s", 32)
+
+	_, err := s.Apply(&next)
+
+	var unsafe *UnsafeChangeError
+	if !errors.As(err, &unsafe) {
+		t.Fatalf("expected unsafe changes to be rejected but was %v", err)
+	}
+
+	expected := "changes need a restart: database.provider, app.port, encrypt.secret"
+	if err.Error() != expected {
+		t.Errorf("expected %s but was %s", expected, err.Error())
+	}
+
+	if s.Current() != initial || observed != 0 {
+		t.Errorf("expected the configuration to stay as it was")
+	}
+}
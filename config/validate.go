@@ -0,0 +1,190 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// aesKeyLengths are the key sizes of AES-128, AES-192 and AES-256, the
+// master secret encrypts legacy secrets directly.
+var aesKeyLengths = []int{16, 24, 32}
+
+const (
+	ivLength      = 16
+	minLinkLength = 6
+	maxLinkLength = 128
+	// solving more bits takes minutes in a browser
+	maxDifficulty = 32
+)
+
+// ValidationError lists every problem of a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) check(ok bool, format string, args ...interface{}) {
+	if !ok {
+		v.problems = append(v.problems, fmt.Sprintf(format, args...))
+	}
+}
+
+func (v *validator) oneOf(key string, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+
+	v.problems = append(v.problems, fmt.Sprintf("%s must be one of %s, got %q", key, strings.Join(allowed, ", "), value))
+}
+
+func (v *validator) url(key string, value string, required bool) {
+	if value == "" {
+		v.check(!required, "%s is required", key)
+		return
+	}
+
+	u, err := url.Parse(value)
+	v.check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+		"%s must be an absolute http(s) URL, got %q", key, value)
+}
+
+// Validate reports every problem of c at once, so a broken configuration
+// fails at startup instead of at the first request.
+func Validate(c *Config) error {
+	v := &validator{}
+
+	v.oneOf("database.provider", c.Database.Provider, "pg", "sqlite")
+	v.check(c.Database.ConnectionString != "", "database.connectionstring is required")
+	v.check(c.Database.Password == "" || c.Database.Provider == "pg", "database.password is only supported for pg")
+
+	v.check(c.App.Port > 0 && c.App.Port < 65536, "app.port must be between 1 and 65535, got %d", c.App.Port)
+	v.check(c.App.AdminPort >= 0 && c.App.AdminPort < 65536, "app.adminport must be between 0 and 65535, got %d", c.App.AdminPort)
+	v.check(c.App.AdminPort == 0 || c.App.AdminPort != c.App.Port, "app.adminport must differ from app.port")
+	v.check(c.App.LinkLength >= minLinkLength && c.App.LinkLength <= maxLinkLength,
+		"app.linklength must be between %d and %d, got %d", minLinkLength, maxLinkLength, c.App.LinkLength)
+	v.url("app.basepath", c.App.BasePath, true)
+	v.check(c.App.DrainPeriod >= 0, "app.drainperiod must not be negative")
+	v.check(c.App.ShutdownTimeout >= 0, "app.shutdowntimeout must not be negative")
+	for _, proxy := range c.App.TrustedProxies {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		v.check(cidrErr == nil || net.ParseIP(proxy) != nil, "app.trustedproxies must be addresses or CIDRs, got %q", proxy)
+	}
+
+	v.url("request.basepath", c.Request.BasePath, true)
+	v.check(c.Request.DefaultTtl >= 0 && c.Request.MaxTtl >= 0, "request ttls must not be negative")
+	v.check(c.Request.MaxTtl == 0 || c.Request.DefaultTtl <= c.Request.MaxTtl,
+		"request.defaultttl %s exceeds request.maxttl %s", c.Request.DefaultTtl, c.Request.MaxTtl)
+
+	secretValid := false
+	for _, length := range aesKeyLengths {
+		secretValid = secretValid || len(c.Encrypt.Secret) == length
+	}
+	v.check(secretValid, "encrypt.secret must be 16, 24 or 32 bytes long, got %d bytes", len(c.Encrypt.Secret))
+	v.check(len(c.Encrypt.IV) == ivLength, "encrypt.iv must be %d bytes long, got %d bytes", ivLength, len(c.Encrypt.IV))
+	v.check(c.Encrypt.KeyId != "", "encrypt.keyid is required")
+
+	if c.Auth.Jwt.Enabled {
+		v.check(c.Auth.Jwt.Issuer != "", "auth.jwt.issuer is required when jwt is enabled")
+		v.check(c.Auth.Jwt.Audience != "", "auth.jwt.audience is required when jwt is enabled")
+		v.check(c.Auth.Jwt.JwksUrl != "" || c.Auth.Jwt.JwksFile != "", "auth.jwt.jwksurl or auth.jwt.jwksfile is required when jwt is enabled")
+	}
+
+	if c.Notify.Provider == "" {
+		v.check(false, "notify.provider is required")
+	} else {
+		v.oneOf("notify.provider", c.Notify.Provider, "smtp", "log")
+	}
+	if c.Notify.Provider == "smtp" {
+		v.check(c.Notify.Smtp.Host != "" && c.Notify.Smtp.Port > 0, "notify.smtp.host and notify.smtp.port are required for smtp")
+		v.check(c.Notify.Smtp.From != "", "notify.smtp.from is required for smtp")
+	}
+
+	for _, sink := range c.Audit.Sinks {
+		v.oneOf("audit.sinks", sink, "db", "file", "syslog")
+		v.check(sink != "file" || c.Audit.File != "", "audit.file is required for the file sink")
+	}
+
+	if c.RateLimit.Enabled {
+		v.oneOf("ratelimit.store", c.RateLimit.Store, "memory", "db")
+		validateLimit(v, "ratelimit.default", c.RateLimit.Default)
+		for _, route := range c.RateLimit.Routes {
+			v.check(route.Route != "", "ratelimit.routes need a route")
+			validateLimit(v, "ratelimit.routes "+route.Route, route.Limit)
+		}
+	}
+
+	if c.Challenge.Enabled {
+		v.check(c.Challenge.Difficulty > 0 && c.Challenge.Difficulty <= maxDifficulty,
+			"challenge.difficulty must be between 1 and %d, got %d", maxDifficulty, c.Challenge.Difficulty)
+		v.check(c.Challenge.MaxDifficulty == 0 || (c.Challenge.MaxDifficulty >= c.Challenge.Difficulty && c.Challenge.MaxDifficulty <= maxDifficulty),
+			"challenge.maxdifficulty must be between challenge.difficulty and %d, got %d", maxDifficulty, c.Challenge.MaxDifficulty)
+	}
+
+	if c.Tls.Enabled {
+		v.check(c.Tls.CertFile != "" && c.Tls.KeyFile != "", "tls.certfile and tls.keyfile are required when tls is enabled")
+		v.oneOf("tls.minversion", c.Tls.MinVersion, "1.2", "1.3")
+	}
+
+	v.oneOf("discovery.provider", c.Discovery.Provider, "consul", "static", "none")
+	switch c.Discovery.Provider {
+	case "consul":
+		v.check(c.App.ConsulAddress != "", "app.consuladdress is required for consul")
+		v.oneOf("discovery.consul.check", c.Discovery.Consul.Check, "http", "ttl")
+	case "static":
+		v.check(c.Discovery.Static.Path != "", "discovery.static.path is required for static")
+	}
+
+	if c.Kv.Enabled {
+		v.check(c.App.ConsulAddress != "", "app.consuladdress is required for kv")
+		v.check(c.Kv.Prefix != "", "kv.prefix is required when kv is enabled")
+		v.check(c.Kv.Wait >= 0, "kv.wait must not be negative")
+	}
+
+	ids := map[string]bool{}
+	for _, t := range c.Tenancy.Tenants {
+		v.check(t.Id != "", "tenancy.tenants need an id")
+		v.check(!ids[t.Id], "tenant %s is configured twice", t.Id)
+		ids[t.Id] = true
+
+		v.url("tenant "+t.Id+" basepath", t.BasePath, false)
+		v.url("tenant "+t.Id+" requestbasepath", t.RequestBasePath, false)
+
+		// checked here so a reload with a broken network is rejected
+		for _, cidr := range t.AllowedCidrs {
+			cidr = strings.TrimSpace(cidr)
+			_, _, cidrErr := net.ParseCIDR(cidr)
+			v.check(cidrErr == nil || net.ParseIP(cidr) != nil, "tenant %s allowedcidrs must be addresses or CIDRs, got %q", t.Id, cidr)
+		}
+	}
+	v.check(c.Tenancy.DefaultTenant == "" || len(ids) == 0 || ids[c.Tenancy.DefaultTenant],
+		"tenancy.defaulttenant %s is not configured", c.Tenancy.DefaultTenant)
+
+	v.check(c.Zap.LogsPath != "", "zap.logspath is required")
+	v.check(c.Zap.File != "" && filepath.Base(c.Zap.File) == c.Zap.File, "zap.file must be a file name, got %q", c.Zap.File)
+	rotation := c.Zap.Rotation
+	v.check(rotation.MaxSize >= 0 && rotation.Interval >= 0 && rotation.MaxAge >= 0 && rotation.MaxBackups >= 0,
+		"zap.rotation must not be negative")
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+
+	return nil
+}
+
+func validateLimit(v *validator, key string, limit Limit) {
+	v.check(limit.Requests >= 0 && limit.Burst >= 0, "%s must not be negative", key)
+	v.check(limit.Requests == 0 || limit.Period > 0, "%s needs a period", key)
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validConfig() *Config {
+	c := &Config{}
+	c.Database.Provider = "pg"
+	c.Database.ConnectionString = "host=localhost password=postgres"
+	c.App.Port = 80
+	c.App.LinkLength = 16
+	c.App.BasePath = "http://localhost/api/v1/pwd"
+	c.Request.BasePath = "http://localhost/api/v1/request"
+	c.Encrypt.Secret = "bybBGV1Q1sSp9I2tVK0ysd1c"
+	c.Encrypt.IV = make([]byte, 16)
+	c.Encrypt.KeyId = "v1"
+	c.Notify.Provider = "log"
+	c.Discovery.Provider = "none"
+	c.Zap.LogsPath = "./logs/"
+	c.Zap.File = "password-sharing.log"
+
+	return c
+}
+
+func TestValidateShouldReportProblems(t *testing.T) {
+	cases := []struct {
+		name      string
+		configure func(c *Config)
+		expected  []string
+	}{
+		{"valid", func(c *Config) {}, nil},
+		{"short secret", func(c *Config) { c.Encrypt.Secret = strings.Repeat("s", 20) },
+			[]string{"encrypt.secret must be 16, 24 or 32 bytes long, got 20 bytes"}},
+		{"wrong iv", func(c *Config) { c.Encrypt.IV = make([]byte, 12) },
+			[]string{"encrypt.iv must be 16 bytes long, got 12 bytes"}},
+		{"zero link length", func(c *Config) { c.App.LinkLength = 0 },
+			[]string{"app.linklength must be between 6 and 128, got 0"}},
+		{"missing base path", func(c *Config) { c.App.BasePath = "" },
+			[]string{"app.basepath is required"}},
+		{"relative base path", func(c *Config) { c.Request.BasePath = "/api/v1/request" },
+			[]string{`request.basepath must be an absolute http(s) URL, got "/api/v1/request"`}},
+		{"unknown provider", func(c *Config) { c.Database.Provider = "mysql" },
+			[]string{`database.provider must be one of pg, sqlite, got "mysql"`}},
+		{"same ports", func(c *Config) { c.App.AdminPort = 80 },
+			[]string{"app.adminport must differ from app.port"}},
+		{"bad proxy", func(c *Config) { c.App.TrustedProxies = []string{"10.0.0.0/8", "proxy"} },
+			[]string{`app.trustedproxies must be addresses or CIDRs, got "proxy"`}},
+		{"ttls", func(c *Config) { c.Request.DefaultTtl, c.Request.MaxTtl = 2*time.Hour, time.Hour },
+			[]string{"request.defaultttl 2h0m0s exceeds request.maxttl 1h0m0s"}},
+		{"jwt", func(c *Config) {
+			c.Auth.Jwt.Enabled, c.Auth.Jwt.Issuer, c.Auth.Jwt.Audience = true, "issuer", "audience"
+		},
+			[]string{"auth.jwt.jwksurl or auth.jwt.jwksfile is required when jwt is enabled"}},
+		{"no notifier", func(c *Config) { c.Notify.Provider = "" },
+			[]string{"notify.provider is required"}},
+		{"smtp", func(c *Config) { c.Notify.Provider, c.Notify.Smtp.Host, c.Notify.Smtp.Port = "smtp", "mail", 25 },
+			[]string{"notify.smtp.from is required for smtp"}},
+		{"file sink", func(c *Config) { c.Audit.Sinks = []string{"db", "file"} },
+			[]string{"audit.file is required for the file sink"}},
+		{"rate limit", func(c *Config) {
+			c.RateLimit.Enabled, c.RateLimit.Store = true, "memory"
+			c.RateLimit.Default = Limit{Requests: 10}
+		}, []string{"ratelimit.default needs a period"}},
+		{"difficulty", func(c *Config) { c.Challenge.Enabled, c.Challenge.Difficulty = true, 40 },
+			[]string{"challenge.difficulty must be between 1 and 32, got 40"}},
+		{"tls", func(c *Config) { c.Tls.Enabled, c.Tls.MinVersion = true, "1.0" },
+			[]string{"tls.certfile and tls.keyfile are required when tls is enabled", `tls.minversion must be one of 1.2, 1.3, got "1.0"`}},
+		{"static discovery", func(c *Config) { c.Discovery.Provider = "static" },
+			[]string{"discovery.static.path is required for static"}},
+		{"log file", func(c *Config) { c.Zap.File = "../app.log" },
+			[]string{`zap.file must be a file name, got "../app.log"`}},
+		{"kv", func(c *Config) { c.Kv.Enabled = true },
+			[]string{"app.consuladdress is required for kv", "kv.prefix is required when kv is enabled"}},
+		{"tenants", func(c *Config) {
+			c.Tenancy.DefaultTenant = "c"
+			c.Tenancy.Tenants = []Tenant{{Id: "a"}, {Id: "a", BasePath: "a.example.com"}}
+		}, []string{
+			"tenant a is configured twice",
+			`tenant a basepath must be an absolute http(s) URL, got "a.example.com"`,
+			"tenancy.defaulttenant c is not configured",
+		}},
+		{"everything at once", func(c *Config) {
+			c.Encrypt.Secret = ""
+			c.App.LinkLength = 0
+		}, []string{
+			"app.linklength must be between 6 and 128, got 0",
+			"encrypt.secret must be 16, 24 or 32 bytes long, got 0 bytes",
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := validConfig()
+			tc.configure(c)
+
+			err := Validate(c)
+			if tc.expected == nil {
+				if err != nil {
+					t.Fatalf("expected a valid configuration but was %v", err)
+				}
+
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("expected a validation error but was %v", err)
+			}
+
+			if strings.Join(validationErr.Problems, "\n") != strings.Join(tc.expected, "\n") {
+				t.Errorf("expected problems\n%s\nbut was\n%s", strings.Join(tc.expected, "\n"), strings.Join(validationErr.Problems, "\n"))
+			}
+		})
+	}
+}
+
+func TestReadShouldApplyDefaults(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.yaml")
+	content := `
+database:
+  connectionstring: host=localhost password=postgres
+app:
+  basepath: http://localhost/api/v1/pwd
+  consuladdress: 127.0.0.1:8500
+request:
+  basepath: http://localhost/api/v1/request
+encrypt:
+  secret: bybBGV1Q1sSp9I2tVK0ysd1c
+  iv: [1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16]
+notify:
+  provider: log
+`
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PSCONFIG_APP_PORT", "8080")
+
+	c, err := Read(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = Validate(c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.App.LinkLength != 16 || c.Database.Provider != "pg" || c.App.ShutdownTimeout != 30*time.Second || c.Discovery.Provider != "consul" {
+		t.Errorf("expected defaults to apply but was %+v", c.App)
+	}
+
+	if c.App.Port != 8080 {
+		t.Errorf("expected the environment to override the default port but was %d", c.App.Port)
+	}
+}
+
+func TestRedactedShouldHideSecrets(t *testing.T) {
+	c := validConfig()
+	c.Notify.Smtp.Username = "mailer"
+	c.Auth.Jwt.CreateGroups = []string{"writers"}
+	c.App.ShutdownTimeout = 20 * time.Second
+
+	rendered, err := Redacted(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := string(rendered)
+	for _, secret := range []string{"postgres", c.Encrypt.Secret} {
+		if strings.Contains(text, secret) {
+			t.Errorf("expected %s to be redacted but was\n%s", secret, text)
+		}
+	}
+
+	for _, expected := range []string{
+		"  connectionstring: '[redacted]'",
+		"  iv: '[redacted]'",
+		"    password: \"\"",
+		"    username: mailer",
+		"    creategroups: [writers]",
+		"  shutdowntimeout: 20s",
+	} {
+		if !strings.Contains(text, expected+"\n") {
+			t.Errorf("expected %q in\n%s", expected, text)
+		}
+	}
+}
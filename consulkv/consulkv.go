@@ -0,0 +1,226 @@
+package consulkv
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	minWatchBackoff = 500 * time.Millisecond
+	maxWatchBackoff = 30 * time.Second
+)
+
+var watchErrorsCounter prometheus.Counter = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "password_sharing_config_kv_errors",
+	Help: "The total number of failed Consul KV queries, the last keys read stay in use",
+})
+
+// Layer is the configuration under a Consul KV prefix.
+type Layer interface {
+	config.Layer
+	// Load reads the keys once.
+	Load(c context.Context) error
+	// Watch follows the keys with blocking queries and calls changed after
+	// every change until c is done.
+	Watch(c context.Context, loggerFactory logger.LoggerFactory, changed func())
+}
+
+type layer struct {
+	kv         *api.KV
+	prefix     string
+	wait       time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu     sync.Mutex
+	values map[string]interface{}
+	index  uint64
+}
+
+// NewLayer returns the layer configured under kv, or one without keys when
+// kv is disabled.
+func NewLayer(conf *config.Config) (Layer, error) {
+	if !conf.Kv.Enabled {
+		return &emptyLayer{}, nil
+	}
+
+	client, err := api.NewClient(&api.Config{
+		Address: conf.App.ConsulAddress,
+		Scheme:  "http",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &layer{
+		kv:         client.KV(),
+		prefix:     conf.Kv.Prefix,
+		wait:       conf.Kv.Wait,
+		minBackoff: minWatchBackoff,
+		maxBackoff: maxWatchBackoff,
+		values:     map[string]interface{}{},
+	}, nil
+}
+
+// Values returns a copy, viper changes the maps it merges.
+func (l *layer) Values() map[string]interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return copyValue(l.values).(map[string]interface{})
+}
+
+func (l *layer) Load(c context.Context) error {
+	pairs, meta, err := l.kv.List(l.prefix, (&api.QueryOptions{}).WithContext(c))
+	if err != nil {
+		return err
+	}
+
+	l.set(pairs, meta.LastIndex)
+	return nil
+}
+
+func (l *layer) Watch(c context.Context, loggerFactory logger.LoggerFactory, changed func()) {
+	backoff := l.minBackoff
+	for {
+		l.mu.Lock()
+		index := l.index
+		l.mu.Unlock()
+
+		pairs, meta, err := l.kv.List(l.prefix, (&api.QueryOptions{WaitIndex: index, WaitTime: l.wait}).WithContext(c))
+		if c.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			watchErrorsCounter.Inc()
+			l.watchError(loggerFactory, err, backoff)
+
+			select {
+			case <-c.Done():
+				return
+			case <-time.After(backoff):
+			}
+
+			backoff *= 2
+			if backoff > l.maxBackoff {
+				backoff = l.maxBackoff
+			}
+
+			continue
+		}
+
+		backoff = l.minBackoff
+		if meta.LastIndex == index {
+			// the query timed out without changes
+			continue
+		}
+
+		l.set(pairs, meta.LastIndex)
+		changed()
+	}
+}
+
+func (l *layer) watchError(loggerFactory logger.LoggerFactory, err error, backoff time.Duration) {
+	appLogger, loggerClose, loggerErr := loggerFactory.NewLogger()
+	if loggerErr != nil {
+		return
+	}
+	defer loggerClose()
+
+	appLogger.Warn("cannot watch consul kv, keeping the last keys",
+		zap.Error(err),
+		zap.String("prefix", l.prefix),
+		zap.Duration("retryIn", backoff),
+	)
+}
+
+// set replaces the values with pairs. A key like app/linklength becomes
+// app.linklength, a value that is not YAML is kept as a string.
+func (l *layer) set(pairs api.KVPairs, index uint64) {
+	values := map[string]interface{}{}
+	for _, pair := range pairs {
+		key := strings.Trim(strings.TrimPrefix(pair.Key, l.prefix), "/")
+		if key == "" || strings.HasSuffix(pair.Key, "/") || len(pair.Value) == 0 {
+			// folders
+			continue
+		}
+
+		var value interface{}
+		if err := yaml.Unmarshal(pair.Value, &value); err != nil {
+			value = string(pair.Value)
+		}
+
+		setValue(values, strings.Split(strings.ToLower(key), "/"), value)
+	}
+
+	// an index that went back, e.g. after a restore, is used as it is, but
+	// a blocking query on 0 would not block
+	if index < 1 {
+		index = 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.values = values
+	l.index = index
+}
+
+func setValue(values map[string]interface{}, path []string, value interface{}) {
+	for _, name := range path[:len(path)-1] {
+		next, ok := values[name].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			values[name] = next
+		}
+
+		values = next
+	}
+
+	values[path[len(path)-1]] = value
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = copyValue(item)
+		}
+
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = copyValue(item)
+		}
+
+		return result
+	default:
+		return value
+	}
+}
+
+type emptyLayer struct{}
+
+func (l *emptyLayer) Values() map[string]interface{} {
+	return map[string]interface{}{}
+}
+
+func (l *emptyLayer) Load(context.Context) error {
+	return nil
+}
+
+func (l *emptyLayer) Watch(context.Context, logger.LoggerFactory, func()) {
+}
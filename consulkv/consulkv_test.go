@@ -0,0 +1,237 @@
+package consulkv
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"go.uber.org/zap/zapcore"
+)
+
+// fakeKv answers recursive KV reads with blocking queries.
+type fakeKv struct {
+	mu    sync.Mutex
+	pairs map[string]string
+	index uint64
+	// changed is closed and replaced on every change
+	changed chan struct{}
+	// unavailable is the number of reads to fail
+	unavailable int
+}
+
+func newFakeKv(pairs map[string]string) *fakeKv {
+	return &fakeKv{pairs: pairs, index: 1, changed: make(chan struct{})}
+}
+
+func (kv *fakeKv) put(key string, value string) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	kv.pairs[key] = value
+	kv.index++
+	close(kv.changed)
+	kv.changed = make(chan struct{})
+}
+
+func (kv *fakeKv) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	if r.Method != http.MethodGet || prefix == r.URL.Path {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	kv.mu.Lock()
+	if kv.unavailable > 0 {
+		kv.unavailable--
+		kv.mu.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+	if index >= kv.index {
+		changed := kv.changed
+		kv.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+
+		kv.mu.Lock()
+	}
+	defer kv.mu.Unlock()
+
+	var pairs api.KVPairs
+	for key, value := range kv.pairs {
+		if strings.HasPrefix(key, prefix) {
+			pairs = append(pairs, &api.KVPair{Key: key, Value: []byte(value), ModifyIndex: kv.index})
+		}
+	}
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(kv.index, 10))
+	if len(pairs) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(pairs)
+}
+
+func newLayer(t *testing.T, kv *fakeKv) *layer {
+	server := httptest.NewServer(kv)
+	t.Cleanup(server.Close)
+
+	c := &config.Config{}
+	c.App.ConsulAddress = strings.TrimPrefix(server.URL, "http://")
+	c.Kv.Enabled = true
+	c.Kv.Prefix = "passwordsharing/config/"
+	c.Kv.Wait = time.Second
+
+	l, err := NewLayer(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return l.(*layer)
+}
+
+func writeConfig(t *testing.T) string {
+	file := filepath.Join(t.TempDir(), "test.yaml")
+	content := `
+app:
+  linklength: 10
+  port: 4000
+zap:
+  level: 0
+ratelimit:
+  default:
+    requests: 5
+    period: 1s
+`
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+func TestLayerShouldOverrideFileButNotEnvironment(t *testing.T) {
+	l := newLayer(t, newFakeKv(map[string]string{
+		"passwordsharing/config/":                     "",
+		"passwordsharing/config/zap/level":            "1",
+		"passwordsharing/config/app/linklength":       "12",
+		"passwordsharing/config/ratelimit/default":    "requests: 7\nperiod: 1m",
+		"passwordsharing/config/app/TrustedProxies":   "[10.0.0.0/8]",
+		"passwordsharing/config/request/basepath":     "http://localhost/{not yaml",
+		"passwordsharing/other/app/port":              "5000",
+		"passwordsharing/config/discovery/provider/":  "",
+		"passwordsharing/config/encrypt/secret":       "env:TEST_KV_SECRET",
+		"passwordsharing/config/notify/smtp/username": "mailer",
+	}))
+
+	if err := l.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PSCONFIG_APP_LINKLENGTH", "14")
+	t.Setenv("TEST_KV_SECRET", "resolved")
+
+	c, err := config.Read(writeConfig(t), l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Zap.Level != zapcore.WarnLevel {
+		t.Errorf("expected the level of consul but was %v", c.Zap.Level)
+	}
+
+	if c.App.LinkLength != 14 {
+		t.Errorf("expected the link length of the environment but was %d", c.App.LinkLength)
+	}
+
+	if c.App.Port != 4000 {
+		t.Errorf("expected keys outside the prefix to be ignored but port was %d", c.App.Port)
+	}
+
+	if c.RateLimit.Default.Requests != 7 || c.RateLimit.Default.Period != time.Minute {
+		t.Errorf("expected the section of consul but was %+v", c.RateLimit.Default)
+	}
+
+	if len(c.App.TrustedProxies) != 1 || c.App.TrustedProxies[0] != "10.0.0.0/8" {
+		t.Errorf("expected a list of consul but was %v", c.App.TrustedProxies)
+	}
+
+	if c.Request.BasePath != "http://localhost/{not yaml" {
+		t.Errorf("expected a value that is not yaml as it is but was %s", c.Request.BasePath)
+	}
+
+	if c.Encrypt.Secret != "resolved" || c.Notify.Smtp.Username != "mailer" {
+		t.Errorf("expected nested keys and references to resolve but was %s and %s", c.Encrypt.Secret, c.Notify.Smtp.Username)
+	}
+}
+
+func TestWatchShouldFollowChanges(t *testing.T) {
+	kv := newFakeKv(map[string]string{"passwordsharing/config/zap/level": "1"})
+	kv.unavailable = 2
+
+	l := newLayer(t, kv)
+	l.minBackoff, l.maxBackoff = time.Millisecond, time.Millisecond
+
+	c, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan map[string]interface{}, 10)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		l.Watch(c, logger.NewTestLoggerFactory(), func() {
+			changes <- l.Values()
+		})
+	}()
+
+	// the first answer after the failures is a change from nothing
+	expectLevel(t, changes, 1)
+
+	kv.put("passwordsharing/config/zap/level", "-1")
+	expectLevel(t, changes, -1)
+
+	select {
+	case values := <-changes:
+		t.Errorf("expected timed out queries not to report changes but was %v", values)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("watch did not stop")
+	}
+}
+
+func expectLevel(t *testing.T, changes chan map[string]interface{}, level int) {
+	t.Helper()
+
+	select {
+	case values := <-changes:
+		zap, _ := values["zap"].(map[string]interface{})
+		if zap["level"] != level {
+			t.Errorf("expected level %d but was %v", level, values)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("change was not reported")
+	}
+}
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/misikdmitriy/password-sharing/auth"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/openapi"
+	"github.com/misikdmitriy/password-sharing/service"
+)
+
+type adminApiKeysController struct {
+	service service.AdminService
+}
+
+func NewAdminApiKeysController(service service.AdminService) Controller {
+	return &adminApiKeysController{
+		service: service,
+	}
+}
+
+func (ctrl *adminApiKeysController) Hander() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys, err := ctrl.service.ApiKeys(c)
+		if err != nil {
+			writeError(c, err)
+
+			return
+		}
+
+		response := model.ApiKeysResponse{
+			Keys: make([]model.ApiKeyResponse, len(keys)),
+		}
+		for i, k := range keys {
+			scopes := []string{}
+			if k.Scopes != "" {
+				scopes = strings.Split(k.Scopes, ",")
+			}
+
+			response.Keys[i] = model.ApiKeyResponse{
+				KeyId:      k.KeyId,
+				Name:       k.Name,
+				Tenant:     k.TenantId,
+				Scopes:     scopes,
+				CreatedAt:  k.CreatedAt,
+				ExpiresAt:  k.ExpiresAt,
+				LastUsedAt: k.LastUsedAt,
+				RevokedAt:  k.RevokedAt,
+			}
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+func (ctrl *adminApiKeysController) Route() string {
+	return "/apikeys"
+}
+
+func (ctrl *adminApiKeysController) Method() string {
+	return http.MethodGet
+}
+
+func (ctrl *adminApiKeysController) Doc() openapi.Operation {
+	return openapi.Operation{
+		Summary:  "List API keys",
+		Response: model.ApiKeysResponse{},
+		Errors: []pserror.ErrorCodes{
+			pserror.InsufficientRole,
+			pserror.InitDbError,
+			pserror.DbQueryError,
+		},
+	}
+}
+
+func (ctrl *adminApiKeysController) Auth() auth.Requirement {
+	return auth.Require(auth.ScopeAdminRead)
+}
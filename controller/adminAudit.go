@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/misikdmitriy/password-sharing/auth"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/openapi"
+	"github.com/misikdmitriy/password-sharing/service"
+)
+
+const (
+	beforeQuery = "before"
+	limitQuery  = "limit"
+)
+
+type adminAuditController struct {
+	service service.AdminService
+}
+
+func NewAdminAuditController(service service.AdminService) Controller {
+	return &adminAuditController{
+		service: service,
+	}
+}
+
+func (ctrl *adminAuditController) Hander() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := service.AuditQuery{}
+
+		var err error
+		if before := c.Query(beforeQuery); before != "" {
+			if query.Before, err = strconv.ParseInt(before, 10, 64); err != nil {
+				writeError(c, invalidAdminQueryError(beforeQuery))
+
+				return
+			}
+		}
+
+		if limit := c.Query(limitQuery); limit != "" {
+			if query.Limit, err = strconv.Atoi(limit); err != nil {
+				writeError(c, invalidAdminQueryError(limitQuery))
+
+				return
+			}
+		}
+
+		events, err := ctrl.service.AuditEvents(c, query)
+		if err != nil {
+			writeError(c, err)
+
+			return
+		}
+
+		response := model.AuditLogResponse{
+			Events: make([]model.AuditEventResponse, len(events)),
+		}
+		for i, e := range events {
+			response.Events[i] = model.AuditEventResponse{
+				Id:       e.Id,
+				Seq:      e.Seq,
+				Time:     e.Time,
+				Actor:    e.Actor,
+				Tenant:   e.TenantId,
+				Action:   e.Action,
+				Target:   e.Target,
+				Outcome:  e.Outcome,
+				PrevHash: e.PrevHash,
+				Hash:     e.Hash,
+			}
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+func (ctrl *adminAuditController) Route() string {
+	return "/audit"
+}
+
+func (ctrl *adminAuditController) Method() string {
+	return http.MethodGet
+}
+
+func (ctrl *adminAuditController) Doc() openapi.Operation {
+	return openapi.Operation{
+		Summary:  "Read the audit log, newest events first",
+		Query:    []string{beforeQuery, limitQuery},
+		Response: model.AuditLogResponse{},
+		Errors: []pserror.ErrorCodes{
+			pserror.InvalidAdminQuery,
+			pserror.InsufficientRole,
+			pserror.InitDbError,
+			pserror.DbQueryError,
+		},
+	}
+}
+
+func (ctrl *adminAuditController) Auth() auth.Requirement {
+	return auth.Require(auth.ScopeAdminRead)
+}
+
+func invalidAdminQueryError(parameter string) error {
+	return &pserror.PasswordSharingError{
+		Code:    pserror.InvalidAdminQuery,
+		Message: "invalid query parameter " + parameter,
+	}
+}
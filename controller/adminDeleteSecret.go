@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/misikdmitriy/password-sharing/auth"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/openapi"
+	"github.com/misikdmitriy/password-sharing/service"
+)
+
+type adminDeleteSecretController struct {
+	service service.AdminService
+}
+
+func NewAdminDeleteSecretController(service service.AdminService) Controller {
+	return &adminDeleteSecretController{
+		service: service,
+	}
+}
+
+func (ctrl *adminDeleteSecretController) Hander() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hash := c.Param("hash")
+		if hash == "" {
+			writeError(c, pserror.BadRequestError())
+
+			return
+		}
+
+		if err := ctrl.service.DeleteSecret(c, hash); err != nil {
+			writeError(c, err)
+
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func (ctrl *adminDeleteSecretController) Route() string {
+	return "/secrets/:hash"
+}
+
+func (ctrl *adminDeleteSecretController) Method() string {
+	return http.MethodDelete
+}
+
+func (ctrl *adminDeleteSecretController) Doc() openapi.Operation {
+	return openapi.Operation{
+		Summary: "Delete a secret by the SHA-256 hash of its link",
+		Status:  http.StatusNoContent,
+		Errors: []pserror.ErrorCodes{
+			pserror.BadRequest,
+			pserror.InsufficientRole,
+			pserror.LinkHashNotFound,
+			pserror.InitDbError,
+			pserror.DbQueryError,
+			pserror.DbCommandError,
+		},
+	}
+}
+
+func (ctrl *adminDeleteSecretController) Auth() auth.Requirement {
+	return auth.Require(auth.ScopeAdmin)
+}
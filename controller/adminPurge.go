@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/misikdmitriy/password-sharing/auth"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/openapi"
+	"github.com/misikdmitriy/password-sharing/service"
+)
+
+type adminPurgeController struct {
+	service service.AdminService
+}
+
+func NewAdminPurgeController(service service.AdminService) Controller {
+	return &adminPurgeController{
+		service: service,
+	}
+}
+
+func (ctrl *adminPurgeController) Hander() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		purged, err := ctrl.service.PurgeExpired(c)
+		if err != nil {
+			writeError(c, err)
+
+			return
+		}
+
+		c.JSON(http.StatusOK, model.PurgeResponse{
+			Purged: purged,
+		})
+	}
+}
+
+func (ctrl *adminPurgeController) Route() string {
+	return "/secrets/purge"
+}
+
+func (ctrl *adminPurgeController) Method() string {
+	return http.MethodPost
+}
+
+func (ctrl *adminPurgeController) Doc() openapi.Operation {
+	return openapi.Operation{
+		Summary:  "Delete expired and used up secrets now",
+		Response: model.PurgeResponse{},
+		Errors: []pserror.ErrorCodes{
+			pserror.InsufficientRole,
+			pserror.InitDbError,
+			pserror.DbCommandError,
+		},
+	}
+}
+
+func (ctrl *adminPurgeController) Auth() auth.Requirement {
+	return auth.Require(auth.ScopeAdmin)
+}
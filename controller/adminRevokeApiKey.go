@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/misikdmitriy/password-sharing/auth"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/openapi"
+	"github.com/misikdmitriy/password-sharing/service"
+)
+
+type adminRevokeApiKeyController struct {
+	service service.AdminService
+}
+
+func NewAdminRevokeApiKeyController(service service.AdminService) Controller {
+	return &adminRevokeApiKeyController{
+		service: service,
+	}
+}
+
+func (ctrl *adminRevokeApiKeyController) Hander() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keyId := c.Param("keyId")
+		if keyId == "" {
+			writeError(c, pserror.BadRequestError())
+
+			return
+		}
+
+		if err := ctrl.service.RevokeApiKey(c, keyId); err != nil {
+			writeError(c, err)
+
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func (ctrl *adminRevokeApiKeyController) Route() string {
+	return "/apikeys/:keyId"
+}
+
+func (ctrl *adminRevokeApiKeyController) Method() string {
+	return http.MethodDelete
+}
+
+func (ctrl *adminRevokeApiKeyController) Doc() openapi.Operation {
+	return openapi.Operation{
+		Summary: "Revoke an API key",
+		Status:  http.StatusNoContent,
+		Errors: []pserror.ErrorCodes{
+			pserror.BadRequest,
+			pserror.InsufficientRole,
+			pserror.ApiKeyNotFound,
+			pserror.ApiKeyRevoked,
+			pserror.InitDbError,
+			pserror.DbQueryError,
+			pserror.DbCommandError,
+		},
+	}
+}
+
+func (ctrl *adminRevokeApiKeyController) Auth() auth.Requirement {
+	return auth.Require(auth.ScopeAdmin)
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/misikdmitriy/password-sharing/auth"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/openapi"
+	"github.com/misikdmitriy/password-sharing/service"
+)
+
+type adminStatsController struct {
+	service service.AdminService
+}
+
+func NewAdminStatsController(service service.AdminService) Controller {
+	return &adminStatsController{
+		service: service,
+	}
+}
+
+func (ctrl *adminStatsController) Hander() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats, err := ctrl.service.SecretStats(c)
+		if err != nil {
+			writeError(c, err)
+
+			return
+		}
+
+		response := model.SecretStatsResponse{
+			Tenants: make([]model.TenantSecretStatsResponse, len(stats)),
+		}
+		for i, s := range stats {
+			response.Tenants[i] = model.TenantSecretStatsResponse{
+				Tenant:   s.TenantId,
+				Total:    s.Total,
+				LastHour: s.LastHour,
+				LastDay:  s.LastDay,
+				LastWeek: s.LastWeek,
+			}
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+func (ctrl *adminStatsController) Route() string {
+	return "/secrets/stats"
+}
+
+func (ctrl *adminStatsController) Method() string {
+	return http.MethodGet
+}
+
+func (ctrl *adminStatsController) Doc() openapi.Operation {
+	return openapi.Operation{
+		Summary:  "Count active secrets of the tenant by age",
+		Response: model.SecretStatsResponse{},
+		Errors: []pserror.ErrorCodes{
+			pserror.InsufficientRole,
+			pserror.InitDbError,
+			pserror.DbQueryError,
+		},
+	}
+}
+
+func (ctrl *adminStatsController) Auth() auth.Requirement {
+	return auth.Require(auth.ScopeAdminRead)
+}
@@ -1,9 +1,39 @@
 package controller
 
-import "github.com/gin-gonic/gin"
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/misikdmitriy/password-sharing/auth"
+	"github.com/misikdmitriy/password-sharing/middleware"
+	"github.com/misikdmitriy/password-sharing/openapi"
+	"github.com/misikdmitriy/password-sharing/tenant"
+)
 
 type Controller interface {
 	Hander() gin.HandlerFunc
 	Route() string
 	Method() string
+	Doc() openapi.Operation
+	Auth() auth.Requirement
+}
+
+func writeError(c *gin.Context, err error) {
+	middleware.WriteError(c, err)
+}
+
+// linkBase returns the base path of links of the request tenant, tenants may
+// be served on their own hosts.
+func linkBase(c *gin.Context, fallback string) string {
+	if t := tenant.From(c); t != nil && t.BasePath != "" {
+		return t.BasePath
+	}
+
+	return fallback
+}
+
+func requestBase(c *gin.Context, fallback string) string {
+	if t := tenant.From(c); t != nil && t.RequestBasePath != "" {
+		return t.RequestBasePath
+	}
+
+	return fallback
 }
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/misikdmitriy/password-sharing/auth"
+	"github.com/misikdmitriy/password-sharing/buildinfo"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/openapi"
+)
+
+type buildInfoController struct {
+	response model.BuildInfoResponse
+}
+
+func NewBuildInfoController() Controller {
+	info := buildinfo.Get()
+
+	return &buildInfoController{
+		response: model.BuildInfoResponse{
+			Version:   info.Version,
+			Revision:  info.Revision,
+			Time:      info.Time,
+			Modified:  info.Modified,
+			GoVersion: info.GoVersion,
+		},
+	}
+}
+
+func (ctrl *buildInfoController) Hander() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, ctrl.response)
+	}
+}
+
+func (ctrl *buildInfoController) Route() string {
+	return "/buildinfo"
+}
+
+func (ctrl *buildInfoController) Method() string {
+	return http.MethodGet
+}
+
+func (ctrl *buildInfoController) Doc() openapi.Operation {
+	return openapi.Operation{
+		Summary:  "Get the version of the running build",
+		Response: model.BuildInfoResponse{},
+	}
+}
+
+func (ctrl *buildInfoController) Auth() auth.Requirement {
+	return auth.Anonymous
+}
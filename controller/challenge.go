@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/misikdmitriy/password-sharing/auth"
+	"github.com/misikdmitriy/password-sharing/challenge"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/openapi"
+)
+
+const (
+	challengeTokenHeader = "X-Challenge-Token"
+	challengeNonceHeader = "X-Challenge-Nonce"
+)
+
+type challengeController struct {
+	challenges challenge.Issuer
+}
+
+func NewChallengeController(challenges challenge.Issuer) Controller {
+	return &challengeController{
+		challenges: challenges,
+	}
+}
+
+func (ctrl *challengeController) Hander() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		issued, err := ctrl.challenges.Issue()
+		if err != nil {
+			writeError(c, err)
+
+			return
+		}
+
+		c.JSON(http.StatusOK, model.ChallengeResponse{
+			Token:      issued.Token,
+			Algorithm:  challenge.Algorithm,
+			Difficulty: issued.Difficulty,
+			ExpiresAt:  issued.ExpiresAt,
+		})
+	}
+}
+
+func (ctrl *challengeController) Route() string {
+	return "/challenge"
+}
+
+func (ctrl *challengeController) Method() string {
+	return http.MethodGet
+}
+
+func (ctrl *challengeController) Doc() openapi.Operation {
+	return openapi.Operation{
+		Summary:  "Get a proof-of-work challenge for anonymous link creation",
+		Response: model.ChallengeResponse{},
+		Errors: []pserror.ErrorCodes{
+			pserror.RandomizerError,
+		},
+	}
+}
+
+func (ctrl *challengeController) Auth() auth.Requirement {
+	return auth.Anonymous
+}
+
+// verifyChallenge makes anonymous callers prove work before they create a
+// link, authenticated callers and disabled challenges pass.
+func verifyChallenge(c *gin.Context, challenges challenge.Issuer) error {
+	if challenges == nil || auth.PrincipalFrom(c.Request.Context()) != nil {
+		return nil
+	}
+
+	return challenges.Verify(c, c.GetHeader(challengeTokenHeader), c.GetHeader(challengeNonceHeader))
+}
@@ -1,58 +1,147 @@
 package controller
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 
+	"github.com/misikdmitriy/password-sharing/auth"
+	"github.com/misikdmitriy/password-sharing/challenge"
 	"github.com/misikdmitriy/password-sharing/config"
 	pserror "github.com/misikdmitriy/password-sharing/error"
 	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/openapi"
 	"github.com/misikdmitriy/password-sharing/service"
 )
 
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	jsonContentType          = "application/json; charset=utf-8"
+)
+
 type createLinkController struct {
-	service service.PasswordService
-	config  *config.Config
+	service     service.PasswordService
+	idempotency service.IdempotencyService
+	config      *config.Config
+	challenges  challenge.Issuer
 }
 
-func NewCreateLinkController(service service.PasswordService, config *config.Config) Controller {
+func NewCreateLinkController(service service.PasswordService, idempotency service.IdempotencyService, config *config.Config, challenges challenge.Issuer) Controller {
 	return &createLinkController{
-		service: service,
-		config:  config,
+		service:     service,
+		idempotency: idempotency,
+		config:      config,
+		challenges:  challenges,
 	}
 }
 
 func (ctrl *createLinkController) Hander() gin.HandlerFunc {
-	type Body struct {
-		Password string `json:"password"`
-	}
-
 	return func(c *gin.Context) {
-		body := &Body{}
-		err := c.BindJSON(body)
-		if err != nil {
-			c.JSON(pserror.BadRequestError())
+		body := &model.PasswordBody{}
+		// keeps the raw body for the idempotency request hash
+		err := c.ShouldBindBodyWith(body, binding.JSON)
+		if err != nil || body.ExpiresIn < 0 || body.Views < 0 {
+			writeError(c, pserror.BadRequestError())
+
+			return
+		}
+
+		// a retry is answered before the challenge, its solution was used up
+		// by the first attempt
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key != "" {
+			replayed, err := ctrl.idempotency.Begin(c, key, requestBody(c))
+			if err != nil {
+				writeError(c, err)
+
+				return
+			}
+
+			if replayed != nil {
+				c.Header(idempotentReplayedHeader, "true")
+				c.Data(replayed.Status, jsonContentType, replayed.Body)
+
+				return
+			}
+		}
+
+		if err = verifyChallenge(c, ctrl.challenges); err != nil {
+			ctrl.release(c, key)
+			writeError(c, err)
 
 			return
 		}
 
-		link, err := ctrl.service.CreateLinkFromPassword(c, body.Password)
+		created, err := ctrl.service.CreateLinkFromPassword(c, body.Password, service.LinkOptions{
+			Ttl:          time.Duration(body.ExpiresIn) * time.Second,
+			MaxViews:     body.Views,
+			Passphrase:   body.Passphrase,
+			Recipients:   body.Recipients,
+			AllowedCidrs: body.AllowedCidrs,
+		})
 		if err != nil {
-			psError := pserror.AsPasswordSharingError(err)
-			c.JSON(psError.ToResponse())
+			ctrl.release(c, key)
+			writeError(c, err)
 
 			return
 		}
 
 		url := fmt.Sprintf("%s/%s",
-			ctrl.config.App.BasePath,
-			link)
+			linkBase(c, ctrl.config.App.BasePath),
+			created.Link)
 
-		c.JSON(http.StatusCreated, model.LinkResponse{
-			Url: url,
-		})
+		response := model.LinkResponse{
+			Url:       url,
+			ExpiresAt: created.ExpiresAt,
+			Views:     created.MaxViews,
+			Strength:  toStrengthResponse(created.Strength),
+		}
+
+		if key != "" {
+			// the link exists, a failure to store the response only costs
+			// the retry its replay
+			if data, err := json.Marshal(response); err == nil {
+				ctrl.idempotency.Complete(c, key, service.IdempotentResponse{
+					Status: http.StatusCreated,
+					Body:   data,
+				})
+			}
+		}
+
+		c.JSON(http.StatusCreated, response)
+	}
+}
+
+// release lets a failed request be retried with the same key.
+func (ctrl *createLinkController) release(c *gin.Context, key string) {
+	if key != "" {
+		ctrl.idempotency.Release(c, key)
+	}
+}
+
+func requestBody(c *gin.Context) []byte {
+	raw, _ := c.Get(gin.BodyBytesKey)
+	data, _ := raw.([]byte)
+
+	return data
+}
+
+func toStrengthResponse(strength *service.PasswordStrength) *model.StrengthResponse {
+	if strength == nil {
+		return nil
+	}
+
+	return &model.StrengthResponse{
+		Score:        strength.Score,
+		GuessesLog10: strength.GuessesLog10,
+		Breached:     strength.BreachCount > 0,
+		BreachCount:  strength.BreachCount,
+		Warnings:     strength.Warnings,
 	}
 }
 
@@ -63,3 +152,37 @@ func (ctrl *createLinkController) Route() string {
 func (ctrl *createLinkController) Method() string {
 	return http.MethodPost
 }
+
+func (ctrl *createLinkController) Doc() openapi.Operation {
+	return openapi.Operation{
+		Summary:         "Share a password and get a link to it",
+		OptionalHeaders: []string{idempotencyKeyHeader, challengeTokenHeader, challengeNonceHeader},
+		Request:         model.PasswordBody{},
+		Status:          http.StatusCreated,
+		Response:        model.LinkResponse{},
+		Errors: []pserror.ErrorCodes{
+			pserror.BadRequest,
+			pserror.InvalidIdempotencyKey,
+			pserror.IdempotencyKeyReused,
+			pserror.IdempotencyKeyInProgress,
+			pserror.InvalidChallenge,
+			pserror.ChallengeRequired,
+			pserror.PassphraseRequired,
+			pserror.InvalidRecipient,
+			pserror.InvalidAllowlist,
+			pserror.SecretTooLarge,
+			pserror.WeakPassword,
+			pserror.BreachedPassword,
+			pserror.InitDbError,
+			pserror.RandomizerError,
+			pserror.DbCommandError,
+			pserror.EncodeError,
+			pserror.BreachCheckError,
+			pserror.KeyProviderError,
+		},
+	}
+}
+
+func (ctrl *createLinkController) Auth() auth.Requirement {
+	return auth.Require(auth.ScopeCreate)
+}
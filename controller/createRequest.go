@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/misikdmitriy/password-sharing/auth"
+	"github.com/misikdmitriy/password-sharing/config"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/openapi"
+	"github.com/misikdmitriy/password-sharing/service"
+)
+
+type createRequestController struct {
+	service service.SecretRequestService
+	config  *config.Config
+}
+
+func NewCreateRequestController(service service.SecretRequestService, config *config.Config) Controller {
+	return &createRequestController{
+		service: service,
+		config:  config,
+	}
+}
+
+func (ctrl *createRequestController) Hander() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := &model.SecretRequestBody{}
+		err := c.ShouldBindJSON(body)
+		if err != nil || body.ExpiresIn < 0 {
+			writeError(c, pserror.BadRequestError())
+
+			return
+		}
+
+		request, token, err := ctrl.service.CreateSecretRequest(c, body.Description, time.Duration(body.ExpiresIn)*time.Second)
+		if err != nil {
+			writeError(c, err)
+
+			return
+		}
+
+		url := fmt.Sprintf("%s/%s",
+			requestBase(c, ctrl.config.Request.BasePath),
+			request.Link)
+
+		c.JSON(http.StatusCreated, model.SecretRequestResponse{
+			Url:       url,
+			Token:     token,
+			ExpiresAt: request.ExpiresAt,
+		})
+	}
+}
+
+func (ctrl *createRequestController) Route() string {
+	return "/request"
+}
+
+func (ctrl *createRequestController) Method() string {
+	return http.MethodPost
+}
+
+func (ctrl *createRequestController) Doc() openapi.Operation {
+	return openapi.Operation{
+		Summary:  "Create a secret request",
+		Request:  model.SecretRequestBody{},
+		Status:   http.StatusCreated,
+		Response: model.SecretRequestResponse{},
+		Errors: []pserror.ErrorCodes{
+			pserror.BadRequest,
+			pserror.InitDbError,
+			pserror.RandomizerError,
+			pserror.DbCommandError,
+		},
+	}
+}
+
+func (ctrl *createRequestController) Auth() auth.Requirement {
+	return auth.Require(auth.ScopeCreate)
+}
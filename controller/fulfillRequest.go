@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/misikdmitriy/password-sharing/auth"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/openapi"
+	"github.com/misikdmitriy/password-sharing/service"
+)
+
+type fulfillRequestController struct {
+	service service.SecretRequestService
+}
+
+func NewFulfillRequestController(service service.SecretRequestService) Controller {
+	return &fulfillRequestController{
+		service: service,
+	}
+}
+
+func (ctrl *fulfillRequestController) Hander() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		link := c.Param("link")
+		body := &model.PasswordBody{}
+		err := c.ShouldBindJSON(body)
+		if err != nil || link == "" {
+			writeError(c, pserror.BadRequestError())
+
+			return
+		}
+
+		err = ctrl.service.FulfillSecretRequest(c, link, body.Password)
+		if err != nil {
+			writeError(c, err)
+
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func (ctrl *fulfillRequestController) Route() string {
+	return "/request/:link"
+}
+
+func (ctrl *fulfillRequestController) Method() string {
+	return http.MethodPost
+}
+
+func (ctrl *fulfillRequestController) Doc() openapi.Operation {
+	return openapi.Operation{
+		Summary: "Submit a secret for a secret request",
+		Request: model.PasswordBody{},
+		Status:  http.StatusNoContent,
+		Errors: []pserror.ErrorCodes{
+			pserror.BadRequest,
+			pserror.SecretRequestNotFound,
+			pserror.SecretRequestFulfilled,
+			pserror.SecretRequestExpired,
+			pserror.WeakPassword,
+			pserror.BreachedPassword,
+			pserror.InitDbError,
+			pserror.RandomizerError,
+			pserror.DbQueryError,
+			pserror.DbCommandError,
+			pserror.EncodeError,
+			pserror.BreachCheckError,
+		},
+	}
+}
+
+func (ctrl *fulfillRequestController) Auth() auth.Requirement {
+	return auth.Anonymous
+}
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/misikdmitriy/password-sharing/auth"
+	"github.com/misikdmitriy/password-sharing/challenge"
+	"github.com/misikdmitriy/password-sharing/config"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/helper"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/openapi"
+	"github.com/misikdmitriy/password-sharing/service"
+)
+
+type generateController struct {
+	generatorService service.GeneratorService
+	passwordService  service.PasswordService
+	config           *config.Config
+	challenges       challenge.Issuer
+}
+
+func NewGenerateController(generatorService service.GeneratorService, passwordService service.PasswordService, config *config.Config, challenges challenge.Issuer) Controller {
+	return &generateController{
+		generatorService: generatorService,
+		passwordService:  passwordService,
+		config:           config,
+		challenges:       challenges,
+	}
+}
+
+func (ctrl *generateController) Hander() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := &model.GenerateBody{}
+		err := c.ShouldBindJSON(body)
+		if err != nil {
+			writeError(c, pserror.BadRequestError())
+
+			return
+		}
+
+		// shared passwords are links like any other
+		if body.Share {
+			if err = checkSharedCount(c, body.Count); err != nil {
+				writeError(c, err)
+
+				return
+			}
+
+			if err = verifyChallenge(c, ctrl.challenges); err != nil {
+				writeError(c, err)
+
+				return
+			}
+		}
+
+		generated, err := ctrl.generatorService.Generate(c, helper.GeneratorPolicy{
+			Mode:             helper.GeneratorMode(body.Mode),
+			Length:           body.Length,
+			Lower:            body.Lower,
+			Upper:            body.Upper,
+			Digits:           body.Digits,
+			Symbols:          body.Symbols,
+			ExcludeAmbiguous: body.ExcludeAmbiguous,
+			Words:            body.Words,
+			Separator:        body.Separator,
+		}, body.Count)
+		if err != nil {
+			writeError(c, err)
+
+			return
+		}
+
+		response := model.GenerateResponse{
+			Passwords: make([]model.GeneratedPasswordResponse, len(generated)),
+		}
+
+		var links []string
+		for i, g := range generated {
+			response.Passwords[i] = model.GeneratedPasswordResponse{
+				Password: g.Password,
+				Entropy:  math.Round(g.Entropy*100) / 100,
+			}
+
+			if !body.Share {
+				continue
+			}
+
+			created, err := ctrl.passwordService.CreateLinkFromPassword(c, g.Password, service.LinkOptions{})
+			if err != nil {
+				// the response is all or nothing, links nobody will see are
+				// taken back
+				for _, link := range links {
+					_ = ctrl.passwordService.DeleteLink(c, link)
+				}
+
+				writeError(c, err)
+
+				return
+			}
+
+			links = append(links, created.Link)
+			response.Passwords[i].Url = fmt.Sprintf("%s/%s",
+				linkBase(c, ctrl.config.App.BasePath),
+				created.Link)
+		}
+
+		status := http.StatusOK
+		if body.Share {
+			status = http.StatusCreated
+		}
+
+		c.JSON(status, response)
+	}
+}
+
+// checkSharedCount limits the links a request may create, a challenge is
+// worth a single link.
+func checkSharedCount(c *gin.Context, count int) error {
+	max := service.MaxSharedPasswords
+	if auth.PrincipalFrom(c.Request.Context()) == nil {
+		max = 1
+	}
+
+	if count > max {
+		return &pserror.PasswordSharingError{
+			Code:    pserror.InvalidGeneratorPolicy,
+			Message: fmt.Sprintf("at most %d passwords may be shared at once", max),
+		}
+	}
+
+	return nil
+}
+
+func (ctrl *generateController) Route() string {
+	return "/generate"
+}
+
+func (ctrl *generateController) Method() string {
+	return http.MethodPost
+}
+
+func (ctrl *generateController) Doc() openapi.Operation {
+	return openapi.Operation{
+		Summary:         "Generate passwords and optionally share them",
+		OptionalHeaders: []string{challengeTokenHeader, challengeNonceHeader},
+		Request:         model.GenerateBody{},
+		Response:        model.GenerateResponse{},
+		Errors: []pserror.ErrorCodes{
+			pserror.BadRequest,
+			pserror.InvalidChallenge,
+			pserror.ChallengeRequired,
+			pserror.InvalidGeneratorPolicy,
+			pserror.RandomizerError,
+			pserror.InitDbError,
+			pserror.DbCommandError,
+			pserror.EncodeError,
+		},
+	}
+}
+
+func (ctrl *generateController) Auth() auth.Requirement {
+	return auth.Require(auth.ScopeCreate)
+}
@@ -5,11 +5,19 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/misikdmitriy/password-sharing/auth"
 	pserror "github.com/misikdmitriy/password-sharing/error"
 	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/openapi"
 	"github.com/misikdmitriy/password-sharing/service"
 )
 
+const (
+	passphraseHeader     = "X-Passphrase"
+	recipientEmailHeader = "X-Recipient-Email"
+	oneTimeCodeHeader    = "X-One-Time-Code"
+)
+
 type getLinkController struct {
 	service service.PasswordService
 }
@@ -24,15 +32,19 @@ func (ctrl *getLinkController) Hander() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		link := c.Param("link")
 		if link == "" {
-			c.JSON(pserror.BadRequestError())
+			writeError(c, pserror.BadRequestError())
 
 			return
 		}
 
-		password, err := ctrl.service.GetPasswordFromLink(c, link)
+		password, err := ctrl.service.GetPasswordFromLink(c, link, service.RevealOptions{
+			Passphrase: c.GetHeader(passphraseHeader),
+			Email:      c.GetHeader(recipientEmailHeader),
+			Code:       c.GetHeader(oneTimeCodeHeader),
+			ClientIp:   c.ClientIP(),
+		})
 		if err != nil {
-			psError := pserror.AsPasswordSharingError(err)
-			c.JSON(psError.ToResponse())
+			writeError(c, err)
 
 			return
 		}
@@ -50,3 +62,33 @@ func (ctrl *getLinkController) Route() string {
 func (ctrl *getLinkController) Method() string {
 	return http.MethodGet
 }
+
+func (ctrl *getLinkController) Doc() openapi.Operation {
+	return openapi.Operation{
+		Summary:         "Get a shared password",
+		OptionalHeaders: []string{passphraseHeader, recipientEmailHeader, oneTimeCodeHeader},
+		Response:        model.PasswordResponse{},
+		Errors: []pserror.ErrorCodes{
+			pserror.BadRequest,
+			pserror.AddressNotAllowed,
+			pserror.PassphraseRequired,
+			pserror.InvalidPassphrase,
+			pserror.VerificationRequired,
+			pserror.InvalidOneTimeCode,
+			pserror.OneTimeCodeExpired,
+			pserror.TooManyAttempts,
+			pserror.PasswordNotFound,
+			pserror.PasswordExpired,
+			pserror.InitDbError,
+			pserror.DbQueryError,
+			pserror.DbCommandError,
+			pserror.DecodeError,
+			pserror.KeyProviderError,
+			pserror.NotificationError,
+		},
+	}
+}
+
+func (ctrl *getLinkController) Auth() auth.Requirement {
+	return auth.Anonymous
+}
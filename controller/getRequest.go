@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/misikdmitriy/password-sharing/auth"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/openapi"
+	"github.com/misikdmitriy/password-sharing/service"
+)
+
+type getRequestController struct {
+	service service.SecretRequestService
+}
+
+func NewGetRequestController(service service.SecretRequestService) Controller {
+	return &getRequestController{
+		service: service,
+	}
+}
+
+func (ctrl *getRequestController) Hander() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		link := c.Param("link")
+		if link == "" {
+			writeError(c, pserror.BadRequestError())
+
+			return
+		}
+
+		request, err := ctrl.service.GetSecretRequest(c, link)
+		if err != nil {
+			writeError(c, err)
+
+			return
+		}
+
+		c.JSON(http.StatusOK, model.SecretRequestInfoResponse{
+			Description: request.Description,
+			ExpiresAt:   request.ExpiresAt,
+			Fulfilled:   request.Fulfilled(),
+		})
+	}
+}
+
+func (ctrl *getRequestController) Route() string {
+	return "/request/:link"
+}
+
+func (ctrl *getRequestController) Method() string {
+	return http.MethodGet
+}
+
+func (ctrl *getRequestController) Doc() openapi.Operation {
+	return openapi.Operation{
+		Summary:  "Get a secret request description",
+		Response: model.SecretRequestInfoResponse{},
+		Errors: []pserror.ErrorCodes{
+			pserror.BadRequest,
+			pserror.SecretRequestNotFound,
+			pserror.InitDbError,
+			pserror.DbQueryError,
+		},
+	}
+}
+
+func (ctrl *getRequestController) Auth() auth.Requirement {
+	return auth.Anonymous
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/misikdmitriy/password-sharing/auth"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/openapi"
+	"github.com/misikdmitriy/password-sharing/service"
+)
+
+const requestTokenHeader = "X-Request-Token"
+
+type getRequestSecretController struct {
+	service service.SecretRequestService
+}
+
+func NewGetRequestSecretController(service service.SecretRequestService) Controller {
+	return &getRequestSecretController{
+		service: service,
+	}
+}
+
+func (ctrl *getRequestSecretController) Hander() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		link := c.Param("link")
+		token := c.GetHeader(requestTokenHeader)
+		if link == "" || token == "" {
+			writeError(c, pserror.BadRequestError())
+
+			return
+		}
+
+		password, err := ctrl.service.GetSecretFromRequest(c, link, token, c.ClientIP())
+		if err != nil {
+			writeError(c, err)
+
+			return
+		}
+
+		c.JSON(http.StatusOK, model.PasswordResponse{
+			Password: password,
+		})
+	}
+}
+
+func (ctrl *getRequestSecretController) Route() string {
+	return "/request/:link/secret"
+}
+
+func (ctrl *getRequestSecretController) Method() string {
+	return http.MethodGet
+}
+
+func (ctrl *getRequestSecretController) Doc() openapi.Operation {
+	return openapi.Operation{
+		Summary:  "Get the secret submitted for a secret request",
+		Headers:  []string{requestTokenHeader},
+		Response: model.PasswordResponse{},
+		Errors: []pserror.ErrorCodes{
+			pserror.BadRequest,
+			pserror.InvalidRequestToken,
+			pserror.SecretRequestNotFound,
+			pserror.PasswordNotFound,
+			pserror.SecretRequestPending,
+			pserror.AddressNotAllowed,
+			pserror.InitDbError,
+			pserror.DbQueryError,
+			pserror.DecodeError,
+		},
+	}
+}
+
+func (ctrl *getRequestSecretController) Auth() auth.Requirement {
+	return auth.Anonymous
+}
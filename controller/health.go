@@ -1,55 +1,88 @@
 package controller
 
 import (
-	"fmt"
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/misikdmitriy/password-sharing/auth"
 	"github.com/misikdmitriy/password-sharing/health"
 	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/openapi"
 )
 
 type healthController struct {
-	healthChecks []health.HealthCheck
+	route string
+	probe health.Probe
+	// detailed lists the checks, which is only meant for operators
+	detailed bool
 }
 
-func NewHealthController(healthChecks ...health.HealthCheck) Controller {
+// NewHealthController serves probe on route, e.g. /health/live. Degraded
+// probes, where only non-critical checks fail, still answer 200.
+func NewHealthController(route string, probe health.Probe) Controller {
 	return &healthController{
-		healthChecks: healthChecks,
+		route:    route,
+		probe:    probe,
+		detailed: true,
+	}
+}
+
+// NewPublicHealthController serves probe like NewHealthController but
+// answers with the status only, the checks stay on the admin port.
+func NewPublicHealthController(route string, probe health.Probe) Controller {
+	return &healthController{
+		route: route,
+		probe: probe,
 	}
 }
 
 func (ctrl *healthController) Hander() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		totallyHealthy := true
-		reason := ""
-
-		for _, hc := range ctrl.healthChecks {
-			healthy, err := hc.Check(c)
-			if !healthy {
-				totallyHealthy = false
-				reason += fmt.Sprintf("%v\n", err)
-			}
-		}
+		report := ctrl.probe.Report()
 
 		response := model.HealthResponse{
-			Healthy: totallyHealthy,
-			Reason:  strings.TrimRight(reason, "\n"),
+			Healthy:   report.Healthy(),
+			Status:    string(report.Status),
+			CheckedAt: report.CheckedAt,
+		}
+
+		if ctrl.detailed {
+			response.Checks = make([]model.HealthCheckResponse, 0, len(report.Results))
+			for _, result := range report.Results {
+				response.Checks = append(response.Checks, model.HealthCheckResponse{
+					Name:      result.Name,
+					Status:    string(result.Status),
+					Critical:  result.Critical,
+					LatencyMs: float64(result.Latency.Microseconds()) / 1000,
+					Details:   result.Details,
+					Error:     result.Error,
+				})
+			}
 		}
 
-		if !totallyHealthy {
-			c.JSON(500, response)
+		if !report.Healthy() {
+			c.JSON(http.StatusServiceUnavailable, response)
 		} else {
-			c.JSON(200, response)
+			c.JSON(http.StatusOK, response)
 		}
 	}
 }
 
 func (c *healthController) Route() string {
-	return "/health"
+	return c.route
 }
 
 func (c *healthController) Method() string {
 	return http.MethodGet
 }
+
+func (c *healthController) Doc() openapi.Operation {
+	return openapi.Operation{
+		Summary:  "Check service health",
+		Response: model.HealthResponse{},
+	}
+}
+
+func (c *healthController) Auth() auth.Requirement {
+	return auth.Anonymous
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/misikdmitriy/password-sharing/auth"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/openapi"
+	"github.com/misikdmitriy/password-sharing/service"
+)
+
+type linkStatusController struct {
+	service service.PasswordService
+}
+
+func NewLinkStatusController(service service.PasswordService) Controller {
+	return &linkStatusController{
+		service: service,
+	}
+}
+
+func (ctrl *linkStatusController) Hander() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		link := c.Param("link")
+		if link == "" {
+			writeError(c, pserror.BadRequestError())
+
+			return
+		}
+
+		exists, err := ctrl.service.LinkExists(c, link)
+		if err != nil {
+			writeError(c, err)
+
+			return
+		}
+
+		c.JSON(http.StatusOK, model.LinkStatusResponse{
+			Exists: exists,
+		})
+	}
+}
+
+func (ctrl *linkStatusController) Route() string {
+	return "/link/:link/status"
+}
+
+func (ctrl *linkStatusController) Method() string {
+	return http.MethodGet
+}
+
+func (ctrl *linkStatusController) Doc() openapi.Operation {
+	return openapi.Operation{
+		Summary:  "Check whether a link still exists",
+		Response: model.LinkStatusResponse{},
+		Errors: []pserror.ErrorCodes{
+			pserror.BadRequest,
+			pserror.InitDbError,
+			pserror.DbQueryError,
+		},
+	}
+}
+
+func (ctrl *linkStatusController) Auth() auth.Requirement {
+	return auth.Require(auth.ScopeStatus)
+}
@@ -2,7 +2,10 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
+	"strings"
 
 	"github.com/misikdmitriy/password-sharing/config"
 	"github.com/misikdmitriy/password-sharing/logger"
@@ -83,8 +86,13 @@ func (f *dbFactory) createConnection(appLogger *zap.Logger) (*gorm.Dialector, er
 
 	switch f.c.Database.Provider {
 	case "pg":
+		dsn, err := withPassword(f.c.Database.ConnectionString, f.c.Database.Password)
+		if err != nil {
+			return nil, err
+		}
+
 		conn := postgres.New(postgres.Config{
-			DSN: f.c.Database.ConnectionString,
+			DSN: dsn,
 		})
 		return &conn, nil
 	case "sqlite":
@@ -94,3 +102,25 @@ func (f *dbFactory) createConnection(appLogger *zap.Logger) (*gorm.Dialector, er
 		return nil, fmt.Errorf("cannot create %s connection", f.c.Database.Provider)
 	}
 }
+
+// withPassword adds password to a pg connection string, either a URL or
+// key=value pairs.
+func withPassword(dsn string, password string) (string, error) {
+	if password == "" {
+		return dsn, nil
+	}
+
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			// the error of url quotes the connection string
+			return "", errors.New("invalid connection string")
+		}
+
+		u.User = url.UserPassword(u.User.Username(), password)
+		return u.String(), nil
+	}
+
+	quoted := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(password)
+	return fmt.Sprintf("%s password='%s'", dsn, quoted), nil
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/helper"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/model"
+)
+
+func TestWithPasswordShouldAddPasswordToConnectionString(t *testing.T) {
+	cases := []struct {
+		dsn      string
+		password string
+		expected string
+	}{
+		{"host=db user=postgres", "", "host=db user=postgres"},
+		{"host=db user=postgres", `it's\secret`, `host=db user=postgres password='it\'s\\secret'`},
+		{"postgres://postgres@db:5432/passwords?sslmode=disable", "p@ss word", "postgres://postgres:p%40ss%20word@db:5432/passwords?sslmode=disable"},
+	}
+
+	for _, tc := range cases {
+		actual, err := withPassword(tc.dsn, tc.password)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if actual != tc.expected {
+			t.Errorf("expected %s but was %s", tc.expected, actual)
+		}
+	}
+}
+
+func TestMigrateShouldBackfillLinkHashes(t *testing.T) {
+	c := &config.Config{}
+	c.Database.Provider = "sqlite"
+	c.Database.ConnectionString = "file:backfill?mode=memory&cache=shared"
+
+	f := NewFactory(c, logger.NewTestLoggerFactory())
+	db, close, err := f.InitDB(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close()
+
+	if err = db.AutoMigrate(Models()...); err != nil {
+		t.Fatal(err)
+	}
+
+	links := []string{"link-1", "link-2", "link-3"}
+	for _, link := range links {
+		if err = db.Create(&model.Password{Link: link}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	linkHasher := helper.NewLinkHasher("master")
+	if err = Migrate(context.Background(), f, "default", linkHasher); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []model.Password{}
+	if err = db.Order("id").Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != len(links) {
+		t.Fatalf("expected %d passwords but was %d", len(links), len(rows))
+	}
+
+	for i, r := range rows {
+		if r.LinkHash != linkHasher.Hash(links[i]) || r.TenantId != "default" {
+			t.Errorf("expected %s of default tenant to be hashed but was %+v", links[i], r)
+		}
+	}
+}
+
+// legacyVerification is the verification table before recipients were unique.
+type legacyVerification struct {
+	Id         int64  `gorm:"primaryKey;autoIncrement;column:id"`
+	PasswordId int64  `gorm:"column:password_id;index"`
+	Email      string `gorm:"column:email"`
+	Attempts   int    `gorm:"column:attempts"`
+}
+
+func (legacyVerification) TableName() string {
+	return "tbl_verifications"
+}
+
+func TestMigrateShouldMakeRecipientsUnique(t *testing.T) {
+	c := &config.Config{}
+	c.Database.Provider = "sqlite"
+	c.Database.ConnectionString = "file:verifications?mode=memory&cache=shared"
+
+	f := NewFactory(c, logger.NewTestLoggerFactory())
+	db, close, err := f.InitDB(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer close()
+
+	if err = db.AutoMigrate(&legacyVerification{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []legacyVerification{
+		{PasswordId: 1, Email: "alice@example.com", Attempts: 3},
+		{PasswordId: 1, Email: "alice@example.com"},
+		{PasswordId: 1, Email: "bob@example.com"},
+	} {
+		if err = db.Create(&v).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = Migrate(context.Background(), f, "default", helper.NewLinkHasher("master")); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []model.Verification{}
+	if err = db.Order("id").Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 || rows[0].Email != "alice@example.com" || rows[0].Attempts != 3 || rows[1].Email != "bob@example.com" {
+		t.Fatalf("expected the oldest row of every recipient to be kept but was %+v", rows)
+	}
+
+	err = db.Create(&model.Verification{PasswordId: 1, Email: "bob@example.com"}).Error
+	if err == nil || !IsUniqueViolation(err) {
+		t.Errorf("expected a second row of a recipient to violate the unique index but was %v", err)
+	}
+}
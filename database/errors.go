@@ -0,0 +1,22 @@
+package database
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgconn"
+)
+
+const pgUniqueViolationCode = "23505"
+
+// IsUniqueViolation reports whether err was caused by a unique constraint of
+// either provider.
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgUniqueViolationCode
+	}
+
+	// sqlite
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
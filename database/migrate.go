@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+
+	"github.com/misikdmitriy/password-sharing/helper"
+	"github.com/misikdmitriy/password-sharing/model"
+	"gorm.io/gorm"
+)
+
+const backfillBatchSize = 500
+
+func Models() []interface{} {
+	return []interface{}{
+		&model.Password{},
+		&model.SecretRequest{},
+		&model.ApiKey{},
+		&model.Verification{},
+		&model.AuditEvent{},
+		&model.RateLimit{},
+		&model.IdempotencyKey{},
+		&model.UsedChallenge{},
+	}
+}
+
+// tenantModels are the models with a tenant_id column.
+func tenantModels() []interface{} {
+	return []interface{}{
+		&model.Password{},
+		&model.SecretRequest{},
+		&model.ApiKey{},
+	}
+}
+
+// Migrate updates the schema, assigns rows created before tenants existed
+// to defaultTenant and fills in link hashes of older passwords.
+func Migrate(c context.Context, f DbFactory, defaultTenant string, linkHasher helper.Hasher) error {
+	db, close, err := f.InitDB(c)
+	if err != nil {
+		return err
+	}
+	defer close()
+
+	if err = dropDuplicateVerifications(db); err != nil {
+		return err
+	}
+
+	if err = db.AutoMigrate(Models()...); err != nil {
+		return err
+	}
+
+	for _, m := range tenantModels() {
+		err = db.Model(m).Where("tenant_id = ? OR tenant_id IS NULL", "").Update("tenant_id", defaultTenant).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return backfillLinkHashes(db, linkHasher)
+}
+
+// dropDuplicateVerifications keeps the oldest code of every recipient, which
+// is the one that counted the attempts, so the unique index can be created.
+func dropDuplicateVerifications(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&model.Verification{}) {
+		return nil
+	}
+
+	oldest := db.Model(&model.Verification{}).Select("MIN(id)").Group("password_id, email")
+	return db.Where("id NOT IN (?)", oldest).Delete(&model.Verification{}).Error
+}
+
+func backfillLinkHashes(db *gorm.DB, linkHasher helper.Hasher) error {
+	rows := []model.Password{}
+
+	return db.Select("id", "link").
+		Where("link_hash = ? OR link_hash IS NULL", "").
+		FindInBatches(&rows, backfillBatchSize, func(_ *gorm.DB, _ int) error {
+			// every batch is written in its own transaction
+			return db.Transaction(func(tx *gorm.DB) error {
+				for _, r := range rows {
+					err := tx.Model(&model.Password{}).Where("id = ?", r.Id).Update("link_hash", linkHasher.Hash(r.Link)).Error
+					if err != nil {
+						return err
+					}
+				}
+
+				return nil
+			})
+		}).Error
+}
@@ -0,0 +1,265 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/health"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	CheckHttp = "http"
+	CheckTtl  = "ttl"
+)
+
+const healthCheck = "healthcheck"
+
+const (
+	defaultCheckInterval = 15 * time.Second
+	checkTimeout         = 5 * time.Second
+	// registration attempts wait twice as long as the previous one
+	minRegisterBackoff = 500 * time.Millisecond
+	maxRegisterBackoff = 30 * time.Second
+)
+
+type consulRegistrar struct {
+	agent           *api.Agent
+	instance        Instance
+	checkId         string
+	check           string
+	scheme          string
+	tlsSkipVerify   bool
+	interval        time.Duration
+	deregisterAfter time.Duration
+	checks          []health.HealthCheck
+	loggerFactory   logger.LoggerFactory
+	minBackoff      time.Duration
+	maxBackoff      time.Duration
+
+	mu sync.Mutex
+	// stop ends the heartbeat of a ttl check, done is closed once it ended
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewConsulRegistrar returns a registrar for the Consul agent at
+// app.consuladdress. With a ttl check the instance reports the result of
+// checks to the agent itself instead of being polled.
+func NewConsulRegistrar(conf *config.Config, loggerFactory logger.LoggerFactory, checks ...health.HealthCheck) (Registrar, error) {
+	check := conf.Discovery.Consul.Check
+	switch check {
+	case CheckHttp, CheckTtl:
+	case "":
+		check = CheckHttp
+	default:
+		return nil, fmt.Errorf("unknown consul check %s", check)
+	}
+
+	client, err := api.NewClient(&api.Config{
+		Address: conf.App.ConsulAddress,
+		Scheme:  "http",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "http"
+	if conf.Tls.Enabled {
+		scheme = "https"
+	}
+
+	interval := conf.Discovery.Consul.Interval
+	if interval <= 0 {
+		interval = defaultCheckInterval
+	}
+
+	return &consulRegistrar{
+		agent:           client.Agent(),
+		instance:        instanceOf(conf),
+		checkId:         fmt.Sprintf("%s-%d", healthCheck, conf.App.ServiceId),
+		check:           check,
+		scheme:          scheme,
+		tlsSkipVerify:   conf.Discovery.Consul.TlsSkipVerify,
+		interval:        interval,
+		deregisterAfter: conf.Discovery.Consul.DeregisterAfter,
+		checks:          checks,
+		loggerFactory:   loggerFactory,
+		minBackoff:      minRegisterBackoff,
+		maxBackoff:      maxRegisterBackoff,
+	}, nil
+}
+
+func (r *consulRegistrar) Register(ctx context.Context) error {
+	appLogger, loggerClose, err := r.loggerFactory.NewLogger()
+	if err != nil {
+		return err
+	}
+	defer loggerClose()
+
+	backoff := r.minBackoff
+	for attempt := 1; ; attempt++ {
+		if err = r.register(ctx); err == nil {
+			break
+		}
+
+		appLogger.Warn("failed to register in consul",
+			zap.Error(err),
+			zap.Int("attempt", attempt),
+			zap.Duration("retryIn", backoff),
+		)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("consul registration: %w", err)
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > r.maxBackoff {
+			backoff = r.maxBackoff
+		}
+	}
+
+	appLogger.Info("registered in consul",
+		zap.String("id", r.instance.Id),
+		zap.String("check", r.check),
+	)
+
+	if r.check == CheckTtl {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		// a ttl check starts critical, report right away
+		r.heartbeat(ctx)
+
+		r.stop = make(chan struct{})
+		r.done = make(chan struct{})
+		go r.heartbeats(r.stop, r.done)
+	}
+
+	return nil
+}
+
+func (r *consulRegistrar) Deregister(ctx context.Context) error {
+	r.mu.Lock()
+	if r.stop != nil {
+		close(r.stop)
+		<-r.done
+		r.stop = nil
+	}
+	r.mu.Unlock()
+
+	return r.agent.ServiceDeregisterOpts(r.instance.Id, (&api.QueryOptions{}).WithContext(ctx))
+}
+
+func (r *consulRegistrar) register(ctx context.Context) error {
+	check := &api.AgentServiceCheck{
+		CheckID: r.checkId,
+		Name:    healthCheck,
+	}
+
+	if r.check == CheckTtl {
+		check.TTL = r.interval.String()
+	} else {
+		check.HTTP = fmt.Sprintf("%s://%s:%d%s", r.scheme, r.instance.Address, r.instance.Port, healthPath)
+		check.TLSSkipVerify = r.tlsSkipVerify
+		check.Method = http.MethodGet
+		check.Interval = r.interval.String()
+		check.Timeout = checkTimeout.String()
+	}
+
+	if r.deregisterAfter > 0 {
+		check.DeregisterCriticalServiceAfter = r.deregisterAfter.String()
+	}
+
+	registration := &api.AgentServiceRegistration{
+		ID:      r.instance.Id,
+		Name:    r.instance.Name,
+		Port:    r.instance.Port,
+		Address: r.instance.Address,
+		Tags:    r.instance.Tags,
+		Meta:    r.instance.Meta,
+		Checks:  []*api.AgentServiceCheck{check},
+	}
+
+	// replacing the checks lets an instance switch between http and ttl
+	opts := api.ServiceRegisterOpts{ReplaceExistingChecks: true}.WithContext(ctx)
+
+	return r.agent.ServiceRegisterOpts(registration, opts)
+}
+
+// heartbeats reports the health a few times per ttl, so a single lost
+// update does not fail the check.
+func (r *consulRegistrar) heartbeats(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(r.interval / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			r.heartbeat(ctx)
+		}
+	}
+}
+
+func (r *consulRegistrar) heartbeat(ctx context.Context) {
+	appLogger, loggerClose, err := r.loggerFactory.NewLogger()
+	if err != nil {
+		return
+	}
+	defer loggerClose()
+
+	status, output := api.HealthPassing, "ok"
+	for _, check := range r.checks {
+		checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+		ok, err := check.Check(checkCtx)
+		cancel()
+
+		if !ok {
+			status, output = api.HealthCritical, "unhealthy"
+			if err != nil {
+				output = err.Error()
+			}
+
+			break
+		}
+	}
+
+	err = r.agent.UpdateTTLOpts(r.checkId, output, status, (&api.QueryOptions{}).WithContext(ctx))
+	if err == nil || ctx.Err() != nil {
+		return
+	}
+
+	appLogger.Warn("failed to report health to consul",
+		zap.Error(err),
+	)
+
+	// an agent that restarted without its data forgot the instance
+	if err = r.register(ctx); err != nil {
+		appLogger.Warn("failed to register in consul again",
+			zap.Error(err),
+		)
+	}
+}
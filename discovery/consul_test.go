@@ -0,0 +1,247 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/health"
+	"github.com/misikdmitriy/password-sharing/logger"
+)
+
+// fakeAgent answers the agent endpoints the registrar uses.
+type fakeAgent struct {
+	mu sync.Mutex
+	// unavailable is the number of registrations to fail
+	unavailable   int
+	registrations []api.AgentServiceRegistration
+	updates       []string
+	deregistered  []string
+}
+
+func (a *fakeAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPut && r.URL.Path == "/v1/agent/service/register":
+		if a.unavailable > 0 {
+			a.unavailable--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var registration api.AgentServiceRegistration
+		if err := json.NewDecoder(r.Body).Decode(&registration); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		a.registrations = append(a.registrations, registration)
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v1/agent/check/update/"):
+		var update struct{ Status, Output string }
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		a.updates = append(a.updates, strings.TrimPrefix(r.URL.Path, "/v1/agent/check/update/")+" "+update.Status)
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+		a.deregistered = append(a.deregistered, strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (a *fakeAgent) lastUpdate() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.updates) == 0 {
+		return ""
+	}
+
+	return a.updates[len(a.updates)-1]
+}
+
+func (a *fakeAgent) updateCount() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return len(a.updates)
+}
+
+type switchCheck struct {
+	healthy atomic.Bool
+}
+
+func (c *switchCheck) Check(context.Context) (bool, error) {
+	if c.healthy.Load() {
+		return true, nil
+	}
+
+	return false, errors.New("database is down")
+}
+
+func newTestRegistrar(t *testing.T, agent *fakeAgent, configure func(c *config.Config), checks ...*switchCheck) *consulRegistrar {
+	server := httptest.NewServer(agent)
+	t.Cleanup(server.Close)
+
+	c := &config.Config{}
+	c.App.ConsulAddress = strings.TrimPrefix(server.URL, "http://")
+	c.App.Address = "app1"
+	c.App.Port = 81
+	c.App.ServiceId = 1
+	c.Discovery.Tags = []string{"api", "blue"}
+	c.Discovery.Region = "eu-central"
+	c.Discovery.Consul.Interval = 30 * time.Millisecond
+	c.Discovery.Consul.DeregisterAfter = time.Minute
+	configure(c)
+
+	var healthChecks []health.HealthCheck
+	for _, check := range checks {
+		healthChecks = append(healthChecks, check)
+	}
+
+	r, err := NewConsulRegistrar(c, logger.NewTestLoggerFactory(), healthChecks...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registrar := r.(*consulRegistrar)
+	registrar.minBackoff = time.Millisecond
+	registrar.maxBackoff = 5 * time.Millisecond
+
+	return registrar
+}
+
+func TestConsulShouldRetryUntilAgentIsUp(t *testing.T) {
+	agent := &fakeAgent{unavailable: 3}
+	r := newTestRegistrar(t, agent, func(*config.Config) {})
+
+	if err := r.Register(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(agent.registrations) != 1 {
+		t.Fatalf("expected a registration but was %d", len(agent.registrations))
+	}
+
+	registration := agent.registrations[0]
+	if registration.ID != "passwordsharing-1" || registration.Address != "app1" || registration.Port != 81 {
+		t.Errorf("unexpected registration %+v", registration)
+	}
+
+	if strings.Join(registration.Tags, ",") != "api,blue" {
+		t.Errorf("expected tags api,blue but was %v", registration.Tags)
+	}
+
+	if registration.Meta["version"] != "dev" || registration.Meta["region"] != "eu-central" {
+		t.Errorf("expected version and region metadata but was %v", registration.Meta)
+	}
+
+	check := registration.Checks[0]
+	if check.HTTP != "http://app1:81/api/v1/health" || check.TTL != "" || check.DeregisterCriticalServiceAfter != "1m0s" {
+		t.Errorf("unexpected check %+v", check)
+	}
+
+	if err := r.Deregister(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(agent.deregistered, ",") != "passwordsharing-1" {
+		t.Errorf("expected the instance to be deregistered but was %v", agent.deregistered)
+	}
+}
+
+func TestConsulShouldCheckOverHttpsWithTls(t *testing.T) {
+	agent := &fakeAgent{}
+	r := newTestRegistrar(t, agent, func(c *config.Config) {
+		c.Tls.Enabled = true
+		c.Discovery.Consul.TlsSkipVerify = true
+	})
+
+	if err := r.Register(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	check := agent.registrations[0].Checks[0]
+	if check.HTTP != "https://app1:81/api/v1/health" || !check.TLSSkipVerify {
+		t.Errorf("expected an https check but was %+v", check)
+	}
+}
+
+func TestConsulShouldStopRetryingWhenCancelled(t *testing.T) {
+	agent := &fakeAgent{unavailable: 1000}
+	r := newTestRegistrar(t, agent, func(*config.Config) {})
+
+	ctxt, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := r.Register(ctxt); err == nil {
+		t.Error("expected registration to fail")
+	}
+}
+
+func TestConsulShouldHeartbeatTtlCheck(t *testing.T) {
+	database := &switchCheck{}
+	database.healthy.Store(true)
+
+	agent := &fakeAgent{}
+	r := newTestRegistrar(t, agent, func(c *config.Config) {
+		c.Discovery.Consul.Check = CheckTtl
+	}, database)
+
+	if err := r.Register(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	check := agent.registrations[0].Checks[0]
+	if check.TTL != "30ms" || check.HTTP != "" {
+		t.Errorf("expected a ttl check but was %+v", check)
+	}
+
+	// the first report happens during the registration
+	if update := agent.lastUpdate(); update != "healthcheck-1 passing" {
+		t.Errorf("expected a passing report but was %q", update)
+	}
+
+	database.healthy.Store(false)
+	waitFor(t, func() bool { return agent.lastUpdate() == "healthcheck-1 critical" })
+
+	database.healthy.Store(true)
+	waitFor(t, func() bool { return agent.lastUpdate() == "healthcheck-1 passing" })
+
+	if err := r.Deregister(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	updates := agent.updateCount()
+	time.Sleep(3 * r.interval)
+	if agent.updateCount() != updates {
+		t.Error("expected the heartbeat to stop with the deregistration")
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	for attempt := 0; attempt < 100; attempt++ {
+		if condition() {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("condition was not met in time")
+}
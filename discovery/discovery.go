@@ -0,0 +1,91 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/misikdmitriy/password-sharing/buildinfo"
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/health"
+	"github.com/misikdmitriy/password-sharing/logger"
+)
+
+// Registrar announces the instance to service discovery.
+type Registrar interface {
+	// Register announces the instance. It keeps retrying while the registry
+	// is not reachable, until ctx is done.
+	Register(ctx context.Context) error
+	// Deregister withdraws the instance.
+	Deregister(ctx context.Context) error
+}
+
+const (
+	ProviderConsul = "consul"
+	ProviderStatic = "static"
+	ProviderNone   = "none"
+)
+
+const serviceName = "passwordsharing"
+
+// healthPath is the health route of the API, see server.apiPrefix.
+const healthPath = "/api/v1/health"
+
+// Instance is what the registry learns about this instance.
+type Instance struct {
+	Id      string
+	Name    string
+	Address string
+	Port    int
+	Tags    []string
+	Meta    map[string]string
+}
+
+func instanceOf(conf *config.Config) Instance {
+	meta := map[string]string{
+		"version": buildinfo.Version,
+	}
+	if conf.Discovery.Region != "" {
+		meta["region"] = conf.Discovery.Region
+	}
+
+	return Instance{
+		Id:      fmt.Sprintf("%s-%d", serviceName, conf.App.ServiceId),
+		Name:    serviceName,
+		Address: conf.App.Address,
+		Port:    conf.App.Port,
+		Tags:    conf.Discovery.Tags,
+		Meta:    meta,
+	}
+}
+
+// NewRegistrar returns the registrar configured under discovery. checks
+// decide the health the instance reports itself, see
+// discovery.consul.check.
+func NewRegistrar(conf *config.Config, loggerFactory logger.LoggerFactory, checks ...health.HealthCheck) (Registrar, error) {
+	switch conf.Discovery.Provider {
+	case ProviderConsul, "":
+		return NewConsulRegistrar(conf, loggerFactory, checks...)
+	case ProviderStatic:
+		return NewStaticRegistrar(conf), nil
+	case ProviderNone:
+		return NewNoopRegistrar(), nil
+	default:
+		return nil, fmt.Errorf("unknown discovery provider %s", conf.Discovery.Provider)
+	}
+}
+
+type noopRegistrar struct{}
+
+// NewNoopRegistrar returns a registrar for instances nobody discovers, e.g.
+// local runs.
+func NewNoopRegistrar() Registrar {
+	return &noopRegistrar{}
+}
+
+func (r *noopRegistrar) Register(context.Context) error {
+	return nil
+}
+
+func (r *noopRegistrar) Deregister(context.Context) error {
+	return nil
+}
@@ -0,0 +1,101 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/misikdmitriy/password-sharing/config"
+)
+
+type staticRegistrar struct {
+	path     string
+	instance Instance
+}
+
+// NewStaticRegistrar returns a registrar that writes the instance to a file
+// in the Prometheus file_sd format, which Prometheus and most proxies can
+// watch. Every instance needs a file of its own.
+func NewStaticRegistrar(conf *config.Config) Registrar {
+	return &staticRegistrar{
+		path:     conf.Discovery.Static.Path,
+		instance: instanceOf(conf),
+	}
+}
+
+type targetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+func (r *staticRegistrar) Register(context.Context) error {
+	if r.path == "" {
+		return errors.New("discovery.static.path is required")
+	}
+
+	labels := map[string]string{
+		"service":     r.instance.Name,
+		"instance_id": r.instance.Id,
+	}
+	for key, value := range r.instance.Meta {
+		labels[key] = value
+	}
+	if len(r.instance.Tags) > 0 {
+		// the separators on both ends let relabeling match ,tag,
+		labels["tags"] = "," + strings.Join(r.instance.Tags, ",") + ","
+	}
+
+	content, err := json.MarshalIndent([]targetGroup{
+		{
+			Targets: []string{fmt.Sprintf("%s:%d", r.instance.Address, r.instance.Port)},
+			Labels:  labels,
+		},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(r.path, content)
+}
+
+func (r *staticRegistrar) Deregister(context.Context) error {
+	if err := os.Remove(r.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// writeFile replaces path at once, watchers never read a partial file.
+func writeFile(path string, content []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err = file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Chmod(file.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
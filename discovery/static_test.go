@@ -0,0 +1,54 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/misikdmitriy/password-sharing/config"
+)
+
+func TestStaticShouldWriteTargetFile(t *testing.T) {
+	c := &config.Config{}
+	c.App.Address = "app2"
+	c.App.Port = 82
+	c.App.ServiceId = 2
+	c.Discovery.Tags = []string{"api"}
+	c.Discovery.Static.Path = filepath.Join(t.TempDir(), "targets", "app2.json")
+
+	r := NewStaticRegistrar(c)
+	if err := r.Register(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(c.Discovery.Static.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var groups []targetGroup
+	if err = json.Unmarshal(content, &groups); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 1 || len(groups[0].Targets) != 1 || groups[0].Targets[0] != "app2:82" {
+		t.Fatalf("unexpected targets %s", content)
+	}
+
+	labels := groups[0].Labels
+	if labels["instance_id"] != "passwordsharing-2" || labels["version"] != "dev" || labels["tags"] != ",api," {
+		t.Errorf("unexpected labels %v", labels)
+	}
+
+	if err = r.Deregister(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(c.Discovery.Static.Path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the file to be removed but was %v", err)
+	}
+}
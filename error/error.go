@@ -1,6 +1,7 @@
 package error
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/misikdmitriy/password-sharing/model"
@@ -9,51 +10,134 @@ import (
 type ErrorCodes int
 
 const (
-	BadRequest          ErrorCodes = 40000
-	PasswordNotFound               = 40401
-	InternalServerError            = 50000
-	InitDbError                    = 50001
-	RandomizerError                = 50002
-	DbQueryError                   = 50003
-	DbCommandError                 = 50004
-	EncodeError                    = 50005
-	DecodeError                    = 50006
+	BadRequest                ErrorCodes = 40000
+	InvalidGeneratorPolicy    ErrorCodes = 40001
+	PassphraseRequired        ErrorCodes = 40002
+	InvalidRecipient          ErrorCodes = 40003
+	InvalidAllowlist          ErrorCodes = 40004
+	InvalidAdminQuery         ErrorCodes = 40005
+	InvalidIdempotencyKey     ErrorCodes = 40006
+	InvalidRequestToken       ErrorCodes = 40101
+	Unauthorized              ErrorCodes = 40102
+	InvalidCredentials        ErrorCodes = 40103
+	InvalidPassphrase         ErrorCodes = 40104
+	VerificationRequired      ErrorCodes = 40105
+	InvalidOneTimeCode        ErrorCodes = 40106
+	OneTimeCodeExpired        ErrorCodes = 40107
+	ClientCertificateRequired ErrorCodes = 40108
+	Forbidden                 ErrorCodes = 40301
+	UnknownTenant             ErrorCodes = 40302
+	AddressNotAllowed         ErrorCodes = 40303
+	InsufficientRole          ErrorCodes = 40304
+	InvalidChallenge          ErrorCodes = 40305
+	PasswordNotFound          ErrorCodes = 40401
+	SecretRequestNotFound     ErrorCodes = 40402
+	ApiKeyNotFound            ErrorCodes = 40403
+	LinkHashNotFound          ErrorCodes = 40404
+	SecretRequestFulfilled    ErrorCodes = 40901
+	SecretRequestPending      ErrorCodes = 40902
+	ApiKeyRevoked             ErrorCodes = 40903
+	IdempotencyKeyReused      ErrorCodes = 40904
+	IdempotencyKeyInProgress  ErrorCodes = 40905
+	SecretRequestExpired      ErrorCodes = 41001
+	PasswordExpired           ErrorCodes = 41002
+	SecretTooLarge            ErrorCodes = 41301
+	WeakPassword              ErrorCodes = 42201
+	BreachedPassword          ErrorCodes = 42202
+	ChallengeRequired         ErrorCodes = 42801
+	TooManyAttempts           ErrorCodes = 42901
+	RateLimited               ErrorCodes = 42902
+	InternalServerError       ErrorCodes = 50000
+	InitDbError               ErrorCodes = 50001
+	RandomizerError           ErrorCodes = 50002
+	DbQueryError              ErrorCodes = 50003
+	DbCommandError            ErrorCodes = 50004
+	EncodeError               ErrorCodes = 50005
+	DecodeError               ErrorCodes = 50006
+	BreachCheckError          ErrorCodes = 50007
+	KeyProviderError          ErrorCodes = 50008
+	NotificationError         ErrorCodes = 50009
 )
 
+// Status returns the HTTP status registered for the code.
+func (c ErrorCodes) Status() int {
+	return Lookup(c).Status
+}
+
+// Error makes codes usable as errors.Is targets, e.g.
+// errors.Is(err, pserror.PasswordNotFound).
+func (c ErrorCodes) Error() string {
+	return fmt.Sprintf("password sharing error %d", int(c))
+}
+
 type PasswordSharingError struct {
 	Code    ErrorCodes
 	Message string
+	// Cause is the underlying error, it is never sent to clients.
+	Cause error
 }
 
 func (e *PasswordSharingError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("password sharing error occured. code: %d. message: %s. cause: %v",
+			e.Code,
+			e.Message,
+			e.Cause)
+	}
+
 	return fmt.Sprintf("password sharing error occured. code: %d. message: %s",
 		e.Code,
 		e.Message)
 }
 
-func (e *PasswordSharingError) ToResponse() (int, *model.ErrorResponse) {
-	code := int(e.Code)
-	return code / 100, &model.ErrorResponse{
-		Code:    int(e.Code),
-		Message: e.Message,
+func (e *PasswordSharingError) Unwrap() error {
+	return e.Cause
+}
+
+func (e *PasswordSharingError) Is(target error) bool {
+	switch t := target.(type) {
+	case ErrorCodes:
+		return e.Code == t
+	case *PasswordSharingError:
+		return e.Code == t.Code
+	default:
+		return false
+	}
+}
+
+// ToResponse builds an RFC 7807 problem document. instance identifies the
+// failed request, usually its path.
+func (e *PasswordSharingError) ToResponse(instance string, requestId string) (int, *model.ProblemResponse) {
+	definition := Lookup(e.Code)
+
+	return definition.Status, &model.ProblemResponse{
+		Type:      definition.Type,
+		Title:     definition.Title,
+		Status:    definition.Status,
+		Detail:    e.Message,
+		Instance:  instance,
+		Code:      int(e.Code),
+		RequestId: requestId,
+		Retryable: definition.Retryable,
 	}
 }
 
 func AsPasswordSharingError(err error) *PasswordSharingError {
-	psError, ok := err.(*PasswordSharingError)
-	if ok {
+	var psError *PasswordSharingError
+	if errors.As(err, &psError) {
 		return psError
 	}
 
 	return &PasswordSharingError{
 		Code:    InternalServerError,
-		Message: err.Error(),
+		Message: "internal server error",
+		Cause:   err,
 	}
 }
 
-func BadRequestError() (int, *model.ErrorResponse) {
-	return 400, &model.ErrorResponse{
-		Code:    int(BadRequest),
+func BadRequestError() *PasswordSharingError {
+	return &PasswordSharingError{
+		Code:    BadRequest,
 		Message: "bad request",
 	}
 }
@@ -0,0 +1,120 @@
+package error
+
+import (
+	"net/http"
+	"strings"
+)
+
+const typePrefix = "urn:password-sharing:error:"
+
+// ErrorDefinition is the registry entry of an error code. Type is a stable
+// URI clients can rely on, unlike the human readable Title.
+type ErrorDefinition struct {
+	Code      ErrorCodes
+	Status    int
+	Type      string
+	Title     string
+	Retryable bool
+}
+
+var definitions = []ErrorDefinition{
+	define(BadRequest, http.StatusBadRequest, "bad-request", "Bad request", false),
+	define(InvalidGeneratorPolicy, http.StatusBadRequest, "invalid-generator-policy", "Invalid generator policy", false),
+	define(PassphraseRequired, http.StatusBadRequest, "passphrase-required", "Passphrase required", false),
+	define(InvalidRecipient, http.StatusBadRequest, "invalid-recipient", "Invalid recipient", false),
+	define(InvalidAllowlist, http.StatusBadRequest, "invalid-allowlist", "Invalid IP allowlist", false),
+	define(InvalidAdminQuery, http.StatusBadRequest, "invalid-admin-query", "Invalid admin query", false),
+	define(InvalidIdempotencyKey, http.StatusBadRequest, "invalid-idempotency-key", "Invalid idempotency key", false),
+	define(InvalidRequestToken, http.StatusUnauthorized, "invalid-request-token", "Invalid secret request token", false),
+	define(Unauthorized, http.StatusUnauthorized, "unauthorized", "Authentication required", false),
+	define(InvalidCredentials, http.StatusUnauthorized, "invalid-credentials", "Invalid credentials", false),
+	define(InvalidPassphrase, http.StatusUnauthorized, "invalid-passphrase", "Invalid passphrase", false),
+	define(VerificationRequired, http.StatusUnauthorized, "verification-required", "Recipient verification required", false),
+	define(InvalidOneTimeCode, http.StatusUnauthorized, "invalid-one-time-code", "Invalid one-time code", false),
+	define(OneTimeCodeExpired, http.StatusUnauthorized, "one-time-code-expired", "One-time code expired", false),
+	define(ClientCertificateRequired, http.StatusUnauthorized, "client-certificate-required", "Client certificate required", false),
+	define(Forbidden, http.StatusForbidden, "forbidden", "Insufficient permissions", false),
+	define(UnknownTenant, http.StatusForbidden, "unknown-tenant", "Unknown tenant", false),
+	define(AddressNotAllowed, http.StatusForbidden, "address-not-allowed", "Client address not allowed", false),
+	define(InsufficientRole, http.StatusForbidden, "insufficient-role", "Insufficient role", false),
+	define(InvalidChallenge, http.StatusForbidden, "invalid-challenge", "Invalid proof-of-work solution", false),
+	define(PasswordNotFound, http.StatusNotFound, "password-not-found", "Password not found", false),
+	define(SecretRequestNotFound, http.StatusNotFound, "secret-request-not-found", "Secret request not found", false),
+	define(ApiKeyNotFound, http.StatusNotFound, "api-key-not-found", "API key not found", false),
+	define(LinkHashNotFound, http.StatusNotFound, "link-hash-not-found", "No secret with this link hash", false),
+	define(SecretRequestFulfilled, http.StatusConflict, "secret-request-fulfilled", "Secret request already fulfilled", false),
+	define(SecretRequestPending, http.StatusConflict, "secret-request-pending", "Secret request is not fulfilled yet", true),
+	define(ApiKeyRevoked, http.StatusConflict, "api-key-revoked", "API key already revoked", false),
+	define(IdempotencyKeyReused, http.StatusConflict, "idempotency-key-reused", "Idempotency key reused with a different request", false),
+	define(IdempotencyKeyInProgress, http.StatusConflict, "idempotency-key-in-progress", "A request with this idempotency key is in progress", true),
+	define(SecretRequestExpired, http.StatusGone, "secret-request-expired", "Secret request expired", false),
+	define(PasswordExpired, http.StatusGone, "password-expired", "Password expired", false),
+	define(SecretTooLarge, http.StatusRequestEntityTooLarge, "secret-too-large", "Secret too large", false),
+	define(WeakPassword, http.StatusUnprocessableEntity, "weak-password", "Password is too weak", false),
+	define(BreachedPassword, http.StatusUnprocessableEntity, "breached-password", "Password was found in a data breach", false),
+	define(ChallengeRequired, http.StatusPreconditionRequired, "challenge-required", "Proof-of-work challenge required", false),
+	define(TooManyAttempts, http.StatusTooManyRequests, "too-many-attempts", "Too many attempts", true),
+	define(RateLimited, http.StatusTooManyRequests, "rate-limited", "Rate limit exceeded", true),
+	define(InternalServerError, http.StatusInternalServerError, "internal-server-error", "Internal server error", false),
+	define(InitDbError, http.StatusInternalServerError, "init-db-error", "Database is unavailable", true),
+	define(RandomizerError, http.StatusInternalServerError, "randomizer-error", "Random generation failed", true),
+	define(DbQueryError, http.StatusInternalServerError, "db-query-error", "Database query failed", true),
+	define(DbCommandError, http.StatusInternalServerError, "db-command-error", "Database command failed", true),
+	define(EncodeError, http.StatusInternalServerError, "encode-error", "Encryption failed", false),
+	define(DecodeError, http.StatusInternalServerError, "decode-error", "Decryption failed", false),
+	define(BreachCheckError, http.StatusInternalServerError, "breach-check-error", "Breach check failed", true),
+	define(KeyProviderError, http.StatusInternalServerError, "key-provider-error", "Encryption key is unavailable", true),
+	define(NotificationError, http.StatusInternalServerError, "notification-error", "Notification could not be sent", true),
+}
+
+var registry = func() map[ErrorCodes]ErrorDefinition {
+	result := make(map[ErrorCodes]ErrorDefinition, len(definitions))
+	for _, d := range definitions {
+		result[d.Code] = d
+	}
+
+	return result
+}()
+
+func define(code ErrorCodes, status int, slug string, title string, retryable bool) ErrorDefinition {
+	return ErrorDefinition{
+		Code:      code,
+		Status:    status,
+		Type:      typePrefix + slug,
+		Title:     title,
+		Retryable: retryable,
+	}
+}
+
+// Slug is the last part of Type, e.g. password-not-found.
+func (d ErrorDefinition) Slug() string {
+	return strings.TrimPrefix(d.Type, typePrefix)
+}
+
+// Lookup returns the definition of code, unknown codes are reported as
+// internal server errors.
+func Lookup(code ErrorCodes) ErrorDefinition {
+	if d, ok := registry[code]; ok {
+		return d
+	}
+
+	return registry[InternalServerError]
+}
+
+// Codes lists every error code the service can respond with.
+func Codes() []ErrorCodes {
+	result := make([]ErrorCodes, len(definitions))
+	for i, d := range definitions {
+		result[i] = d.Code
+	}
+
+	return result
+}
+
+// Definitions returns the whole registry in declaration order.
+func Definitions() []ErrorDefinition {
+	result := make([]ErrorDefinition, len(definitions))
+	copy(result, definitions)
+
+	return result
+}
@@ -0,0 +1,127 @@
+package error
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRegistryShouldDescribeEveryCode(t *testing.T) {
+	cases := []struct {
+		code      ErrorCodes
+		status    int
+		retryable bool
+	}{
+		{BadRequest, http.StatusBadRequest, false},
+		{InvalidGeneratorPolicy, http.StatusBadRequest, false},
+		{PassphraseRequired, http.StatusBadRequest, false},
+		{InvalidRecipient, http.StatusBadRequest, false},
+		{InvalidAllowlist, http.StatusBadRequest, false},
+		{InvalidAdminQuery, http.StatusBadRequest, false},
+		{InvalidIdempotencyKey, http.StatusBadRequest, false},
+		{InvalidRequestToken, http.StatusUnauthorized, false},
+		{Unauthorized, http.StatusUnauthorized, false},
+		{InvalidCredentials, http.StatusUnauthorized, false},
+		{InvalidPassphrase, http.StatusUnauthorized, false},
+		{VerificationRequired, http.StatusUnauthorized, false},
+		{InvalidOneTimeCode, http.StatusUnauthorized, false},
+		{OneTimeCodeExpired, http.StatusUnauthorized, false},
+		{ClientCertificateRequired, http.StatusUnauthorized, false},
+		{Forbidden, http.StatusForbidden, false},
+		{UnknownTenant, http.StatusForbidden, false},
+		{AddressNotAllowed, http.StatusForbidden, false},
+		{InsufficientRole, http.StatusForbidden, false},
+		{InvalidChallenge, http.StatusForbidden, false},
+		{PasswordNotFound, http.StatusNotFound, false},
+		{SecretRequestNotFound, http.StatusNotFound, false},
+		{ApiKeyNotFound, http.StatusNotFound, false},
+		{LinkHashNotFound, http.StatusNotFound, false},
+		{SecretRequestFulfilled, http.StatusConflict, false},
+		{SecretRequestPending, http.StatusConflict, true},
+		{ApiKeyRevoked, http.StatusConflict, false},
+		{IdempotencyKeyReused, http.StatusConflict, false},
+		{IdempotencyKeyInProgress, http.StatusConflict, true},
+		{SecretRequestExpired, http.StatusGone, false},
+		{PasswordExpired, http.StatusGone, false},
+		{SecretTooLarge, http.StatusRequestEntityTooLarge, false},
+		{WeakPassword, http.StatusUnprocessableEntity, false},
+		{BreachedPassword, http.StatusUnprocessableEntity, false},
+		{ChallengeRequired, http.StatusPreconditionRequired, false},
+		{TooManyAttempts, http.StatusTooManyRequests, true},
+		{RateLimited, http.StatusTooManyRequests, true},
+		{InternalServerError, http.StatusInternalServerError, false},
+		{InitDbError, http.StatusInternalServerError, true},
+		{RandomizerError, http.StatusInternalServerError, true},
+		{DbQueryError, http.StatusInternalServerError, true},
+		{DbCommandError, http.StatusInternalServerError, true},
+		{EncodeError, http.StatusInternalServerError, false},
+		{DecodeError, http.StatusInternalServerError, false},
+		{BreachCheckError, http.StatusInternalServerError, true},
+		{KeyProviderError, http.StatusInternalServerError, true},
+		{NotificationError, http.StatusInternalServerError, true},
+	}
+
+	if len(cases) != len(Codes()) {
+		t.Fatalf("expected %d codes to be covered but %d are registered", len(cases), len(Codes()))
+	}
+
+	types := map[string]ErrorCodes{}
+	for _, tc := range cases {
+		t.Run(fmt.Sprint(int(tc.code)), func(t *testing.T) {
+			d := Lookup(tc.code)
+			if d.Code != tc.code {
+				t.Fatalf("code %d is not registered", tc.code)
+			}
+
+			if d.Status != tc.status || tc.code.Status() != tc.status {
+				t.Errorf("expected status %d but was %d", tc.status, d.Status)
+			}
+
+			if d.Retryable != tc.retryable {
+				t.Errorf("expected retryable to be %v", tc.retryable)
+			}
+
+			if !strings.HasPrefix(d.Type, typePrefix) || d.Title == "" {
+				t.Errorf("expected type and title to be set but were '%s' and '%s'", d.Type, d.Title)
+			}
+
+			if other, ok := types[d.Type]; ok {
+				t.Errorf("type %s is shared with code %d", d.Type, other)
+			}
+			types[d.Type] = tc.code
+
+			cause := errors.New("cause")
+			err := fmt.Errorf("wrapped: %w", &PasswordSharingError{Code: tc.code, Message: "message", Cause: cause})
+
+			if !errors.Is(err, tc.code) || !errors.Is(err, cause) {
+				t.Errorf("expected wrapped error to match code and cause")
+			}
+
+			var psError *PasswordSharingError
+			if !errors.As(err, &psError) || psError.Code != tc.code {
+				t.Errorf("expected wrapped error to be password sharing error")
+			}
+
+			status, response := AsPasswordSharingError(err).ToResponse("/path", "id")
+			if status != tc.status || response.Status != tc.status || response.Code != int(tc.code) ||
+				response.Type != d.Type || response.RequestId != "id" || response.Instance != "/path" {
+				t.Errorf("unexpected problem response %+v", response)
+			}
+		})
+	}
+}
+
+func TestAsPasswordSharingErrorShouldHideUnknownErrors(t *testing.T) {
+	err := errors.New("connection refused to 10.0.0.1")
+
+	psError := AsPasswordSharingError(err)
+	if psError.Code != InternalServerError || strings.Contains(psError.Message, "10.0.0.1") {
+		t.Errorf("unexpected error %v", psError)
+	}
+
+	if !errors.Is(psError, err) {
+		t.Errorf("expected cause to be kept")
+	}
+}
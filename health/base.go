@@ -1,7 +1,53 @@
 package health
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type HealthCheck interface {
 	Check(context.Context) (bool, error)
 }
+
+// DetailedCheck is a check that also describes what it found, e.g. the free
+// disk space. Probes use CheckDetails instead of Check.
+type DetailedCheck interface {
+	HealthCheck
+	CheckDetails(context.Context) (map[string]string, error)
+}
+
+// Check is a named check of a probe. A failing critical check fails the
+// probe, the others only degrade it.
+type Check struct {
+	Name     string
+	Critical bool
+	Check    HealthCheck
+}
+
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	// StatusWarn is the status of a probe with failing non-critical checks.
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+type Result struct {
+	Name     string
+	Status   Status
+	Critical bool
+	Latency  time.Duration
+	Details  map[string]string
+	Error    string
+}
+
+type Report struct {
+	Status    Status
+	CheckedAt time.Time
+	Results   []Result
+}
+
+func (r Report) Healthy() bool {
+	return r.Status != StatusFail
+}
@@ -0,0 +1,48 @@
+package health
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hashicorp/consul/api"
+)
+
+type consulHealthCheck struct {
+	client *api.Client
+}
+
+// NewConsulHealthCheck checks that the Consul agent at address answers and
+// knows a leader.
+func NewConsulHealthCheck(address string) (HealthCheck, error) {
+	client, err := api.NewClient(&api.Config{
+		Address: address,
+		Scheme:  "http",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &consulHealthCheck{
+		client: client,
+	}, nil
+}
+
+func (h *consulHealthCheck) Check(c context.Context) (bool, error) {
+	_, err := h.CheckDetails(c)
+	return err == nil, err
+}
+
+func (h *consulHealthCheck) CheckDetails(c context.Context) (map[string]string, error) {
+	leader, err := h.client.Status().LeaderWithQueryOptions((&api.QueryOptions{}).WithContext(c))
+	if err != nil {
+		return nil, err
+	}
+
+	if leader == "" {
+		return nil, errors.New("consul has no leader")
+	}
+
+	return map[string]string{
+		"leader": leader,
+	}, nil
+}
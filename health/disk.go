@@ -0,0 +1,45 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+type diskHealthCheck struct {
+	path    string
+	minFree uint64
+}
+
+// NewDiskHealthCheck checks that the file system of path has at least
+// minFree bytes left.
+func NewDiskHealthCheck(path string, minFree uint64) HealthCheck {
+	return &diskHealthCheck{
+		path:    path,
+		minFree: minFree,
+	}
+}
+
+func (d *diskHealthCheck) Check(c context.Context) (bool, error) {
+	_, err := d.CheckDetails(c)
+	return err == nil, err
+}
+
+func (d *diskHealthCheck) CheckDetails(context.Context) (map[string]string, error) {
+	free, total, err := diskSpace(d.path)
+	if err != nil {
+		return nil, err
+	}
+
+	details := map[string]string{
+		"path":       d.path,
+		"freeBytes":  strconv.FormatUint(free, 10),
+		"totalBytes": strconv.FormatUint(total, 10),
+	}
+
+	if free < d.minFree {
+		return details, fmt.Errorf("%d bytes free on %s, %d required", free, d.path, d.minFree)
+	}
+
+	return details, nil
+}
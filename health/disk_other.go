@@ -0,0 +1,9 @@
+//go:build windows || plan9
+
+package health
+
+import "errors"
+
+func diskSpace(string) (uint64, uint64, error) {
+	return 0, 0, errors.New("disk space is not supported on this platform")
+}
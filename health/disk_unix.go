@@ -0,0 +1,16 @@
+//go:build !windows && !plan9
+
+package health
+
+import "syscall"
+
+// diskSpace returns the bytes available to the process and the size of the
+// file system of path.
+func diskSpace(path string) (uint64, uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+
+	return stat.Bavail * uint64(stat.Bsize), stat.Blocks * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,55 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/misikdmitriy/password-sharing/keys"
+	"github.com/misikdmitriy/password-sharing/tenant"
+)
+
+const keysSample = "health-check"
+
+type keysHealthCheck struct {
+	keys    keys.Provider
+	tenants tenant.Registry
+}
+
+// NewKeysHealthCheck checks that the active key of every tenant encrypts
+// and decrypts.
+func NewKeysHealthCheck(keys keys.Provider, tenants tenant.Registry) HealthCheck {
+	return &keysHealthCheck{
+		keys:    keys,
+		tenants: tenants,
+	}
+}
+
+func (k *keysHealthCheck) Check(c context.Context) (bool, error) {
+	_, err := k.CheckDetails(c)
+	return err == nil, err
+}
+
+func (k *keysHealthCheck) CheckDetails(context.Context) (map[string]string, error) {
+	tenants := k.tenants.All()
+	for _, t := range tenants {
+		encoder, keyId, err := k.keys.Active(t.Id)
+		if err != nil {
+			return nil, fmt.Errorf("no active key of tenant %s: %w", t.Id, err)
+		}
+
+		encoded, err := encoder.Encode(keysSample)
+		if err != nil {
+			return nil, fmt.Errorf("key %s of tenant %s cannot encrypt: %w", keyId, t.Id, err)
+		}
+
+		decoded, err := encoder.Decode(encoded)
+		if err != nil || decoded != keysSample {
+			return nil, fmt.Errorf("key %s of tenant %s cannot decrypt", keyId, t.Id)
+		}
+	}
+
+	return map[string]string{
+		"tenants": strconv.Itoa(len(tenants)),
+	}, nil
+}
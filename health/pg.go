@@ -2,7 +2,9 @@ package health
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"sync"
 
 	"github.com/misikdmitriy/password-sharing/database"
 	"github.com/misikdmitriy/password-sharing/logger"
@@ -12,6 +14,10 @@ import (
 type pgHealthCheck struct {
 	factory       database.DbFactory
 	loggerFactory logger.LoggerFactory
+
+	// the connection is opened by the first run and pinged by every run
+	mu sync.Mutex
+	db *sql.DB
 }
 
 func NewPgHealthCheck(factory database.DbFactory, loggerFactory logger.LoggerFactory) HealthCheck {
@@ -22,13 +28,12 @@ func NewPgHealthCheck(factory database.DbFactory, loggerFactory logger.LoggerFac
 }
 
 func (pg *pgHealthCheck) Check(c context.Context) (bool, error) {
-	db, dbClose, err := pg.factory.InitDB(c)
+	db, err := pg.open(c)
 	if err != nil {
 		return false, err
 	}
-	defer dbClose()
 
-	if err := db.Exec("SELECT 1").Error; err != nil {
+	if err := db.PingContext(c); err != nil {
 		appLogger, loggerClose, err := pg.loggerFactory.NewLogger()
 		if err != nil {
 			return false, err
@@ -43,3 +48,28 @@ func (pg *pgHealthCheck) Check(c context.Context) (bool, error) {
 
 	return true, nil
 }
+
+func (pg *pgHealthCheck) open(c context.Context) (*sql.DB, error) {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+
+	if pg.db != nil {
+		return pg.db, nil
+	}
+
+	db, _, err := pg.factory.InitDB(c)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDb, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	// checks run one at a time, more connections would only be idle
+	sqlDb.SetMaxOpenConns(1)
+	pg.db = sqlDb
+
+	return sqlDb, nil
+}
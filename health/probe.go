@@ -0,0 +1,217 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var checkStatus *prometheus.GaugeVec = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "password_sharing_health_check",
+	Help: "The result of the last run of a health check, 1 when it passed",
+}, []string{"check"})
+
+var checkTime *prometheus.HistogramVec = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name: "password_sharing_health_check_seconds",
+	Help: "The duration of health checks",
+}, []string{"check"})
+
+const (
+	defaultCacheInterval = 5 * time.Second
+	defaultCheckTimeout  = 2 * time.Second
+)
+
+// Probe runs its checks concurrently and reuses the report for an
+// interval, so frequent probing does not load the dependencies. A probe is
+// a HealthCheck itself.
+type Probe interface {
+	HealthCheck
+	Report() Report
+}
+
+type probe struct {
+	checks   []Check
+	interval time.Duration
+	timeout  time.Duration
+	// latch keeps the first healthy report, which is what a startup probe
+	// needs
+	latch bool
+	now   func() time.Time
+
+	mu     sync.Mutex
+	report *Report
+}
+
+// NewProbe returns a probe that runs checks at most once per interval and
+// gives each of them timeout.
+func NewProbe(interval time.Duration, timeout time.Duration, checks ...Check) Probe {
+	return newProbe(interval, timeout, false, checks)
+}
+
+// NewStartupProbe returns a probe that passes for good once its checks
+// passed.
+func NewStartupProbe(interval time.Duration, timeout time.Duration, checks ...Check) Probe {
+	return newProbe(interval, timeout, true, checks)
+}
+
+func newProbe(interval time.Duration, timeout time.Duration, latch bool, checks []Check) *probe {
+	if interval <= 0 {
+		interval = defaultCacheInterval
+	}
+
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+
+	return &probe{
+		checks:   checks,
+		interval: interval,
+		timeout:  timeout,
+		latch:    latch,
+		now:      time.Now,
+	}
+}
+
+func (p *probe) Check(context.Context) (bool, error) {
+	report := p.Report()
+	if report.Healthy() {
+		return true, nil
+	}
+
+	for _, result := range report.Results {
+		if result.Critical && result.Status == StatusFail {
+			return false, fmt.Errorf("%s: %s", result.Name, result.Error)
+		}
+	}
+
+	return false, errors.New("unhealthy")
+}
+
+// Report returns the cached report or runs the checks. Callers arriving
+// while the checks run wait for their report. Checks do not run in the
+// context of a caller, the report is shared.
+func (p *probe) Report() Report {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.report != nil {
+		if p.latch && p.report.Healthy() {
+			return *p.report
+		}
+
+		if p.now().Sub(p.report.CheckedAt) < p.interval {
+			return *p.report
+		}
+	}
+
+	report := p.run()
+	p.report = &report
+
+	return report
+}
+
+func (p *probe) run() Report {
+	results := make([]Result, len(p.checks))
+
+	var wg sync.WaitGroup
+	for i, check := range p.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = p.runCheck(check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	status := StatusPass
+	for _, result := range results {
+		if result.Status != StatusFail {
+			continue
+		}
+
+		if result.Critical {
+			status = StatusFail
+			break
+		}
+
+		status = StatusWarn
+	}
+
+	return Report{
+		Status:    status,
+		CheckedAt: p.now(),
+		Results:   results,
+	}
+}
+
+// runCheck stops waiting for a check after the timeout, also when it does
+// not respect its context.
+func (p *probe) runCheck(check Check) Result {
+	ctxt, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	type outcome struct {
+		details map[string]string
+		err     error
+	}
+
+	// buffered, a check that timed out must not block forever
+	done := make(chan outcome, 1)
+	started := time.Now()
+
+	go func() {
+		details, err := checkDetails(ctxt, check.Check)
+		done <- outcome{details: details, err: err}
+	}()
+
+	result := Result{
+		Name:     check.Name,
+		Status:   StatusPass,
+		Critical: check.Critical,
+	}
+
+	select {
+	case o := <-done:
+		result.Details = o.details
+		if o.err != nil {
+			result.Status = StatusFail
+			result.Error = o.err.Error()
+		}
+	case <-ctxt.Done():
+		result.Status = StatusFail
+		result.Error = fmt.Sprintf("timed out after %s", p.timeout)
+	}
+
+	result.Latency = time.Since(started)
+
+	checkTime.WithLabelValues(check.Name).Observe(result.Latency.Seconds())
+	if result.Status == StatusPass {
+		checkStatus.WithLabelValues(check.Name).Set(1)
+	} else {
+		checkStatus.WithLabelValues(check.Name).Set(0)
+	}
+
+	return result
+}
+
+func checkDetails(ctxt context.Context, check HealthCheck) (map[string]string, error) {
+	if detailed, ok := check.(DetailedCheck); ok {
+		return detailed.CheckDetails(ctxt)
+	}
+
+	healthy, err := check.Check(ctxt)
+	if healthy {
+		return nil, nil
+	}
+
+	if err == nil {
+		err = errors.New("unhealthy")
+	}
+
+	return nil, err
+}
@@ -0,0 +1,190 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/database"
+	"github.com/misikdmitriy/password-sharing/keys"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/tenant"
+	"gorm.io/gorm"
+)
+
+type testCheck struct {
+	runs    atomic.Int32
+	delay   time.Duration
+	healthy atomic.Bool
+}
+
+func newTestCheck(healthy bool, delay time.Duration) *testCheck {
+	check := &testCheck{delay: delay}
+	check.healthy.Store(healthy)
+
+	return check
+}
+
+// Check ignores its context on purpose, probes must not wait for it.
+func (c *testCheck) Check(context.Context) (bool, error) {
+	c.runs.Add(1)
+	time.Sleep(c.delay)
+
+	if c.healthy.Load() {
+		return true, nil
+	}
+
+	return false, errors.New("broken")
+}
+
+func TestProbeShouldRunChecksConcurrentlyWithTimeouts(t *testing.T) {
+	slow := newTestCheck(true, 100*time.Millisecond)
+	hanging := newTestCheck(true, time.Second)
+
+	p := NewProbe(time.Minute, 200*time.Millisecond,
+		Check{Name: "slow", Critical: true, Check: slow},
+		Check{Name: "also slow", Critical: true, Check: newTestCheck(true, 100*time.Millisecond)},
+		Check{Name: "hanging", Check: hanging},
+	)
+
+	started := time.Now()
+	report := p.Report()
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Errorf("expected checks to run concurrently but took %s", elapsed)
+	}
+
+	if report.Status != StatusWarn || !report.Healthy() {
+		t.Errorf("expected a degraded report but was %s", report.Status)
+	}
+
+	result := report.Results[2]
+	if result.Status != StatusFail || result.Error != "timed out after 200ms" {
+		t.Errorf("expected the hanging check to time out but was %+v", result)
+	}
+
+	if report.Results[0].Latency < 100*time.Millisecond {
+		t.Errorf("expected the latency to be measured but was %s", report.Results[0].Latency)
+	}
+}
+
+func TestProbeShouldCacheReports(t *testing.T) {
+	database := newTestCheck(true, 10*time.Millisecond)
+	p := NewProbe(time.Minute, time.Second, Check{Name: "database", Critical: true, Check: database}).(*probe)
+
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Report()
+		}()
+	}
+	wg.Wait()
+
+	if runs := database.runs.Load(); runs != 1 {
+		t.Errorf("expected a single run but was %d", runs)
+	}
+
+	database.healthy.Store(false)
+	if healthy, _ := p.Check(context.Background()); !healthy {
+		t.Error("expected the cached report")
+	}
+
+	now = now.Add(time.Minute)
+	healthy, err := p.Check(context.Background())
+	if healthy || err == nil || err.Error() != "database: broken" {
+		t.Errorf("expected the probe to fail with the critical check but was %v", err)
+	}
+}
+
+func TestStartupProbeShouldPassForGood(t *testing.T) {
+	database := newTestCheck(false, 0)
+	p := NewStartupProbe(time.Nanosecond, time.Second, Check{Name: "database", Critical: true, Check: database})
+
+	if p.Report().Healthy() {
+		t.Fatal("expected the startup probe to fail")
+	}
+
+	database.healthy.Store(true)
+	if !p.Report().Healthy() {
+		t.Fatal("expected the startup probe to pass")
+	}
+
+	database.healthy.Store(false)
+	if !p.Report().Healthy() {
+		t.Error("expected the startup probe to keep passing")
+	}
+}
+
+func TestDiskCheckShouldReportFreeSpace(t *testing.T) {
+	details, err := NewDiskHealthCheck(t.TempDir(), 0).(DetailedCheck).CheckDetails(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if details["freeBytes"] == "" || details["totalBytes"] == "" {
+		t.Errorf("expected disk space details but was %v", details)
+	}
+
+	if healthy, _ := NewDiskHealthCheck(t.TempDir(), math.MaxUint64).Check(context.Background()); healthy {
+		t.Error("expected the disk check to fail without enough space")
+	}
+}
+
+func TestKeysCheckShouldPassForEveryTenant(t *testing.T) {
+	c := &config.Config{}
+	c.Encrypt.Secret = "bybBGV1Q1sSp9I2tVK0ysd1c"
+	c.Tenancy.Tenants = []config.Tenant{{Id: "a"}, {Id: "b"}}
+
+	tenants, err := tenant.NewRegistry(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	details, err := NewKeysHealthCheck(keys.NewProvider(config.NewStore(c)), tenants).(DetailedCheck).CheckDetails(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if details["tenants"] != "2" {
+		t.Errorf("expected both tenants to be checked but was %v", details)
+	}
+}
+
+type countingFactory struct {
+	database.DbFactory
+	opened atomic.Int32
+}
+
+func (f *countingFactory) InitDB(c context.Context) (*gorm.DB, func(), error) {
+	f.opened.Add(1)
+	return f.DbFactory.InitDB(c)
+}
+
+func TestPgCheckShouldReuseConnection(t *testing.T) {
+	c := &config.Config{}
+	c.Database.Provider = "sqlite"
+	c.Database.ConnectionString = "file::memory:"
+
+	loggerFactory := logger.NewTestLoggerFactory()
+	factory := &countingFactory{DbFactory: database.NewFactory(c, loggerFactory)}
+	check := NewPgHealthCheck(factory, loggerFactory)
+
+	for i := 0; i < 3; i++ {
+		if ok, err := check.Check(context.Background()); !ok || err != nil {
+			t.Fatalf("expected the check to pass but was %v", err)
+		}
+	}
+
+	if opened := factory.opened.Load(); opened != 1 {
+		t.Errorf("expected one connection to be opened but was %d", opened)
+	}
+}
@@ -0,0 +1,35 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// Readiness fails once the instance starts shutting down, so load balancers
+// and the service registry stop sending requests before the server stops
+// accepting them.
+type Readiness interface {
+	HealthCheck
+	Drain()
+}
+
+type readiness struct {
+	draining atomic.Bool
+}
+
+func NewReadiness() Readiness {
+	return &readiness{}
+}
+
+func (r *readiness) Check(context.Context) (bool, error) {
+	if r.draining.Load() {
+		return false, errors.New("shutting down")
+	}
+
+	return true, nil
+}
+
+func (r *readiness) Drain() {
+	r.draining.Store(true)
+}
@@ -0,0 +1,83 @@
+package helper
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BreachChecker looks passwords up in a breached password corpus.
+type BreachChecker interface {
+	// Count returns how many times the password was seen in breaches.
+	Count(string) (int, error)
+}
+
+// rangeBreachChecker reads a directory in the HIBP k-anonymity range format:
+// one file per 5 hex digit SHA-1 prefix (optionally with a .txt extension),
+// each line holding the remaining 35 hex digits and a count, e.g.
+// "0018A45C4D1DEF81644B54AB7F969B88D65:10".
+type rangeBreachChecker struct {
+	path string
+}
+
+type noopBreachChecker struct {
+}
+
+const rangePrefixLength = 5
+
+func NewBreachChecker(path string) BreachChecker {
+	if path == "" {
+		return &noopBreachChecker{}
+	}
+
+	return &rangeBreachChecker{
+		path: path,
+	}
+}
+
+func (c *rangeBreachChecker) Count(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:rangePrefixLength], hash[rangePrefixLength:]
+
+	file, err := c.openRange(prefix)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		candidate, count, found := strings.Cut(line, ":")
+		if !found || !strings.EqualFold(candidate, suffix) {
+			continue
+		}
+
+		return strconv.Atoi(count)
+	}
+
+	return 0, scanner.Err()
+}
+
+func (c *rangeBreachChecker) openRange(prefix string) (*os.File, error) {
+	file, err := os.Open(filepath.Join(c.path, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		return os.Open(filepath.Join(c.path, prefix+".txt"))
+	}
+
+	return file, err
+}
+
+func (c *noopBreachChecker) Count(string) (int, error) {
+	return 0, nil
+}
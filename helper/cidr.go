@@ -0,0 +1,56 @@
+package helper
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ParseCidrs parses an IP allowlist. Single addresses are accepted as well
+// and stand for a network of just that address.
+func ParseCidrs(values []string) ([]*net.IPNet, error) {
+	result := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", v)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", v)
+		}
+
+		result = append(result, network)
+	}
+
+	return result, nil
+}
+
+// IpAllowed reports whether ip belongs to one of networks. An unparsable ip
+// is never allowed.
+func IpAllowed(ip string, networks []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, n := range networks {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
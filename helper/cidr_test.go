@@ -0,0 +1,51 @@
+package helper
+
+import "testing"
+
+func TestParseCidrsShouldAcceptNetworksAndAddresses(t *testing.T) {
+	networks, err := ParseCidrs([]string{"10.8.0.0/16", " 192.168.1.10 ", "2001:db8::/32", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"10.8.0.0/16", "192.168.1.10/32", "2001:db8::/32", "::1/128"}
+	for i, n := range networks {
+		if n.String() != expected[i] {
+			t.Errorf("expected %s but was %s", expected[i], n)
+		}
+	}
+
+	for _, invalid := range []string{"", "10.8.0.0/33", "vpn", "10.8.0"} {
+		if _, err := ParseCidrs([]string{invalid}); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestIpAllowed(t *testing.T) {
+	networks, err := ParseCidrs([]string{"10.8.0.0/16", "192.168.1.10", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		ip      string
+		allowed bool
+	}{
+		{"10.8.3.4", true},
+		{"10.9.0.1", false},
+		{"192.168.1.10", true},
+		{"192.168.1.11", false},
+		{"::ffff:10.8.0.1", true},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+		{"", false},
+		{"not an ip", false},
+	}
+
+	for _, tc := range cases {
+		if IpAllowed(tc.ip, networks) != tc.allowed {
+			t.Errorf("expected %q allowed to be %v", tc.ip, tc.allowed)
+		}
+	}
+}
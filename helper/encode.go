@@ -3,7 +3,9 @@ package helper
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
 	"encoding/base64"
+	"errors"
 
 	"github.com/misikdmitriy/password-sharing/config"
 )
@@ -52,3 +54,54 @@ func (e *encoder) Decode(data string) (string, error) {
 	cfb.XORKeyStream(plainText, cipherText)
 	return string(plainText), nil
 }
+
+type aeadEncoder struct {
+	aead cipher.AEAD
+}
+
+// NewAeadEncoder encrypts with AES-GCM under key, every ciphertext carries
+// its own random nonce.
+func NewAeadEncoder(key []byte) (Encoder, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &aeadEncoder{
+		aead: aead,
+	}, nil
+}
+
+func (e *aeadEncoder) Encode(data string) (string, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := e.aead.Seal(nonce, nonce, []byte(data), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (e *aeadEncoder) Decode(data string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < e.aead.NonceSize() {
+		return "", errors.New("ciphertext is too short")
+	}
+
+	nonce, cipherText := sealed[:e.aead.NonceSize()], sealed[e.aead.NonceSize():]
+	plainText, err := e.aead.Open(nil, nonce, cipherText, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plainText), nil
+}
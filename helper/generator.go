@@ -0,0 +1,254 @@
+package helper
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+//go:embed wordlist.txt
+var wordlistData string
+
+var wordlist = strings.Fields(wordlistData)
+
+type GeneratorMode string
+
+const (
+	RandomMode        GeneratorMode = "random"
+	PassphraseMode    GeneratorMode = "passphrase"
+	PronounceableMode GeneratorMode = "pronounceable"
+)
+
+const (
+	DefaultPasswordLength   = 16
+	MinPasswordLength       = 8
+	MaxPasswordLength       = 128
+	DefaultPassphraseWords  = 5
+	MinPassphraseWords      = 3
+	MaxPassphraseWords      = 12
+	defaultPhraseSeparator  = "-"
+	maxPhraseSeparatorRunes = 3
+)
+
+const (
+	lowerChars      = "abcdefghijklmnopqrstuvwxyz"
+	upperChars      = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digitChars      = "0123456789"
+	symbolChars     = "!#$%&()*+,-./:;<=>?@[]^_{|}~"
+	vowelChars      = "aeiou"
+	consonantChars  = "bcdfghjklmnpqrstvwxz"
+	ambiguousChars  = "Il1|O0o"
+	maxClassRetries = 100
+)
+
+type GeneratorPolicy struct {
+	Mode             GeneratorMode
+	Length           int
+	Lower            bool
+	Upper            bool
+	Digits           bool
+	Symbols          bool
+	ExcludeAmbiguous bool
+	Words            int
+	Separator        string
+}
+
+type GeneratedPassword struct {
+	Password string
+	// Entropy is the estimated entropy in bits assuming the attacker knows
+	// the policy the password was generated with.
+	Entropy float64
+}
+
+type PasswordGenerator interface {
+	Generate(GeneratorPolicy) (*GeneratedPassword, error)
+}
+
+type passwordGenerator struct {
+	randomFactory RandomGeneratorFactory
+}
+
+func NewPasswordGenerator(rf RandomGeneratorFactory) PasswordGenerator {
+	return &passwordGenerator{
+		randomFactory: rf,
+	}
+}
+
+var ErrInvalidPolicy = errors.New("invalid generator policy")
+
+func (g *passwordGenerator) Generate(policy GeneratorPolicy) (*GeneratedPassword, error) {
+	switch policy.Mode {
+	case RandomMode, "":
+		return g.random(policy)
+	case PassphraseMode:
+		return g.passphrase(policy)
+	case PronounceableMode:
+		return g.pronounceable(policy)
+	default:
+		return nil, fmt.Errorf("%w: unknown mode %s", ErrInvalidPolicy, policy.Mode)
+	}
+}
+
+func (g *passwordGenerator) random(policy GeneratorPolicy) (*GeneratedPassword, error) {
+	length, err := passwordLength(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	if !policy.Lower && !policy.Upper && !policy.Digits && !policy.Symbols {
+		policy.Lower, policy.Upper, policy.Digits = true, true, true
+	}
+
+	var classes [][]rune
+	for _, class := range []struct {
+		enabled bool
+		chars   string
+	}{
+		{policy.Lower, lowerChars},
+		{policy.Upper, upperChars},
+		{policy.Digits, digitChars},
+		{policy.Symbols, symbolChars},
+	} {
+		if class.enabled {
+			classes = append(classes, filterAmbiguous(class.chars, policy.ExcludeAmbiguous))
+		}
+	}
+
+	if length < len(classes) {
+		return nil, fmt.Errorf("%w: length %d is too short for %d character classes", ErrInvalidPolicy, length, len(classes))
+	}
+
+	var alphabet []rune
+	for _, class := range classes {
+		alphabet = append(alphabet, class...)
+	}
+
+	rg := g.randomFactory.NewRandomGenerator()
+
+	// rejection sampling keeps the distribution uniform over all passwords
+	// that contain every requested class
+	for i := 0; i < maxClassRetries; i++ {
+		password, err := rg.RandomStringFrom(alphabet, length)
+		if err != nil {
+			return nil, err
+		}
+
+		if containsAll(password, classes) {
+			return &GeneratedPassword{
+				Password: password,
+				Entropy:  float64(length) * math.Log2(float64(len(alphabet))),
+			}, nil
+		}
+	}
+
+	return nil, errors.New("cannot generate password containing all character classes")
+}
+
+func (g *passwordGenerator) passphrase(policy GeneratorPolicy) (*GeneratedPassword, error) {
+	words := policy.Words
+	if words == 0 {
+		words = DefaultPassphraseWords
+	}
+
+	if words < MinPassphraseWords || words > MaxPassphraseWords {
+		return nil, fmt.Errorf("%w: words should be between %d and %d", ErrInvalidPolicy, MinPassphraseWords, MaxPassphraseWords)
+	}
+
+	separator := policy.Separator
+	if separator == "" {
+		separator = defaultPhraseSeparator
+	}
+
+	if len([]rune(separator)) > maxPhraseSeparatorRunes {
+		return nil, fmt.Errorf("%w: separator is too long", ErrInvalidPolicy)
+	}
+
+	rg := g.randomFactory.NewRandomGenerator()
+	phrase := make([]string, words)
+	for i := range phrase {
+		n, err := rg.RandomInt(len(wordlist))
+		if err != nil {
+			return nil, err
+		}
+
+		phrase[i] = wordlist[n]
+	}
+
+	return &GeneratedPassword{
+		Password: strings.Join(phrase, separator),
+		Entropy:  float64(words) * math.Log2(float64(len(wordlist))),
+	}, nil
+}
+
+func (g *passwordGenerator) pronounceable(policy GeneratorPolicy) (*GeneratedPassword, error) {
+	length, err := passwordLength(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	consonants := filterAmbiguous(consonantChars, policy.ExcludeAmbiguous)
+	vowels := filterAmbiguous(vowelChars, policy.ExcludeAmbiguous)
+
+	rg := g.randomFactory.NewRandomGenerator()
+	chars := make([]rune, length)
+	entropy := 0.0
+	for i := range chars {
+		alphabet := consonants
+		if i%2 == 1 {
+			alphabet = vowels
+		}
+
+		n, err := rg.RandomInt(len(alphabet))
+		if err != nil {
+			return nil, err
+		}
+
+		chars[i] = alphabet[n]
+		entropy += math.Log2(float64(len(alphabet)))
+	}
+
+	return &GeneratedPassword{
+		Password: string(chars),
+		Entropy:  entropy,
+	}, nil
+}
+
+func passwordLength(policy GeneratorPolicy) (int, error) {
+	length := policy.Length
+	if length == 0 {
+		length = DefaultPasswordLength
+	}
+
+	if length < MinPasswordLength || length > MaxPasswordLength {
+		return 0, fmt.Errorf("%w: length should be between %d and %d", ErrInvalidPolicy, MinPasswordLength, MaxPasswordLength)
+	}
+
+	return length, nil
+}
+
+func filterAmbiguous(chars string, exclude bool) []rune {
+	if !exclude {
+		return []rune(chars)
+	}
+
+	result := make([]rune, 0, len(chars))
+	for _, c := range chars {
+		if !strings.ContainsRune(ambiguousChars, c) {
+			result = append(result, c)
+		}
+	}
+
+	return result
+}
+
+func containsAll(password string, classes [][]rune) bool {
+	for _, class := range classes {
+		if !strings.ContainsAny(password, string(class)) {
+			return false
+		}
+	}
+
+	return true
+}
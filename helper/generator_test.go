@@ -0,0 +1,75 @@
+package helper
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerateShouldRespectPolicy(t *testing.T) {
+	generator := NewPasswordGenerator(NewRandomFactory())
+
+	cases := []struct {
+		name    string
+		policy  GeneratorPolicy
+		check   func(string) bool
+		entropy float64
+	}{
+		{
+			name:    "default random",
+			policy:  GeneratorPolicy{},
+			check:   func(p string) bool { return len(p) == DefaultPasswordLength },
+			entropy: 95.27,
+		},
+		{
+			name:   "digits without ambiguous",
+			policy: GeneratorPolicy{Mode: RandomMode, Length: 10, Digits: true, ExcludeAmbiguous: true},
+			check: func(p string) bool {
+				return len(p) == 10 && strings.Trim(p, "23456789") == ""
+			},
+			entropy: 30,
+		},
+		{
+			name:   "passphrase",
+			policy: GeneratorPolicy{Mode: PassphraseMode, Words: 4, Separator: " "},
+			check: func(p string) bool {
+				return len(strings.Split(p, " ")) == 4
+			},
+			entropy: 44,
+		},
+		{
+			name:   "pronounceable",
+			policy: GeneratorPolicy{Mode: PronounceableMode, Length: 8},
+			check: func(p string) bool {
+				return len(p) == 8 && strings.ContainsRune(vowelChars, rune(p[1]))
+			},
+			entropy: 4 * (4.32 + 2.32),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			generated, err := generator.Generate(tc.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !tc.check(generated.Password) {
+				t.Errorf("password '%s' does not match policy", generated.Password)
+			}
+
+			if diff := generated.Entropy - tc.entropy; diff > 0.1 || diff < -0.1 {
+				t.Errorf("expected entropy to be about %.2f but was %.2f", tc.entropy, generated.Entropy)
+			}
+		})
+	}
+}
+
+func TestGenerateShouldRejectInvalidPolicy(t *testing.T) {
+	generator := NewPasswordGenerator(NewRandomFactory())
+
+	_, err := generator.Generate(GeneratorPolicy{Length: MaxPasswordLength + 1})
+	if !errors.Is(err, ErrInvalidPolicy) {
+		t.Errorf("expected invalid policy error but was %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package helper
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+func Hash(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func HashEquals(data, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(data)), []byte(hash)) == 1
+}
+
+// Hasher computes keyed hashes. Without the key a hash cannot be matched by
+// hashing candidate values, so it is safe to show or store next to data that
+// is easy to guess.
+type Hasher interface {
+	Hash(string) string
+}
+
+type hmacHasher struct {
+	key []byte
+}
+
+const (
+	hasherKeyLength = 32
+	linkHashInfo    = "password-sharing link hash"
+)
+
+// NewKeyedHasher returns an HMAC-SHA256 hasher keyed with a key derived from
+// the master secret with HKDF, info separates the keys of different uses.
+func NewKeyedHasher(secret string, info string) Hasher {
+	key := make([]byte, hasherKeyLength)
+	// HKDF only fails when more than 255 hash lengths are read
+	io.ReadFull(hkdf.New(sha256.New, []byte(secret), nil, []byte(info)), key)
+
+	return &hmacHasher{
+		key: key,
+	}
+}
+
+// NewLinkHasher returns the hasher that identifies secrets to operators and
+// in the audit log.
+func NewLinkHasher(secret string) Hasher {
+	return NewKeyedHasher(secret, linkHashInfo)
+}
+
+func (h *hmacHasher) Hash(data string) string {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// passphrases are chosen by people, so unlike tokens they are hashed with a
+// salted, memory-hard function
+const (
+	scryptN       = 1 << 15
+	scryptR       = 8
+	scryptP       = 1
+	scryptKeyLen  = 32
+	scryptSaltLen = 16
+)
+
+// HashPassphrase returns the salt and the scrypt hash as "<salt>$<hash>".
+func HashPassphrase(passphrase string) (string, error) {
+	salt := make([]byte, scryptSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(salt) + "$" + hex.EncodeToString(key), nil
+}
+
+func PassphraseEquals(passphrase, hash string) bool {
+	encodedSalt, encodedKey, ok := strings.Cut(hash, "$")
+	if !ok {
+		return false
+	}
+
+	salt, err := hex.DecodeString(encodedSalt)
+	if err != nil {
+		return false
+	}
+
+	expected, err := hex.DecodeString(encodedKey)
+	if err != nil {
+		return false
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
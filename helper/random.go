@@ -1,17 +1,15 @@
 package helper
 
 import (
+	"crypto/rand"
 	"errors"
-	"math/rand"
-	"time"
+	"math/big"
 )
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
-
 type RandomGenerator interface {
 	RandomString(int) (string, error)
+	RandomStringFrom([]rune, int) (string, error)
+	RandomInt(int) (int, error)
 }
 
 type RandomGeneratorFactory interface {
@@ -35,14 +33,42 @@ func (f *randomGeneratorFactory) NewRandomGenerator() RandomGenerator {
 var symbols = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
 
 func (r *randomGenerator) RandomString(length int) (string, error) {
+	return r.RandomStringFrom(symbols, length)
+}
+
+func (r *randomGenerator) RandomStringFrom(alphabet []rune, length int) (string, error) {
 	if length <= 0 {
 		return "", errors.New("requested string should have positive length")
 	}
 
+	if len(alphabet) == 0 {
+		return "", errors.New("alphabet should not be empty")
+	}
+
 	chars := make([]rune, length)
 	for i := range chars {
-		chars[i] = symbols[rand.Intn(len(symbols))]
+		n, err := r.RandomInt(len(alphabet))
+		if err != nil {
+			return "", err
+		}
+
+		chars[i] = alphabet[n]
 	}
 
 	return string(chars), nil
 }
+
+// RandomInt returns a uniformly distributed number in [0, max) read from
+// crypto/rand.
+func (r *randomGenerator) RandomInt(max int) (int, error) {
+	if max <= 0 {
+		return 0, errors.New("upper bound should be positive")
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n.Int64()), nil
+}
@@ -0,0 +1,313 @@
+package helper
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"unicode"
+)
+
+//go:embed common.txt
+var commonData string
+
+var commonPasswords = rankedDictionary(strings.Fields(commonData))
+
+// english words are not frequency ordered, so all of them share the same rank
+// placed after the common passwords
+var englishWords = uniformDictionary(wordlist, len(commonPasswords)+len(wordlist)/2)
+
+const (
+	bruteforceCardinality = 10
+	minSubmatchGuesses    = 10
+	minWordLength         = 3
+	minSequenceLength     = 3
+	minRepeatLength       = 3
+	minSpatialLength      = 4
+	// only a prefix is scored, matching is cubic in the length, and the
+	// runes beyond it count as brute force
+	maxEstimatedRunes = 100
+	// keeps GuessesLog10 finite, it is far beyond any score
+	maxGuesses = 1e100
+)
+
+var keyboardRows = []string{
+	"`1234567890-=",
+	"qwertyuiop[]\\",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+	"1qaz2wsx3edc4rfv5tgb6yhn7ujm8ik9ol0p",
+}
+
+var sequences = []string{
+	"abcdefghijklmnopqrstuvwxyz",
+	"0123456789",
+}
+
+var leetSubstitutions = strings.NewReplacer(
+	"4", "a", "@", "a", "8", "b", "3", "e", "6", "g", "1", "i", "!", "i",
+	"0", "o", "5", "s", "$", "s", "7", "t", "+", "t", "2", "z",
+)
+
+// Strength is a zxcvbn-style estimation: the password is split into the
+// cheapest sequence of known patterns and the number of guesses an attacker
+// needs is the product of guesses of every pattern.
+type Strength struct {
+	Score        int
+	GuessesLog10 float64
+	Warnings     []string
+}
+
+type StrengthEstimator interface {
+	Estimate(string) *Strength
+}
+
+type strengthEstimator struct {
+}
+
+func NewStrengthEstimator() StrengthEstimator {
+	return &strengthEstimator{}
+}
+
+type match struct {
+	start   int
+	end     int
+	guesses float64
+	warning string
+}
+
+func (e *strengthEstimator) Estimate(password string) *Strength {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return &Strength{Warnings: []string{"password is empty"}}
+	}
+
+	rest := 0
+	if len(runes) > maxEstimatedRunes {
+		rest = len(runes) - maxEstimatedRunes
+		runes = runes[:maxEstimatedRunes]
+	}
+
+	matches := findMatches(runes)
+
+	// best[i] holds the minimal guesses needed for the first i runes
+	best := make([]float64, len(runes)+1)
+	chosen := make([]*match, len(runes)+1)
+	best[0] = 1
+	for i := 1; i <= len(runes); i++ {
+		best[i] = best[i-1] * bruteforceCardinality
+
+		for j := range matches {
+			m := &matches[j]
+			if m.end != i {
+				continue
+			}
+
+			if guesses := best[m.start] * m.guesses; guesses < best[i] {
+				best[i] = guesses
+				chosen[i] = m
+			}
+		}
+	}
+
+	warnings := make([]string, 0)
+	seen := make(map[string]bool)
+	for i := len(runes); i > 0; {
+		m := chosen[i]
+		if m == nil {
+			i--
+			continue
+		}
+
+		if !seen[m.warning] {
+			seen[m.warning] = true
+			warnings = append(warnings, m.warning)
+		}
+		i = m.start
+	}
+
+	guesses := math.Min(best[len(runes)]*math.Pow(bruteforceCardinality, float64(rest)), maxGuesses)
+	return &Strength{
+		Score:        score(guesses),
+		GuessesLog10: math.Round(math.Log10(guesses)*100) / 100,
+		Warnings:     warnings,
+	}
+}
+
+func score(guesses float64) int {
+	switch {
+	case guesses < 1e3:
+		return 0
+	case guesses < 1e6:
+		return 1
+	case guesses < 1e8:
+		return 2
+	case guesses < 1e10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func findMatches(runes []rune) []match {
+	var matches []match
+	lower := strings.ToLower(string(runes))
+	lowerRunes := []rune(lower)
+	unleet := []rune(leetSubstitutions.Replace(lower))
+
+	for i := 0; i < len(runes); i++ {
+		for j := i + minWordLength; j <= len(runes); j++ {
+			word := string(lowerRunes[i:j])
+			variations := uppercaseVariations(runes[i:j])
+
+			if rank, ok := commonPasswords[word]; ok {
+				matches = append(matches, match{i, j, float64(rank) * variations, "password is commonly used"})
+			} else if rank, ok := englishWords[word]; ok {
+				matches = append(matches, match{i, j, float64(rank) * variations, "dictionary words are easy to guess"})
+			}
+
+			// l33t substitutions map one rune to one rune, so indexes are kept
+			if len(unleet) != len(lowerRunes) {
+				continue
+			}
+
+			leet := string(unleet[i:j])
+			if leet == word {
+				continue
+			}
+
+			if rank, ok := commonPasswords[leet]; ok {
+				matches = append(matches, match{i, j, float64(rank) * variations * 2, "predictable substitutions do not help much"})
+			} else if rank, ok := englishWords[leet]; ok {
+				matches = append(matches, match{i, j, float64(rank) * variations * 2, "predictable substitutions do not help much"})
+			}
+		}
+	}
+
+	matches = append(matches, repeatMatches(lowerRunes)...)
+	matches = append(matches, sequenceMatches(lowerRunes)...)
+	matches = append(matches, spatialMatches(lowerRunes)...)
+
+	return matches
+}
+
+func repeatMatches(runes []rune) []match {
+	var matches []match
+	for i := 0; i < len(runes); {
+		j := i + 1
+		for j < len(runes) && runes[j] == runes[i] {
+			j++
+		}
+
+		if j-i >= minRepeatLength {
+			matches = append(matches, match{i, j, math.Max(minSubmatchGuesses, float64(bruteforceCardinality*(j-i))), "repeated characters are easy to guess"})
+		}
+		i = j
+	}
+
+	return matches
+}
+
+func sequenceMatches(runes []rune) []match {
+	var matches []match
+	for _, seq := range sequences {
+		matches = append(matches, runMatches(runes, seq, minSequenceLength, "sequences like abc or 123 are easy to guess")...)
+		matches = append(matches, runMatches(runes, reverse(seq), minSequenceLength, "sequences like abc or 123 are easy to guess")...)
+	}
+
+	return matches
+}
+
+func spatialMatches(runes []rune) []match {
+	var matches []match
+	for _, row := range keyboardRows {
+		matches = append(matches, runMatches(runes, row, minSpatialLength, "keyboard patterns are easy to guess")...)
+		matches = append(matches, runMatches(runes, reverse(row), minSpatialLength, "keyboard patterns are easy to guess")...)
+	}
+
+	return matches
+}
+
+// runMatches finds maximal substrings of runes which are also consecutive
+// substrings of alphabet.
+func runMatches(runes []rune, alphabet string, minLength int, warning string) []match {
+	var matches []match
+	chars := []rune(alphabet)
+	for i := 0; i < len(runes); {
+		pos := indexRune(chars, runes[i])
+		if pos < 0 {
+			i++
+			continue
+		}
+
+		j := i + 1
+		for k := pos + 1; j < len(runes) && k < len(chars) && runes[j] == chars[k]; k++ {
+			j++
+		}
+
+		if j-i >= minLength {
+			matches = append(matches, match{i, j, float64(len(chars) * (j - i)), warning})
+			i = j
+			continue
+		}
+		i++
+	}
+
+	return matches
+}
+
+func uppercaseVariations(runes []rune) float64 {
+	upper := 0
+	for _, r := range runes {
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+
+	switch {
+	case upper == 0:
+		return 1
+	case upper == len(runes) || (upper == 1 && unicode.IsUpper(runes[0])):
+		return 2
+	default:
+		return math.Pow(2, float64(upper))
+	}
+}
+
+func rankedDictionary(words []string) map[string]int {
+	result := make(map[string]int, len(words))
+	for i, word := range words {
+		if _, ok := result[word]; !ok {
+			result[word] = i + 1
+		}
+	}
+
+	return result
+}
+
+func uniformDictionary(words []string, rank int) map[string]int {
+	result := make(map[string]int, len(words))
+	for _, word := range words {
+		result[word] = rank
+	}
+
+	return result
+}
+
+func indexRune(runes []rune, r rune) int {
+	for i, c := range runes {
+		if c == r {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+
+	return string(runes)
+}
@@ -0,0 +1,91 @@
+package helper
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEstimateShouldScorePasswords(t *testing.T) {
+	estimator := NewStrengthEstimator()
+
+	cases := []struct {
+		password string
+		minScore int
+		maxScore int
+	}{
+		{"password", 0, 0},
+		{"qwerty123", 0, 0},
+		{"P@ssw0rd", 0, 0},
+		{"aaaaaaaaaaaa", 0, 0},
+		{"abcdefgh", 0, 0},
+		{"zebra-ocean-robot", 3, 4},
+		{"x7#Kq9!vLm2$Pw4z", 4, 4},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.password, func(t *testing.T) {
+			strength := estimator.Estimate(tc.password)
+			if strength.Score < tc.minScore || strength.Score > tc.maxScore {
+				t.Errorf("expected score of '%s' to be in [%d, %d] but was %d",
+					tc.password, tc.minScore, tc.maxScore, strength.Score)
+			}
+		})
+	}
+}
+
+func TestEstimateShouldBoundLongPasswords(t *testing.T) {
+	estimator := NewStrengthEstimator()
+
+	done := make(chan *Strength)
+	go func() {
+		done <- estimator.Estimate(strings.Repeat("x7#Kq9!vLm2$Pw4z", 1000))
+	}()
+
+	select {
+	case strength := <-done:
+		if math.IsInf(strength.GuessesLog10, 0) || math.IsNaN(strength.GuessesLog10) || strength.Score != 4 {
+			t.Errorf("expected a finite estimate with the top score but was %+v", strength)
+		}
+
+		if _, err := json.Marshal(strength); err != nil {
+			t.Errorf("expected the estimate to be serializable but was %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a long password to be estimated quickly")
+	}
+}
+
+func TestBreachCheckerShouldFindPasswordInRangeFile(t *testing.T) {
+	dir := t.TempDir()
+
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	content := "003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9659365\r\n"
+	if err := os.WriteFile(filepath.Join(dir, "5BAA6"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := NewBreachChecker(dir)
+
+	count, err := checker.Count("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 9659365 {
+		t.Errorf("expected count to be %d but was %d", 9659365, count)
+	}
+
+	count, err = checker.Count("not in corpus")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 0 {
+		t.Errorf("expected count to be 0 but was %d", count)
+	}
+}
@@ -0,0 +1,103 @@
+package keys
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/helper"
+	"golang.org/x/crypto/hkdf"
+)
+
+// LegacyKeyId marks secrets stored before tenants existed. They are
+// encrypted with the master key itself.
+const LegacyKeyId = ""
+
+const (
+	DefaultKeyId = "v1"
+	dekLength    = 32
+	dekInfo      = "password-sharing data key "
+)
+
+// Provider hands out the data encryption keys of tenants. Every tenant has
+// its own key, so a secret of one tenant cannot be decrypted with the key of
+// another.
+type Provider interface {
+	// Active returns the encoder new secrets of a tenant are encrypted with
+	// and the id of its key, which is stored next to the secret.
+	Active(string) (helper.Encoder, string, error)
+	// Encoder returns the encoder of a tenant for a stored key id.
+	Encoder(string, string) (helper.Encoder, error)
+}
+
+type derivedProvider struct {
+	configuration config.Source
+
+	mu       sync.Mutex
+	encoders map[dataKey]helper.Encoder
+}
+
+type dataKey struct {
+	tenantId string
+	keyId    string
+}
+
+// NewProvider derives tenant keys from the master secret with HKDF, the key
+// id is the salt and the tenant id is part of the info. Nothing but the
+// master secret needs to be stored. The active key id follows reloads of
+// encrypt.keyid.
+func NewProvider(conf config.Source) Provider {
+	return &derivedProvider{
+		configuration: conf,
+		encoders:      map[dataKey]helper.Encoder{},
+	}
+}
+
+func (p *derivedProvider) Active(tenantId string) (helper.Encoder, string, error) {
+	keyId := p.configuration.Current().Encrypt.KeyId
+	if keyId == "" {
+		keyId = DefaultKeyId
+	}
+
+	encoder, err := p.Encoder(tenantId, keyId)
+	return encoder, keyId, err
+}
+
+func (p *derivedProvider) Encoder(tenantId string, keyId string) (helper.Encoder, error) {
+	if keyId == LegacyKeyId {
+		return helper.NewEncoder(p.configuration.Current()), nil
+	}
+
+	if tenantId == "" {
+		return nil, errors.New("tenant is required")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	k := dataKey{tenantId: tenantId, keyId: keyId}
+	if encoder, ok := p.encoders[k]; ok {
+		return encoder, nil
+	}
+
+	secret := p.configuration.Current().Encrypt.Secret
+	if secret == "" {
+		return nil, errors.New("master secret is not configured")
+	}
+
+	dek := make([]byte, dekLength)
+	kdf := hkdf.New(sha256.New, []byte(secret), []byte(keyId), []byte(dekInfo+tenantId))
+	if _, err := io.ReadFull(kdf, dek); err != nil {
+		return nil, err
+	}
+
+	encoder, err := helper.NewAeadEncoder(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	p.encoders[k] = encoder
+	return encoder, nil
+}
@@ -0,0 +1,77 @@
+package keys
+
+import (
+	"testing"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/helper"
+)
+
+func TestProviderShouldDeriveKeyPerTenant(t *testing.T) {
+	c := &config.Config{}
+	c.Encrypt.Secret = "123456789123456789012345"
+	c.Encrypt.IV = []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+	p := NewProvider(config.NewStore(c))
+
+	finance, keyId, err := p.Active("finance")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keyId != DefaultKeyId {
+		t.Errorf("expected key id to be %s but was %s", DefaultKeyId, keyId)
+	}
+
+	encoded, err := finance.Encode("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a second provider derives the same key from the same master secret
+	same, err := NewProvider(config.NewStore(c)).Encoder("finance", keyId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded, err := same.Decode(encoded); err != nil || decoded != "secret" {
+		t.Errorf("expected derived key to be stable but was %v", err)
+	}
+
+	for _, other := range []struct {
+		tenantId string
+		keyId    string
+	}{
+		{"engineering", keyId},
+		{"finance", "v2"},
+	} {
+		encoder, err := p.Encoder(other.tenantId, other.keyId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = encoder.Decode(encoded); err == nil {
+			t.Errorf("expected key of %s/%s not to decrypt", other.tenantId, other.keyId)
+		}
+	}
+}
+
+func TestProviderShouldDecodeLegacySecrets(t *testing.T) {
+	c := &config.Config{}
+	c.Encrypt.Secret = "123456789123456789012345"
+	c.Encrypt.IV = []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+	encoded, err := helper.NewEncoder(c).Encode("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoder, err := NewProvider(config.NewStore(c)).Encoder("default", LegacyKeyId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded, err := encoder.Decode(encoded); err != nil || decoded != "secret" {
+		t.Errorf("expected legacy secret to decode but was %v", err)
+	}
+}
@@ -1,10 +1,8 @@
 package logger
 
 import (
-	"fmt"
+	"io"
 	"os"
-	"path"
-	"time"
 
 	"github.com/misikdmitriy/password-sharing/config"
 	"go.uber.org/zap"
@@ -12,34 +10,33 @@ import (
 )
 
 type LoggerFactory interface {
+	// NewLogger returns a logger and a function to call once it is no
+	// longer used.
 	NewLogger() (*zap.Logger, func(), error)
 }
 
 type loggerFactory struct {
-	configuration *config.Config
+	log *zap.Logger
 }
 
 type testLoggerFactory struct {
 }
 
-func NewLoggerFactory(configuration *config.Config) LoggerFactory {
-	return &loggerFactory{
-		configuration: configuration,
-	}
+// NewLoggerFactory builds the logger every component shares, it writes JSON
+// to zap.file in zap.logspath and text to stdout. A reloaded zap.level
+// applies at once. The returned function flushes and closes the file.
+func NewLoggerFactory(configuration config.Source) (LoggerFactory, func()) {
+	return newLoggerFactory(configuration, os.Stdout)
 }
 
-func NewTestLoggerFactory() LoggerFactory {
-	return &testLoggerFactory{}
-}
+func newLoggerFactory(configuration config.Source, console io.Writer) (LoggerFactory, func()) {
+	level := zap.NewAtomicLevelAt(configuration.Current().Zap.Level)
+	configuration.Subscribe(func(c *config.Config) {
+		level.SetLevel(c.Zap.Level)
+	})
 
-func (lf *loggerFactory) NewLogger() (*zap.Logger, func(), error) {
-	now := time.Now()
-	logfile := path.Join(lf.configuration.Zap.LogsPath, fmt.Sprintf("%s.log", now.Format("2006-01-02-15")))
-
-	file, err := os.OpenFile(logfile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return nil, nil, err
-	}
+	file := newRotatingFile(configuration.Current())
+	go file.run()
 
 	pe := zap.NewProductionEncoderConfig()
 
@@ -48,17 +45,27 @@ func (lf *loggerFactory) NewLogger() (*zap.Logger, func(), error) {
 	consoleEncoder := zapcore.NewConsoleEncoder(pe)
 
 	core := zapcore.NewTee(
-		zapcore.NewCore(fileEncoder, zapcore.AddSync(file), lf.configuration.Zap.Level),
-		zapcore.NewCore(consoleEncoder, zapcore.AddSync(os.Stdout), lf.configuration.Zap.Level),
+		zapcore.NewCore(fileEncoder, zapcore.AddSync(file), level),
+		zapcore.NewCore(consoleEncoder, zapcore.Lock(zapcore.AddSync(console)), level),
 	)
 
 	log := zap.New(core, zap.AddCaller(), zap.AddStacktrace(zap.WarnLevel))
 	close := func() {
 		log.Sync()
-		file.Close()
+		file.close()
 	}
 
-	return log, close, nil
+	return &loggerFactory{log: log}, close
+}
+
+func NewTestLoggerFactory() LoggerFactory {
+	return &testLoggerFactory{}
+}
+
+// NewLogger returns the shared logger, closing it is up to the owner of the
+// factory.
+func (lf *loggerFactory) NewLogger() (*zap.Logger, func(), error) {
+	return lf.log, func() {}, nil
 }
 
 func (lf *testLoggerFactory) NewLogger() (*zap.Logger, func(), error) {
@@ -0,0 +1,171 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	"go.uber.org/zap"
+)
+
+func testConfig(t *testing.T) *config.Config {
+	c := &config.Config{}
+	c.Zap.LogsPath = t.TempDir()
+	c.Zap.File = "test.log"
+	c.Zap.Rotation.MaxSize = 1
+
+	return c
+}
+
+// lines returns the lines of every log in dir, rotated ones included.
+func lines(t *testing.T, dir string) (int, []string) {
+	files, err := filepath.Glob(filepath.Join(dir, "test*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result []string
+	for _, name := range files {
+		file, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			result = append(result, scanner.Text())
+		}
+
+		file.Close()
+		if err = scanner.Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return len(files), result
+}
+
+func TestLoggerShouldWriteConcurrentlyAcrossRotations(t *testing.T) {
+	c := testConfig(t)
+	factory, closeLogger := newLoggerFactory(config.NewStore(c), io.Discard)
+
+	const workers, entries = 8, 2000
+	padding := strings.Repeat("x", 100)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+
+			for n := 0; n < entries; n++ {
+				appLogger, loggerClose, err := factory.NewLogger()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				appLogger.Info("entry", zap.Int("worker", worker), zap.Int("n", n), zap.String("padding", padding))
+				loggerClose()
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	closeLogger()
+
+	files, written := lines(t, c.Zap.LogsPath)
+	if files < 2 {
+		t.Errorf("expected the file to be rotated by size but there were %d files", files)
+	}
+
+	seen := map[string]bool{}
+	for _, line := range written {
+		var entry struct {
+			Msg    string `json:"msg"`
+			Worker int    `json:"worker"`
+			N      int    `json:"n"`
+		}
+
+		if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.Msg != "entry" {
+			t.Fatalf("expected whole entries but got %q", line)
+		}
+
+		seen[fmt.Sprintf("%d-%d", entry.Worker, entry.N)] = true
+	}
+
+	if len(written) != workers*entries || len(seen) != workers*entries {
+		t.Errorf("expected %d distinct entries but was %d lines with %d distinct", workers*entries, len(written), len(seen))
+	}
+}
+
+func TestRotatingFileShouldRotateAndReopen(t *testing.T) {
+	c := testConfig(t)
+	f := newRotatingFile(c)
+
+	// nothing to rotate yet
+	f.rotate()
+	if files, _ := lines(t, c.Zap.LogsPath); files != 0 {
+		t.Errorf("expected no files but was %d", files)
+	}
+
+	fmt.Fprintln(f, "first")
+	f.rotate()
+	fmt.Fprintln(f, "second")
+
+	// logrotate moves the file away and asks for a reopen
+	moved := filepath.Join(c.Zap.LogsPath, "moved.log")
+	if err := os.Rename(f.Filename, moved); err != nil {
+		t.Fatal(err)
+	}
+
+	f.reopen()
+	fmt.Fprintln(f, "third")
+
+	if err := f.Logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"first\n": "rotated", "second\n": "moved.log", "third\n": "test.log"}
+	entries, err := os.ReadDir(c.Zap.LogsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 files but was %d", len(entries))
+	}
+
+	for _, entry := range entries {
+		content, err := os.ReadFile(filepath.Join(c.Zap.LogsPath, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		name, ok := expected[string(content)]
+		if !ok || (name != "rotated" && name != entry.Name()) || (name == "rotated" && !strings.HasPrefix(entry.Name(), "test-")) {
+			t.Errorf("unexpected %s with %q", entry.Name(), content)
+		}
+	}
+}
+
+func TestNextRotationShouldAlignToInterval(t *testing.T) {
+	now := time.Date(2022, 9, 1, 10, 42, 7, 0, time.UTC)
+
+	if next := nextRotation(now, time.Hour); !next.Equal(time.Date(2022, 9, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the next hour but was %v", next)
+	}
+
+	if next := nextRotation(now, 15*time.Minute); !next.Equal(time.Date(2022, 9, 1, 10, 45, 0, 0, time.UTC)) {
+		t.Errorf("expected the next quarter but was %v", next)
+	}
+}
@@ -0,0 +1,105 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const day = 24 * time.Hour
+
+// rotatingFile is the log file. lumberjack rotates it by size, removes and
+// compresses old files and serializes writes, rotations by time and reopens
+// happen here.
+type rotatingFile struct {
+	*lumberjack.Logger
+	interval time.Duration
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+func newRotatingFile(conf *config.Config) *rotatingFile {
+	rotation := conf.Zap.Rotation
+
+	return &rotatingFile{
+		Logger: &lumberjack.Logger{
+			Filename:   path.Join(conf.Zap.LogsPath, conf.Zap.File),
+			MaxSize:    rotation.MaxSize,
+			MaxAge:     int((rotation.MaxAge + day - 1) / day),
+			MaxBackups: rotation.MaxBackups,
+			Compress:   rotation.Compress,
+			LocalTime:  true,
+		},
+		interval: rotation.Interval,
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// run rotates at every multiple of the interval and reopens the file on
+// SIGHUP, e.g. after logrotate moved it, until close.
+func (f *rotatingFile) run() {
+	defer close(f.stopped)
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	var timer *time.Timer
+	var rotations <-chan time.Time
+	if f.interval > 0 {
+		timer = time.NewTimer(time.Until(nextRotation(time.Now(), f.interval)))
+		defer timer.Stop()
+
+		rotations = timer.C
+	}
+
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-hangups:
+			f.reopen()
+		case <-rotations:
+			f.rotate()
+			timer.Reset(time.Until(nextRotation(time.Now(), f.interval)))
+		}
+	}
+}
+
+// rotate skips empty files, an idle instance would leave one per interval.
+func (f *rotatingFile) rotate() {
+	info, err := os.Stat(f.Filename)
+	if err != nil || info.Size() == 0 {
+		return
+	}
+
+	if err = f.Rotate(); err != nil {
+		// the file is what failed, so the error goes to stderr
+		fmt.Fprintf(os.Stderr, "cannot rotate %s: %v\n", f.Filename, err)
+	}
+}
+
+// reopen closes the file, the next write opens it again by name.
+func (f *rotatingFile) reopen() {
+	if err := f.Logger.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "cannot reopen %s: %v\n", f.Filename, err)
+	}
+}
+
+func (f *rotatingFile) close() error {
+	close(f.stop)
+	<-f.stopped
+
+	return f.Logger.Close()
+}
+
+func nextRotation(now time.Time, interval time.Duration) time.Time {
+	return now.Truncate(interval).Add(interval)
+}
@@ -1,40 +1,244 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/audit"
+	"github.com/misikdmitriy/password-sharing/auth"
+	"github.com/misikdmitriy/password-sharing/challenge"
 	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/consulkv"
 	"github.com/misikdmitriy/password-sharing/controller"
 	"github.com/misikdmitriy/password-sharing/database"
+	"github.com/misikdmitriy/password-sharing/discovery"
 	"github.com/misikdmitriy/password-sharing/health"
 	"github.com/misikdmitriy/password-sharing/helper"
+	"github.com/misikdmitriy/password-sharing/keys"
 	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/notify"
+	"github.com/misikdmitriy/password-sharing/ratelimit"
+	"github.com/misikdmitriy/password-sharing/reload"
 	"github.com/misikdmitriy/password-sharing/server"
 	"github.com/misikdmitriy/password-sharing/service"
+	"github.com/misikdmitriy/password-sharing/tenant"
 )
 
 func main() {
-	appConfiguration, err := config.LoadConfig()
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := configCommand(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	kv, err := loadKv(config.FileName())
 	if err != nil {
 		panic(err)
 	}
 
-	appLogger := logger.NewLoggerFactory(appConfiguration)
+	appConfiguration, err := config.LoadConfig(kv)
+	if err != nil {
+		panic(err)
+	}
+
+	// reloadable keys are read from the store, see config.Store
+	configStore := config.NewStore(appConfiguration)
+	appLogger, closeLogger := logger.NewLoggerFactory(configStore)
+	defer closeLogger()
+
+	tenants, err := tenant.NewReloadingRegistry(configStore)
+	if err != nil {
+		panic(err)
+	}
 
-	encoder := helper.NewEncoder(appConfiguration)
+	keyProvider := keys.NewProvider(configStore)
 	databaseFactory := database.NewFactory(appConfiguration, appLogger)
+	if err = database.Migrate(context.Background(), databaseFactory, tenants.Default().Id, helper.NewLinkHasher(appConfiguration.Encrypt.Secret)); err != nil {
+		panic(err)
+	}
+
+	notifier, err := notify.NewNotifier(appConfiguration, appLogger)
+	if err != nil {
+		panic(err)
+	}
+
+	recorder, err := audit.NewRecorder(appConfiguration, databaseFactory, appLogger)
+	if err != nil {
+		panic(err)
+	}
+
 	randomFactory := helper.NewRandomFactory()
-	service := service.NewPasswordService(databaseFactory, appConfiguration, randomFactory, appLogger, encoder)
+	passwordService := service.NewPasswordService(databaseFactory, appConfiguration, randomFactory, appLogger, keyProvider, tenants,
+		helper.NewStrengthEstimator(), helper.NewBreachChecker(appConfiguration.Strength.BreachPath), notifier, recorder)
+	requestService := service.NewSecretRequestService(databaseFactory, configStore, randomFactory, appLogger, tenants, passwordService)
+	generatorService := service.NewGeneratorService(helper.NewPasswordGenerator(randomFactory), appLogger)
+	apiKeyService := service.NewApiKeyService(databaseFactory, randomFactory, appLogger)
+	adminService := service.NewAdminService(databaseFactory, appLogger, recorder, tenants)
+	idempotencyService := service.NewIdempotencyService(databaseFactory, appConfiguration, appLogger, keyProvider, tenants)
+
+	if len(os.Args) > 1 {
+		if err = runCommand(os.Args[1:], apiKeyService, tenants, databaseFactory); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	var jwtAuthenticator auth.Authenticator
+	if appConfiguration.Auth.Jwt.Enabled {
+		keys, err := auth.NewKeySource(appConfiguration)
+		if err != nil {
+			panic(err)
+		}
+
+		jwtAuthenticator = auth.NewJwtAuthenticator(keys, appConfiguration, appLogger)
+	}
+
+	limiter, err := ratelimit.NewLimiter(configStore, databaseFactory, appLogger)
+	if err != nil {
+		panic(err)
+	}
+
+	challenges, err := challenge.NewIssuer(appConfiguration, databaseFactory)
+	if err != nil {
+		panic(err)
+	}
+
+	readiness := health.NewReadiness()
+	live, ready, startup, err := newProbes(appConfiguration, databaseFactory, appLogger, keyProvider, tenants, readiness)
+	if err != nil {
+		panic(err)
+	}
+
+	registrar, err := discovery.NewRegistrar(appConfiguration, appLogger, ready)
+	if err != nil {
+		panic(err)
+	}
 
-	pgHealthCheck := health.NewPgHealthCheck(databaseFactory, appLogger)
+	controllers := []controller.Controller{
+		controller.NewCreateLinkController(passwordService, idempotencyService, appConfiguration, challenges),
+		controller.NewGetLinkController(passwordService),
+		controller.NewLinkStatusController(passwordService),
+		controller.NewCreateRequestController(requestService, appConfiguration),
+		controller.NewGetRequestController(requestService),
+		controller.NewFulfillRequestController(requestService),
+		controller.NewGetRequestSecretController(requestService),
+		controller.NewGenerateController(generatorService, passwordService, appConfiguration, challenges),
+		controller.NewPublicHealthController("/health", ready),
+	}
+	if challenges != nil {
+		controllers = append(controllers, controller.NewChallengeController(challenges))
+	}
 
 	server := server.NewServer(
 		appLogger,
 		appConfiguration,
-		controller.NewCreateLinkController(service, appConfiguration),
-		controller.NewGetLinkController(service),
-		controller.NewHealthController(pgHealthCheck),
+		auth.NewCompositeAuthenticator(apiKeyService, jwtAuthenticator),
+		tenants,
+		limiter,
+		registrar,
+		[]controller.Controller{
+			controller.NewAdminStatsController(adminService),
+			controller.NewAdminDeleteSecretController(adminService),
+			controller.NewAdminPurgeController(adminService),
+			controller.NewAdminApiKeysController(adminService),
+			controller.NewAdminRevokeApiKeyController(adminService),
+			controller.NewAdminAuditController(adminService),
+		},
+		// served on the admin port
+		[]controller.Controller{
+			controller.NewHealthController("/health", ready),
+			controller.NewHealthController("/health/live", live),
+			controller.NewHealthController("/health/ready", ready),
+			controller.NewHealthController("/health/startup", startup),
+			controller.NewBuildInfoController(),
+		},
+		controllers...,
 	)
 
+	watcher := reload.NewWatcher(config.FileName(), configStore, appLogger, kv)
+	watchContext, stopWatching := context.WithCancel(context.Background())
+	go watcher.Run(watchContext)
+	go kv.Watch(watchContext, appLogger, watcher.Notify)
+
+	server.OnDrain(readiness.Drain)
+	server.OnStop("config", func(context.Context) error {
+		stopWatching()
+		return nil
+	})
+	server.OnStop("audit", func(context.Context) error {
+		return recorder.Close()
+	})
+
 	if err = server.Run(); err != nil {
 		panic(err)
 	}
 }
+
+const kvLoadTimeout = 10 * time.Second
+
+// loadKv reads the settings of the Consul KV layer from file and its keys.
+// A configuration that cannot be completed fails the startup.
+func loadKv(file string) (consulkv.Layer, error) {
+	bootstrap, err := config.Read(file)
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := consulkv.NewLayer(bootstrap)
+	if err != nil {
+		return nil, err
+	}
+
+	c, cancel := context.WithTimeout(context.Background(), kvLoadTimeout)
+	defer cancel()
+
+	if err = kv.Load(c); err != nil {
+		return nil, fmt.Errorf("cannot read consul kv: %w", err)
+	}
+
+	return kv, nil
+}
+
+// newProbes returns the liveness, readiness and startup probes. Liveness
+// has no checks, an instance that answers is alive and restarting it would
+// not fix its dependencies.
+func newProbes(conf *config.Config,
+	databaseFactory database.DbFactory,
+	loggerFactory logger.LoggerFactory,
+	keyProvider keys.Provider,
+	tenants tenant.Registry,
+	readiness health.Readiness) (health.Probe, health.Probe, health.Probe, error) {
+	interval, timeout := conf.Health.CacheInterval, conf.Health.Timeout
+
+	dbCheck := health.Check{Name: "database", Critical: true, Check: health.NewPgHealthCheck(databaseFactory, loggerFactory)}
+	keysCheck := health.Check{Name: "keys", Critical: true, Check: health.NewKeysHealthCheck(keyProvider, tenants)}
+
+	checks := []health.Check{
+		{Name: "shutdown", Critical: true, Check: readiness},
+		dbCheck,
+		keysCheck,
+		{Name: "disk", Check: health.NewDiskHealthCheck(conf.Zap.LogsPath, conf.Health.MinFreeDisk)},
+	}
+
+	if provider := conf.Discovery.Provider; provider == discovery.ProviderConsul || provider == "" {
+		consul, err := health.NewConsulHealthCheck(conf.App.ConsulAddress)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		// registered instances keep serving while the agent is away
+		checks = append(checks, health.Check{Name: "consul", Check: consul})
+	}
+
+	return health.NewProbe(interval, timeout),
+		health.NewProbe(interval, timeout, checks...),
+		health.NewStartupProbe(interval, timeout, dbCheck, keysCheck),
+		nil
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/misikdmitriy/password-sharing/auth"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+)
+
+const (
+	authorizationHeader = "Authorization"
+	ApiKeyHeader        = "X-Api-Key"
+	bearerPrefix        = "Bearer "
+)
+
+// Authenticate resolves the caller and enforces requirement. When optional
+// is set, requests without credentials are let through as anonymous.
+// Credentials are always verified when present.
+func Authenticate(authenticator auth.Authenticator, requirement auth.Requirement, optional bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		credential := credentialFrom(c)
+		if credential == "" {
+			if requirement.IsAnonymous() || optional {
+				c.Next()
+				return
+			}
+
+			AbortWithError(c, &pserror.PasswordSharingError{
+				Code:    pserror.Unauthorized,
+				Message: "authentication required",
+			})
+			return
+		}
+
+		principal, err := authenticator.Authenticate(c, credential)
+		if err != nil {
+			AbortWithError(c, err)
+			return
+		}
+
+		if !principal.Satisfies(requirement) {
+			AbortWithError(c, &pserror.PasswordSharingError{
+				Code:    pserror.Forbidden,
+				Message: "insufficient scope",
+			})
+			return
+		}
+
+		c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), principal))
+		c.Next()
+	}
+}
+
+func credentialFrom(c *gin.Context) string {
+	if key := c.GetHeader(ApiKeyHeader); key != "" {
+		return key
+	}
+
+	header := c.GetHeader(authorizationHeader)
+	if len(header) > len(bearerPrefix) && strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return strings.TrimSpace(header[len(bearerPrefix):])
+	}
+
+	return ""
+}
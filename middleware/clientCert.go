@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+)
+
+// RequireClientCert rejects requests without a verified client certificate.
+// The TLS handshake verifies certificates that are given, this makes them
+// mandatory for a route.
+func RequireClientCert() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+			AbortWithError(c, &pserror.PasswordSharingError{
+				Code:    pserror.ClientCertificateRequired,
+				Message: "client certificate required",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
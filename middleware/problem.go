@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+)
+
+const problemContentType = "application/problem+json"
+
+const errorCodeKey = "errorCode"
+
+// WriteError renders err as a problem document.
+func WriteError(c *gin.Context, err error) {
+	psError := pserror.AsPasswordSharingError(err)
+	c.Set(errorCodeKey, psError.Code)
+
+	c.Header("Content-Type", problemContentType)
+	c.JSON(psError.ToResponse(c.Request.URL.Path, RequestIdFrom(c)))
+}
+
+// AbortWithError renders err and stops the handler chain.
+func AbortWithError(c *gin.Context, err error) {
+	WriteError(c, err)
+	c.Abort()
+}
+
+// ErrorCodeFrom returns the code of the error written for the request, if
+// any.
+func ErrorCodeFrom(c *gin.Context) (pserror.ErrorCodes, bool) {
+	code, ok := c.Get(errorCodeKey)
+	if !ok {
+		return 0, false
+	}
+
+	result, ok := code.(pserror.ErrorCodes)
+	return result, ok
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/misikdmitriy/password-sharing/auth"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/ratelimit"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	RetryAfterHeader         = "Retry-After"
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+)
+
+var rateLimitedCounter *prometheus.CounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "password_sharing_rate_limited",
+	Help: "The total number of requests rejected by route and reason",
+}, []string{"route", "reason"})
+
+// RateLimit gives every client a bucket of route. Clients are identified by
+// their API key or token subject, anonymous ones by their address. Clients
+// asking for too many unknown links are blocked from every route. It runs
+// after Authenticate. The limit of route is looked up on every request so
+// reloaded limits apply at once.
+func RateLimit(limiter ratelimit.Limiter, method string, route string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := limiter.Route(method, route)
+		ip := c.ClientIP()
+
+		if blocked := limiter.Blocked(c, ip); blocked > 0 {
+			rateLimitedCounter.WithLabelValues(route, "penalty").Inc()
+			abortRateLimited(c, blocked, "too many unknown links, try again later")
+			return
+		}
+
+		result := limiter.Take(c, method+" "+route+" "+clientOf(c, ip), limit)
+		if !limit.Unlimited() {
+			c.Header(RateLimitLimitHeader, strconv.Itoa(result.Limit))
+			c.Header(RateLimitRemainingHeader, strconv.Itoa(result.Remaining))
+			c.Header(RateLimitResetHeader, seconds(result.Reset))
+		}
+
+		if !result.Allowed {
+			rateLimitedCounter.WithLabelValues(route, "limit").Inc()
+			abortRateLimited(c, result.RetryAfter, "rate limit exceeded")
+			return
+		}
+
+		c.Next()
+
+		if code, ok := ErrorCodeFrom(c); ok && code == pserror.PasswordNotFound {
+			limiter.Fail(c, ip)
+		}
+	}
+}
+
+func clientOf(c *gin.Context, ip string) string {
+	principal := auth.PrincipalFrom(c.Request.Context())
+	switch {
+	case principal == nil:
+		return "ip:" + ip
+	case principal.KeyId != "":
+		return "key:" + principal.KeyId
+	default:
+		return "sub:" + principal.Subject
+	}
+}
+
+func abortRateLimited(c *gin.Context, retryAfter time.Duration, message string) {
+	c.Header(RetryAfterHeader, seconds(retryAfter))
+	AbortWithError(c, &pserror.PasswordSharingError{
+		Code:    pserror.RateLimited,
+		Message: message,
+	})
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(d / time.Second))
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/misikdmitriy/password-sharing/auth"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+)
+
+// Authorize enforces the role a route needs on top of the requirement of its
+// group. It runs after Authenticate.
+func Authorize(requirement auth.Requirement) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := auth.PrincipalFrom(c.Request.Context())
+		if principal == nil || !principal.Satisfies(requirement) {
+			AbortWithError(c, &pserror.PasswordSharingError{
+				Code:    pserror.InsufficientRole,
+				Message: "insufficient role",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const RequestIdHeader = "X-Request-Id"
+
+const requestIdKey = "requestId"
+
+// incoming ids are echoed back and logged, so only short safe values are kept
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+func RequestId() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIdHeader)
+		if !requestIdPattern.MatchString(id) {
+			id = uuid.New().String()
+		}
+
+		c.Set(requestIdKey, id)
+		c.Header(RequestIdHeader, id)
+		c.Next()
+	}
+}
+
+func RequestIdFrom(c *gin.Context) string {
+	return c.GetString(requestIdKey)
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/misikdmitriy/password-sharing/auth"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/tenant"
+)
+
+// ResolveTenant sets the tenant of the request. The tenant bound to the
+// credential wins, otherwise the Host header decides and unknown hosts
+// belong to the default tenant. It runs after Authenticate.
+func ResolveTenant(tenants tenant.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resolved := tenants.Default()
+
+		if principal := auth.PrincipalFrom(c.Request.Context()); principal != nil && principal.Tenant != "" {
+			t, ok := tenants.Get(principal.Tenant)
+			if !ok {
+				AbortWithError(c, &pserror.PasswordSharingError{
+					Code:    pserror.UnknownTenant,
+					Message: "credential belongs to an unknown tenant",
+				})
+				return
+			}
+
+			resolved = t
+		} else if t, ok := tenants.ByHost(c.Request.Host); ok {
+			resolved = t
+		}
+
+		c.Request = c.Request.WithContext(tenant.WithTenant(c.Request.Context(), resolved))
+		c.Next()
+	}
+}
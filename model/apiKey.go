@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+type ApiKey struct {
+	Id         int64      `gorm:"primaryKey;autoIncrement;column:id"`
+	KeyId      string     `gorm:"column:key_id;unique"`
+	Name       string     `gorm:"column:name"`
+	TenantId   string     `gorm:"column:tenant_id"`
+	Hash       string     `gorm:"column:hash"`
+	Scopes     string     `gorm:"column:scopes"`
+	CreatedAt  time.Time  `gorm:"column:created_at"`
+	ExpiresAt  *time.Time `gorm:"column:expires_at"`
+	LastUsedAt *time.Time `gorm:"column:last_used_at"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at"`
+}
+
+func (ApiKey) TableName() string {
+	return "tbl_api_keys"
+}
+
+func (k *ApiKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || k.ExpiresAt.After(now))
+}
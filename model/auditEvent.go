@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// AuditEvent is an entry of the audit log. It never holds secret contents,
+// secrets are referred to by their link hash. Entries are hash chained by
+// Seq, events recorded before chaining existed have no Seq.
+type AuditEvent struct {
+	Id       int64     `gorm:"primaryKey;autoIncrement;column:id"`
+	Seq      *int64    `gorm:"column:seq;uniqueIndex"`
+	Time     time.Time `gorm:"column:time;index"`
+	Actor    string    `gorm:"column:actor"`
+	TenantId string    `gorm:"column:tenant_id;index"`
+	Action   string    `gorm:"column:action"`
+	Target   string    `gorm:"column:target"`
+	Outcome  string    `gorm:"column:outcome"`
+	PrevHash string    `gorm:"column:prev_hash"`
+	Hash     string    `gorm:"column:hash"`
+}
+
+func (AuditEvent) TableName() string {
+	return "tbl_audit_events"
+}
@@ -0,0 +1,30 @@
+package model
+
+type PasswordBody struct {
+	Password   string   `json:"password"`
+	ExpiresIn  int64    `json:"expiresIn,omitempty"`
+	Views      int      `json:"views,omitempty"`
+	Passphrase string   `json:"passphrase,omitempty"`
+	Recipients []string `json:"recipients,omitempty"`
+	// AllowedCidrs are the networks the password may be revealed from.
+	AllowedCidrs []string `json:"allowedCidrs,omitempty"`
+}
+
+type SecretRequestBody struct {
+	Description string `json:"description,omitempty"`
+	ExpiresIn   int64  `json:"expiresIn,omitempty"`
+}
+
+type GenerateBody struct {
+	Mode             string `json:"mode,omitempty"`
+	Length           int    `json:"length,omitempty"`
+	Lower            bool   `json:"lower,omitempty"`
+	Upper            bool   `json:"upper,omitempty"`
+	Digits           bool   `json:"digits,omitempty"`
+	Symbols          bool   `json:"symbols,omitempty"`
+	ExcludeAmbiguous bool   `json:"excludeAmbiguous,omitempty"`
+	Words            int    `json:"words,omitempty"`
+	Separator        string `json:"separator,omitempty"`
+	Count            int    `json:"count,omitempty"`
+	Share            bool   `json:"share,omitempty"`
+}
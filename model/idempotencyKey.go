@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// IdempotencyKey remembers the response to a request sent with an
+// Idempotency-Key header. Status is zero while the request is in progress,
+// the response is encrypted with the data key of the tenant.
+type IdempotencyKey struct {
+	Id          int64     `gorm:"primaryKey;autoIncrement;column:id"`
+	KeyHash     string    `gorm:"column:key_hash;uniqueIndex"`
+	TenantId    string    `gorm:"column:tenant_id"`
+	RequestHash string    `gorm:"column:request_hash"`
+	Status      int       `gorm:"column:status"`
+	KeyId       string    `gorm:"column:key_id"`
+	Response    string    `gorm:"column:response"`
+	CreatedAt   time.Time `gorm:"column:created_at"`
+	ExpiresAt   time.Time `gorm:"column:expires_at;index"`
+}
+
+func (IdempotencyKey) TableName() string {
+	return "tbl_idempotency_keys"
+}
@@ -1,11 +1,62 @@
 package model
 
+import (
+	"strings"
+	"time"
+)
+
 type Password struct {
-	Id       int64  `gorm:"primaryKey;autoIncrement;column:id"`
-	Link     string `gorm:"column:link;unique"`
+	Id   int64  `gorm:"primaryKey;autoIncrement;column:id"`
+	Link string `gorm:"column:link;unique"`
+	// LinkHash identifies the password to operators without revealing the
+	// link.
+	LinkHash string `gorm:"column:link_hash;index"`
 	Password string `gorm:"column:password"`
+	// Owner is the subject of the authenticated creator, empty for anonymous
+	// links.
+	Owner    string `gorm:"column:owner;index"`
+	TenantId string `gorm:"column:tenant_id;index"`
+	// KeyId identifies the tenant data key Password is encrypted with.
+	KeyId          string     `gorm:"column:key_id"`
+	CreatedAt      *time.Time `gorm:"column:created_at"`
+	ExpiresAt      *time.Time `gorm:"column:expires_at"`
+	MaxViews       int        `gorm:"column:max_views"`
+	Views          int        `gorm:"column:views"`
+	PassphraseHash string     `gorm:"column:passphrase_hash"`
+	// Recipients is a comma separated list of the email addresses allowed to
+	// reveal the password, empty for unrestricted links.
+	Recipients string `gorm:"column:recipients"`
+	// AllowedCidrs is a comma separated list of the networks the password
+	// may be revealed from, empty for unrestricted links.
+	AllowedCidrs string `gorm:"column:allowed_cidrs"`
+	// DeniedViews counts reveals refused because of the client address.
+	DeniedViews int `gorm:"column:denied_views"`
 }
 
 func (Password) TableName() string {
 	return "tbl_passwords"
 }
+
+func (p *Password) Expired(now time.Time) bool {
+	return p.ExpiresAt != nil && !p.ExpiresAt.After(now)
+}
+
+func (p *Password) Exhausted() bool {
+	return p.MaxViews > 0 && p.Views >= p.MaxViews
+}
+
+func (p *Password) RecipientList() []string {
+	if p.Recipients == "" {
+		return nil
+	}
+
+	return strings.Split(p.Recipients, ",")
+}
+
+func (p *Password) AllowedCidrList() []string {
+	if p.AllowedCidrs == "" {
+		return nil
+	}
+
+	return strings.Split(p.AllowedCidrs, ",")
+}
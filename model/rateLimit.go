@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// RateLimit is the token bucket of a client shared by all instances. Version
+// guards concurrent updates.
+type RateLimit struct {
+	Id           string    `gorm:"primaryKey;size:255;column:id"`
+	Tokens       float64   `gorm:"column:tokens"`
+	RefilledAt   time.Time `gorm:"column:refilled_at"`
+	Strikes      int       `gorm:"column:strikes"`
+	BlockedUntil time.Time `gorm:"column:blocked_until"`
+	ExpiresAt    time.Time `gorm:"column:expires_at;index"`
+	Version      int64     `gorm:"column:version"`
+}
+
+func (RateLimit) TableName() string {
+	return "tbl_rate_limits"
+}
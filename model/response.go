@@ -1,19 +1,145 @@
 package model
 
-type ErrorResponse struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+import "time"
+
+// ProblemResponse is an RFC 7807 problem document extended with the service
+// error code, the request id and a retry hint.
+type ProblemResponse struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      int    `json:"code"`
+	RequestId string `json:"requestId,omitempty"`
+	Retryable bool   `json:"retryable"`
 }
 
 type LinkResponse struct {
-	Url string `json:"url"`
+	Url       string            `json:"url"`
+	ExpiresAt *time.Time        `json:"expiresAt,omitempty"`
+	Views     int               `json:"views,omitempty"`
+	Strength  *StrengthResponse `json:"strength,omitempty"`
+}
+
+type StrengthResponse struct {
+	Score        int      `json:"score"`
+	GuessesLog10 float64  `json:"guessesLog10"`
+	Breached     bool     `json:"breached"`
+	BreachCount  int      `json:"breachCount,omitempty"`
+	Warnings     []string `json:"warnings"`
+}
+
+type LinkStatusResponse struct {
+	Exists bool `json:"exists"`
 }
 
 type PasswordResponse struct {
 	Password string `json:"password"`
 }
 
+// ChallengeResponse is a proof-of-work challenge, a solution is a nonce that
+// makes the hash of the token followed by the nonce start with Difficulty
+// zero bits.
+type ChallengeResponse struct {
+	Token      string    `json:"token"`
+	Algorithm  string    `json:"algorithm"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
 type HealthResponse struct {
-	Healthy bool   `json:"healthy"`
-	Reason  string `json:"reason"`
+	Healthy   bool                  `json:"healthy"`
+	Status    string                `json:"status"`
+	CheckedAt time.Time             `json:"checkedAt"`
+	Checks    []HealthCheckResponse `json:"checks,omitempty"`
+}
+
+type HealthCheckResponse struct {
+	Name      string            `json:"name"`
+	Status    string            `json:"status"`
+	Critical  bool              `json:"critical"`
+	LatencyMs float64           `json:"latencyMs"`
+	Details   map[string]string `json:"details,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+type BuildInfoResponse struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified"`
+	GoVersion string `json:"goVersion"`
+}
+
+type SecretRequestResponse struct {
+	Url       string    `json:"url"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type SecretRequestInfoResponse struct {
+	Description string    `json:"description"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	Fulfilled   bool      `json:"fulfilled"`
+}
+
+type GeneratedPasswordResponse struct {
+	Password string  `json:"password"`
+	Entropy  float64 `json:"entropy"`
+	Url      string  `json:"url,omitempty"`
+}
+
+type GenerateResponse struct {
+	Passwords []GeneratedPasswordResponse `json:"passwords"`
+}
+
+type SecretStatsResponse struct {
+	Tenants []TenantSecretStatsResponse `json:"tenants"`
+}
+
+// TenantSecretStatsResponse counts active secrets, the age counts are
+// cumulative.
+type TenantSecretStatsResponse struct {
+	Tenant   string `json:"tenant"`
+	Total    int64  `json:"total"`
+	LastHour int64  `json:"lastHour"`
+	LastDay  int64  `json:"lastDay"`
+	LastWeek int64  `json:"lastWeek"`
+}
+
+type PurgeResponse struct {
+	Purged int64 `json:"purged"`
+}
+
+type ApiKeyResponse struct {
+	KeyId      string     `json:"keyId"`
+	Name       string     `json:"name"`
+	Tenant     string     `json:"tenant"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+type ApiKeysResponse struct {
+	Keys []ApiKeyResponse `json:"keys"`
+}
+
+type AuditEventResponse struct {
+	Id       int64     `json:"id"`
+	Seq      *int64    `json:"seq,omitempty"`
+	Time     time.Time `json:"time"`
+	Actor    string    `json:"actor"`
+	Tenant   string    `json:"tenant,omitempty"`
+	Action   string    `json:"action"`
+	Target   string    `json:"target,omitempty"`
+	Outcome  string    `json:"outcome"`
+	PrevHash string    `json:"prevHash,omitempty"`
+	Hash     string    `json:"hash,omitempty"`
+}
+
+type AuditLogResponse struct {
+	Events []AuditEventResponse `json:"events"`
 }
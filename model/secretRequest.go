@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+type SecretRequest struct {
+	Id           int64     `gorm:"primaryKey;autoIncrement;column:id"`
+	Link         string    `gorm:"column:link;unique"`
+	TenantId     string    `gorm:"column:tenant_id;index"`
+	TokenHash    string    `gorm:"column:token_hash"`
+	Description  string    `gorm:"column:description"`
+	PasswordLink string    `gorm:"column:password_link"`
+	ExpiresAt    time.Time `gorm:"column:expires_at"`
+}
+
+func (SecretRequest) TableName() string {
+	return "tbl_secret_requests"
+}
+
+func (r *SecretRequest) Fulfilled() bool {
+	return r.PasswordLink != ""
+}
+
+func (r *SecretRequest) Expired(now time.Time) bool {
+	return !r.ExpiresAt.After(now)
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// UsedChallenge remembers a solved challenge until it expires, so every
+// instance accepts a solution only once.
+type UsedChallenge struct {
+	Id        string    `gorm:"primaryKey;column:id"`
+	ExpiresAt time.Time `gorm:"column:expires_at;index"`
+}
+
+func (UsedChallenge) TableName() string {
+	return "tbl_used_challenges"
+}
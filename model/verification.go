@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// Verification is a one-time code sent to a recipient of a password. Only
+// the code hash is stored. A recipient has one row per password.
+type Verification struct {
+	Id         int64     `gorm:"primaryKey;autoIncrement;column:id"`
+	PasswordId int64     `gorm:"column:password_id;uniqueIndex:idx_verification_recipient"`
+	Email      string    `gorm:"column:email;uniqueIndex:idx_verification_recipient"`
+	CodeHash   string    `gorm:"column:code_hash"`
+	Attempts   int       `gorm:"column:attempts"`
+	SentAt     time.Time `gorm:"column:sent_at"`
+	ExpiresAt  time.Time `gorm:"column:expires_at"`
+}
+
+func (Verification) TableName() string {
+	return "tbl_verifications"
+}
+
+func (v *Verification) Expired(now time.Time) bool {
+	return !v.ExpiresAt.After(now)
+}
@@ -0,0 +1,186 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"go.uber.org/zap"
+)
+
+// Notifier delivers short messages to people, e.g. one-time codes.
+type Notifier interface {
+	Notify(ctx context.Context, to string, subject string, body string) error
+}
+
+const (
+	ProviderSmtp = "smtp"
+	ProviderLog  = "log"
+)
+
+// NewNotifier has no default provider, codes are only written to the log when
+// the log provider is picked on purpose.
+func NewNotifier(conf *config.Config, loggerFactory logger.LoggerFactory) (Notifier, error) {
+	switch conf.Notify.Provider {
+	case ProviderSmtp:
+		return NewSmtpNotifier(conf), nil
+	case ProviderLog:
+		return NewLogNotifier(loggerFactory), nil
+	default:
+		return nil, fmt.Errorf("unknown notify provider %s", conf.Notify.Provider)
+	}
+}
+
+type smtpNotifier struct {
+	configuration *config.Config
+}
+
+func NewSmtpNotifier(conf *config.Config) Notifier {
+	return &smtpNotifier{
+		configuration: conf,
+	}
+}
+
+// smtpTimeout bounds a delivery when the context carries no deadline.
+const smtpTimeout = 30 * time.Second
+
+func (n *smtpNotifier) Notify(ctx context.Context, to string, subject string, body string) error {
+	conf := n.configuration.Notify.Smtp
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("invalid recipient %q", to)
+	}
+
+	var auth smtp.Auth
+	if conf.Username != "" {
+		auth = smtp.PlainAuth("", conf.Username, conf.Password, conf.Host)
+	}
+
+	message := strings.Join([]string{
+		"From: " + conf.From,
+		"To: " + to,
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		body,
+	}, "\r\n")
+
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+
+	address := net.JoinHostPort(conf.Host, strconv.Itoa(conf.Port))
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// the deadline covers the whole conversation, cancelling ctx cuts it
+	// short
+	deadline, _ := ctx.Deadline()
+	if err = conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	return send(conn, conf.Host, auth, conf.From, to, []byte(message))
+}
+
+// send does what smtp.SendMail does over an open connection.
+func send(conn net.Conn, host string, auth smtp.Auth, from string, to string, message []byte) error {
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// upgrade to TLS when the server offers STARTTLS
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp server does not support AUTH")
+		}
+
+		if err = client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(from); err != nil {
+		return err
+	}
+
+	if err = client.Rcpt(to); err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err = writer.Write(message); err != nil {
+		return err
+	}
+
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+type logNotifier struct {
+	loggerFactory logger.LoggerFactory
+}
+
+// NewLogNotifier is meant for local runs. Messages carry one-time codes, so
+// their body is only logged at debug level.
+func NewLogNotifier(loggerFactory logger.LoggerFactory) Notifier {
+	return &logNotifier{
+		loggerFactory: loggerFactory,
+	}
+}
+
+func (n *logNotifier) Notify(_ context.Context, to string, subject string, body string) error {
+	appLogger, loggerClose, err := n.loggerFactory.NewLogger()
+	if err != nil {
+		return err
+	}
+	defer loggerClose()
+
+	appLogger.Info("notification",
+		zap.String("to", to),
+		zap.String("subject", subject),
+	)
+	appLogger.Debug("notification body",
+		zap.String("to", to),
+		zap.String("body", body),
+	)
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/logger"
+)
+
+type fakeMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// fakeSmtpServer speaks just enough SMTP for net/smtp.SendMail and hands
+// every received message to messages.
+func fakeSmtpServer(t *testing.T) (string, <-chan fakeMessage) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	messages := make(chan fakeMessage, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go serveSmtp(conn, messages)
+		}
+	}()
+
+	return listener.Addr().String(), messages
+}
+
+func serveSmtp(conn net.Conn, messages chan<- fakeMessage) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 localhost fake smtp")
+	message := fakeMessage{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(command, "AUTH"):
+			reply("235 authenticated")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			message.from = strings.Trim(strings.TrimSpace(line)[len("MAIL FROM:"):], "<>")
+			reply("250 ok")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			message.to = append(message.to, strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>"))
+			reply("250 ok")
+		case command == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			message.data = data.String()
+			messages <- message
+			reply("250 queued")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestSmtpNotifierShouldSendMail(t *testing.T) {
+	address, messages := fakeSmtpServer(t)
+	host, port, _ := net.SplitHostPort(address)
+
+	c := &config.Config{}
+	c.Notify.Provider = ProviderSmtp
+	c.Notify.Smtp.Host = host
+	c.Notify.Smtp.Port, _ = strconv.Atoi(port)
+	c.Notify.Smtp.Username = "user"
+	c.Notify.Smtp.Password = "password"
+	c.Notify.Smtp.From = "noreply@example.com"
+
+	n, err := NewNotifier(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = n.Notify(context.Background(), "alice@example.com", "Your code", "123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := <-messages
+	if message.from != "noreply@example.com" || len(message.to) != 1 || message.to[0] != "alice@example.com" {
+		t.Errorf("unexpected envelope %+v", message)
+	}
+
+	if !strings.Contains(message.data, "Subject: Your code") || !strings.HasSuffix(message.data, "\r\n123456\r\n") {
+		t.Errorf("unexpected message %q", message.data)
+	}
+}
+
+func TestSmtpNotifierShouldGiveUpWithContext(t *testing.T) {
+	// a server that accepts connections and never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			// hold the connection until the client hangs up
+			go func() {
+				io.Copy(io.Discard, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	c := &config.Config{}
+	c.Notify.Smtp.Host = host
+	c.Notify.Smtp.Port, _ = strconv.Atoi(port)
+	c.Notify.Smtp.From = "noreply@example.com"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err = NewSmtpNotifier(c).Notify(ctx, "alice@example.com", "Your code", "123456"); err == nil {
+		t.Fatalf("expected a stalled server to fail the notification")
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the notification to give up with the context but took %v", elapsed)
+	}
+}
+
+func TestSmtpNotifierShouldRejectHeaderInjection(t *testing.T) {
+	n := NewSmtpNotifier(&config.Config{})
+
+	if err := n.Notify(context.Background(), "alice@example.com\r\nBcc: eve@example.com", "code", "123456"); err == nil {
+		t.Errorf("expected recipient with line breaks to be rejected")
+	}
+}
+
+func TestNewNotifierShouldRequireProvider(t *testing.T) {
+	c := &config.Config{}
+
+	if _, err := NewNotifier(c, logger.NewTestLoggerFactory()); err == nil {
+		t.Errorf("expected a notifier without provider to be rejected")
+	}
+}
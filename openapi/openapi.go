@@ -0,0 +1,309 @@
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/model"
+)
+
+const Version = "3.0.3"
+
+const (
+	jsonContentType    = "application/json"
+	problemContentType = "application/problem+json"
+	apiKeyScheme       = "apiKey"
+	bearerScheme       = "bearer"
+)
+
+// Operation describes a single route for the OpenAPI document. Request and
+// Response hold zero values of the model types and are inspected with
+// reflection. Query parameters are always optional.
+type Operation struct {
+	Summary         string
+	Headers         []string
+	OptionalHeaders []string
+	Query           []string
+	Request         interface{}
+	Status          int
+	Response        interface{}
+	Errors          []pserror.ErrorCodes
+}
+
+type Route struct {
+	Method    string
+	Path      string
+	Operation Operation
+	// Scopes the caller needs, empty for anonymous routes.
+	Scopes []string
+}
+
+type Document map[string]interface{}
+
+type object = map[string]interface{}
+
+// Build creates the OpenAPI document for routes, paths are gin paths
+// relative to prefix.
+func Build(title string, version string, prefix string, routes []Route) Document {
+	b := &schemaBuilder{
+		schemas: object{},
+	}
+
+	errorSchema := b.schema(reflect.TypeOf(model.ProblemResponse{}))
+	codes := make([]interface{}, 0)
+	enum := make([]interface{}, 0)
+	for _, d := range pserror.Definitions() {
+		codes = append(codes, object{
+			"code":      int(d.Code),
+			"status":    d.Status,
+			"type":      d.Type,
+			"title":     d.Title,
+			"retryable": d.Retryable,
+		})
+		enum = append(enum, int(d.Code))
+	}
+
+	properties := b.schemas["ProblemResponse"].(object)["properties"].(object)
+	properties["code"].(object)["enum"] = enum
+
+	paths := object{}
+	for _, route := range routes {
+		path := PathOf(prefix + route.Path)
+		item, ok := paths[path].(object)
+		if !ok {
+			item = object{}
+			paths[path] = item
+		}
+
+		item[strings.ToLower(route.Method)] = b.operation(route, errorSchema)
+	}
+
+	return Document{
+		"openapi": Version,
+		"info": object{
+			"title":   title,
+			"version": version,
+		},
+		"servers": []interface{}{
+			object{"url": "/"},
+		},
+		"paths": paths,
+		"components": object{
+			"schemas": b.schemas,
+			"securitySchemes": object{
+				apiKeyScheme: object{
+					"type": "apiKey",
+					"in":   "header",
+					"name": "X-Api-Key",
+				},
+				bearerScheme: object{
+					"type":   "http",
+					"scheme": "bearer",
+				},
+			},
+		},
+		"x-error-codes": codes,
+	}
+}
+
+// PathOf converts gin path parameters to OpenAPI templates, e.g.
+// /pwd/:link becomes /pwd/{link}.
+func PathOf(ginPath string) string {
+	segments := strings.Split(ginPath, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = fmt.Sprintf("{%s}", segment[1:])
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func (b *schemaBuilder) operation(route Route, errorSchema object) object {
+	op := route.Operation
+	parameters := make([]interface{}, 0)
+	for _, segment := range strings.Split(route.Path, "/") {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			parameters = append(parameters, object{
+				"name":     segment[1:],
+				"in":       "path",
+				"required": true,
+				"schema":   object{"type": "string"},
+			})
+		}
+	}
+
+	for _, header := range op.Headers {
+		parameters = append(parameters, headerParameter(header, true))
+	}
+
+	for _, header := range op.OptionalHeaders {
+		parameters = append(parameters, headerParameter(header, false))
+	}
+
+	for _, name := range op.Query {
+		parameters = append(parameters, object{
+			"name":     name,
+			"in":       "query",
+			"required": false,
+			"schema":   object{"type": "string"},
+		})
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	success := object{
+		"description": http.StatusText(status),
+	}
+	if op.Response != nil {
+		success["content"] = content(jsonContentType, b.schema(reflect.TypeOf(op.Response)))
+	}
+
+	responses := object{
+		strconv.Itoa(status): success,
+	}
+
+	errors := append(op.Errors, pserror.InternalServerError)
+	if len(route.Scopes) > 0 {
+		errors = append(errors, pserror.Unauthorized, pserror.InvalidCredentials, pserror.Forbidden)
+	}
+
+	byStatus := map[int][]string{}
+	for _, code := range errors {
+		d := pserror.Lookup(code)
+		byStatus[d.Status] = append(byStatus[d.Status], fmt.Sprintf("%d (%s)", d.Code, d.Title))
+	}
+
+	for errorStatus, codes := range byStatus {
+		sort.Strings(codes)
+		responses[strconv.Itoa(errorStatus)] = object{
+			"description": fmt.Sprintf("%s, error codes: %s", http.StatusText(errorStatus), strings.Join(codes, ", ")),
+			"content":     content(problemContentType, errorSchema),
+		}
+	}
+
+	result := object{
+		"summary":    op.Summary,
+		"parameters": parameters,
+		"responses":  responses,
+	}
+
+	if len(route.Scopes) > 0 {
+		scopes := make([]interface{}, len(route.Scopes))
+		for i, s := range route.Scopes {
+			scopes[i] = s
+		}
+
+		result["security"] = []interface{}{
+			object{apiKeyScheme: scopes},
+			object{bearerScheme: scopes},
+		}
+	}
+
+	if op.Request != nil {
+		result["requestBody"] = object{
+			"required": true,
+			"content":  content(jsonContentType, b.schema(reflect.TypeOf(op.Request))),
+		}
+	}
+
+	return result
+}
+
+func headerParameter(name string, required bool) object {
+	return object{
+		"name":     name,
+		"in":       "header",
+		"required": required,
+		"schema":   object{"type": "string"},
+	}
+}
+
+func content(contentType string, schema object) object {
+	return object{
+		contentType: object{
+			"schema": schema,
+		},
+	}
+}
+
+type schemaBuilder struct {
+	schemas object
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (b *schemaBuilder) schema(t reflect.Type) object {
+	switch {
+	case t == timeType:
+		return object{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Ptr:
+		return b.schema(t.Elem())
+	case t.Kind() == reflect.Struct:
+		return b.ref(t)
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return object{"type": "array", "items": b.schema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return object{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case t.Kind() == reflect.String:
+		return object{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return object{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return object{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return object{"type": "number"}
+	default:
+		return object{}
+	}
+}
+
+func (b *schemaBuilder) ref(t reflect.Type) object {
+	ref := object{"$ref": "#/components/schemas/" + t.Name()}
+	if _, ok := b.schemas[t.Name()]; ok {
+		return ref
+	}
+
+	// registered before the fields are walked so recursive types terminate
+	properties := object{}
+	required := make([]interface{}, 0)
+	b.schemas[t.Name()] = object{
+		"type":       "object",
+		"properties": properties,
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = b.schema(field.Type)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Ptr {
+			required = append(required, name)
+		}
+	}
+
+	if len(required) > 0 {
+		b.schemas[t.Name()].(object)["required"] = required
+	}
+
+	return ref
+}
@@ -0,0 +1,157 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// Limit allows Requests per Period on average and Burst requests at once.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// Unlimited reports whether the limit lets every request through.
+func (l Limit) Unlimited() bool {
+	return l.Requests <= 0 || l.Period <= 0
+}
+
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+
+	return float64(l.Requests)
+}
+
+// rate is the number of tokens added per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Penalty blocks a client for Block after Threshold failures within Window.
+// Each further block is twice as long, up to MaxBlock.
+type Penalty struct {
+	Threshold int
+	Window    time.Duration
+	Block     time.Duration
+	MaxBlock  time.Duration
+}
+
+func (p Penalty) Enabled() bool {
+	return p.Threshold > 0 && p.Window > 0 && p.Block > 0
+}
+
+func (p Penalty) maxBlock() time.Duration {
+	if p.MaxBlock < p.Block {
+		return p.Block
+	}
+
+	return p.MaxBlock
+}
+
+// State is what a Store keeps per key. A state is dropped once Expires has
+// passed.
+type State struct {
+	Tokens       float64
+	Refilled     time.Time
+	Strikes      int
+	BlockedUntil time.Time
+	Expires      time.Time
+}
+
+// Result is the outcome of taking a token. Durations are rounded up to whole
+// seconds, as sent in the headers.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// refill returns the tokens of s at now. Unknown buckets are full.
+func refill(s State, now time.Time, limit Limit) float64 {
+	if s.Refilled.IsZero() {
+		return limit.capacity()
+	}
+
+	elapsed := now.Sub(s.Refilled).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	return math.Min(limit.capacity(), s.Tokens+elapsed*limit.rate())
+}
+
+// take spends a token of the bucket s.
+func take(s State, now time.Time, limit Limit) (State, Result) {
+	tokens := refill(s, now, limit)
+
+	result := Result{Limit: int(limit.capacity())}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - tokens) / limit.rate())
+	}
+
+	result.Remaining = int(tokens)
+	result.Reset = seconds((limit.capacity() - tokens) / limit.rate())
+
+	s.Tokens = tokens
+	s.Refilled = now
+	s.Expires = now.Add(result.Reset)
+
+	return s, result
+}
+
+// fail records a failure in s and blocks it once the failures use up the
+// threshold. Strikes are forgotten after a quiet MaxBlock.
+func fail(s State, now time.Time, p Penalty) State {
+	limit := Limit{Requests: p.Threshold, Period: p.Window}
+
+	if s.Strikes > 0 && now.Sub(s.BlockedUntil) > p.maxBlock() {
+		s.Strikes = 0
+	}
+
+	tokens := refill(s, now, limit)
+	if tokens >= 1 {
+		tokens--
+	} else {
+		s.Strikes++
+		s.BlockedUntil = now.Add(blockOf(s.Strikes, p))
+		// a client gets another Threshold tries after serving the block
+		tokens = limit.capacity()
+	}
+
+	s.Tokens = tokens
+	s.Refilled = now
+
+	s.Expires = now.Add(seconds((limit.capacity() - tokens) / limit.rate()))
+	if s.Strikes > 0 {
+		if remembered := s.BlockedUntil.Add(p.maxBlock()); remembered.After(s.Expires) {
+			s.Expires = remembered
+		}
+	}
+
+	return s
+}
+
+func blockOf(strikes int, p Penalty) time.Duration {
+	block := p.Block
+	for i := 1; i < strikes && block < p.maxBlock(); i++ {
+		block *= 2
+	}
+
+	if block > p.maxBlock() {
+		return p.maxBlock()
+	}
+
+	return block
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s)) * time.Second
+}
@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/database"
+	"github.com/misikdmitriy/password-sharing/model"
+	"gorm.io/gorm"
+)
+
+const (
+	maxUpdateAttempts = 5
+	// every cleanupInterval updates the rows of idle clients are deleted
+	cleanupInterval = 1000
+)
+
+type dbStore struct {
+	dbFactory database.DbFactory
+	updates   atomic.Int64
+}
+
+// NewDbStore keeps the state in the database, so all instances enforce the
+// limits together. Concurrent updates of a key are retried.
+func NewDbStore(dbFactory database.DbFactory) Store {
+	return &dbStore{
+		dbFactory: dbFactory,
+	}
+}
+
+func (s *dbStore) Update(c context.Context, key string, fn func(State) State) (State, error) {
+	db, dbClose, err := s.dbFactory.InitDB(c)
+	if err != nil {
+		return State{}, err
+	}
+	defer dbClose()
+
+	if s.updates.Add(1)%cleanupInterval == 0 {
+		if err = db.Where("expires_at <= ?", time.Now()).Delete(&model.RateLimit{}).Error; err != nil {
+			return State{}, err
+		}
+	}
+
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		state, updated, err := s.update(db, key, fn)
+		if err != nil {
+			return State{}, err
+		}
+
+		if updated {
+			return state, nil
+		}
+	}
+
+	return State{}, fmt.Errorf("rate limit of %s is updated concurrently", key)
+}
+
+// update reports false when another instance changed the row in between.
+func (s *dbStore) update(db *gorm.DB, key string, fn func(State) State) (State, bool, error) {
+	now := time.Now()
+
+	var row model.RateLimit
+	err := db.Where("id = ?", key).Take(&row).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return State{}, false, err
+	}
+
+	found := err == nil
+	state := State{}
+	if found && row.ExpiresAt.After(now) {
+		state = stateOf(row)
+	}
+
+	previous := state
+	state = fn(state)
+	if found && state == previous {
+		return state, true, nil
+	}
+
+	keep := state.Expires.After(now)
+
+	if !found {
+		if !keep {
+			return state, true, nil
+		}
+
+		next := rowOf(key, state)
+		next.Version = 1
+		err = db.Create(&next).Error
+		if err != nil && database.IsUniqueViolation(err) {
+			return State{}, false, nil
+		}
+
+		return state, err == nil, err
+	}
+
+	current := db.Where("id = ? AND version = ?", key, row.Version)
+
+	var result *gorm.DB
+	if keep {
+		next := rowOf(key, state)
+		result = current.Model(&model.RateLimit{}).Updates(map[string]interface{}{
+			"tokens":        next.Tokens,
+			"refilled_at":   next.RefilledAt,
+			"strikes":       next.Strikes,
+			"blocked_until": next.BlockedUntil,
+			"expires_at":    next.ExpiresAt,
+			"version":       row.Version + 1,
+		})
+	} else {
+		result = current.Delete(&model.RateLimit{})
+	}
+
+	if result.Error != nil {
+		return State{}, false, result.Error
+	}
+
+	return state, result.RowsAffected == 1, nil
+}
+
+func stateOf(row model.RateLimit) State {
+	return State{
+		Tokens:       row.Tokens,
+		Refilled:     row.RefilledAt,
+		Strikes:      row.Strikes,
+		BlockedUntil: row.BlockedUntil,
+		Expires:      row.ExpiresAt,
+	}
+}
+
+func rowOf(key string, state State) model.RateLimit {
+	return model.RateLimit{
+		Id:           key,
+		Tokens:       state.Tokens,
+		RefilledAt:   state.Refilled,
+		Strikes:      state.Strikes,
+		BlockedUntil: state.BlockedUntil,
+		ExpiresAt:    state.Expires,
+	}
+}
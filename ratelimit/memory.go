@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepSize is the number of keys after which expired states are dropped.
+const sweepSize = 10000
+
+type memoryStore struct {
+	mu     sync.Mutex
+	states map[string]State
+	sweep  int
+}
+
+// NewMemoryStore keeps the state in this process, every instance enforces
+// the limits on its own.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		states: map[string]State{},
+		sweep:  sweepSize,
+	}
+}
+
+func (s *memoryStore) Update(c context.Context, key string, fn func(State) State) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	state, ok := s.states[key]
+	if ok && !state.Expires.After(now) {
+		state = State{}
+	}
+
+	state = fn(state)
+	if state.Expires.After(now) {
+		s.states[key] = state
+	} else {
+		delete(s.states, key)
+	}
+
+	if len(s.states) >= s.sweep {
+		for k, v := range s.states {
+			if !v.Expires.After(now) {
+				delete(s.states, k)
+			}
+		}
+
+		// keys that are still in use should not trigger a sweep every time
+		s.sweep = 2 * len(s.states)
+		if s.sweep < sweepSize {
+			s.sweep = sweepSize
+		}
+	}
+
+	return state, nil
+}
@@ -0,0 +1,214 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/database"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+const (
+	StoreMemory = "memory"
+	StoreDb     = "db"
+)
+
+const penaltyPrefix = "penalty:"
+
+var storeErrorsCounter prometheus.Counter = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "password_sharing_rate_limit_store_errors",
+	Help: "The total number of rate limit store errors, requests are let through on errors",
+})
+
+// Store keeps the state of every key.
+type Store interface {
+	// Update replaces the state of key with the result of fn, which gets a
+	// zero State for unknown keys. fn may be called more than once.
+	Update(c context.Context, key string, fn func(State) State) (State, error)
+}
+
+// Limiter enforces token buckets and the penalty for failures. Store errors
+// are logged and let the request through.
+type Limiter interface {
+	// Route returns the limit of a route.
+	Route(method string, route string) Limit
+	// Take spends a token of the bucket of key.
+	Take(c context.Context, key string, limit Limit) Result
+	// Blocked returns for how long client is still blocked.
+	Blocked(c context.Context, client string) time.Duration
+	// Fail records a failure of client and returns the block it earned.
+	Fail(c context.Context, client string) time.Duration
+}
+
+type limiter struct {
+	store         Store
+	settings      atomic.Pointer[settings]
+	loggerFactory logger.LoggerFactory
+}
+
+// settings are replaced as a whole when the limits are reloaded.
+type settings struct {
+	defaultLimit Limit
+	routes       []config.RouteLimit
+	penalty      Penalty
+}
+
+// NewLimiter returns the limiter configured under ratelimit, or nil when
+// rate limiting is disabled. Reloaded limits and penalty apply at once, the
+// buckets are kept.
+func NewLimiter(source config.Source, dbFactory database.DbFactory, loggerFactory logger.LoggerFactory) (Limiter, error) {
+	conf := source.Current()
+	if !conf.RateLimit.Enabled {
+		return nil, nil
+	}
+
+	var store Store
+	switch conf.RateLimit.Store {
+	case "", StoreMemory:
+		store = NewMemoryStore()
+	case StoreDb:
+		store = NewDbStore(dbFactory)
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %s", conf.RateLimit.Store)
+	}
+
+	l := newLimiter(store, settingsOf(conf), loggerFactory)
+	source.Subscribe(func(c *config.Config) {
+		l.settings.Store(settingsOf(c))
+	})
+
+	return l, nil
+}
+
+func NewStoreLimiter(store Store, defaultLimit Limit, routes []config.RouteLimit, penalty Penalty, loggerFactory logger.LoggerFactory) Limiter {
+	return newLimiter(store, &settings{
+		defaultLimit: defaultLimit,
+		routes:       routes,
+		penalty:      penalty,
+	}, loggerFactory)
+}
+
+func newLimiter(store Store, s *settings, loggerFactory logger.LoggerFactory) *limiter {
+	l := &limiter{
+		store:         store,
+		loggerFactory: loggerFactory,
+	}
+	l.settings.Store(s)
+
+	return l
+}
+
+func settingsOf(conf *config.Config) *settings {
+	penalty := conf.RateLimit.Penalty
+
+	return &settings{
+		defaultLimit: limitOf(conf.RateLimit.Default),
+		routes:       conf.RateLimit.Routes,
+		penalty: Penalty{
+			Threshold: penalty.Threshold,
+			Window:    penalty.Window,
+			Block:     penalty.Block,
+			MaxBlock:  penalty.MaxBlock,
+		},
+	}
+}
+
+func (l *limiter) Route(method string, route string) Limit {
+	s := l.settings.Load()
+	for _, r := range s.routes {
+		if r.Route == route && (r.Method == "" || strings.EqualFold(r.Method, method)) {
+			return limitOf(r.Limit)
+		}
+	}
+
+	return s.defaultLimit
+}
+
+func (l *limiter) Take(c context.Context, key string, limit Limit) Result {
+	if limit.Unlimited() {
+		return Result{Allowed: true}
+	}
+
+	var result Result
+	_, err := l.store.Update(c, key, func(s State) State {
+		s, result = take(s, time.Now(), limit)
+		return s
+	})
+	if err != nil {
+		l.storeError(err, key)
+		return Result{Allowed: true}
+	}
+
+	return result
+}
+
+func (l *limiter) Blocked(c context.Context, client string) time.Duration {
+	if !l.settings.Load().penalty.Enabled() {
+		return 0
+	}
+
+	s, err := l.store.Update(c, penaltyPrefix+client, func(s State) State {
+		return s
+	})
+	if err != nil {
+		l.storeError(err, client)
+		return 0
+	}
+
+	return blockedFor(s, time.Now())
+}
+
+func (l *limiter) Fail(c context.Context, client string) time.Duration {
+	penalty := l.settings.Load().penalty
+	if !penalty.Enabled() {
+		return 0
+	}
+
+	s, err := l.store.Update(c, penaltyPrefix+client, func(s State) State {
+		return fail(s, time.Now(), penalty)
+	})
+	if err != nil {
+		l.storeError(err, client)
+		return 0
+	}
+
+	return blockedFor(s, time.Now())
+}
+
+func (l *limiter) storeError(err error, key string) {
+	storeErrorsCounter.Inc()
+
+	appLogger, loggerClose, loggerErr := l.loggerFactory.NewLogger()
+	if loggerErr != nil {
+		return
+	}
+	defer loggerClose()
+
+	appLogger.Error("rate limit store failed, letting the request through",
+		zap.Error(err),
+		zap.String("key", key),
+	)
+}
+
+func blockedFor(s State, now time.Time) time.Duration {
+	if !s.BlockedUntil.After(now) {
+		return 0
+	}
+
+	return seconds(s.BlockedUntil.Sub(now).Seconds())
+}
+
+func limitOf(l config.Limit) Limit {
+	return Limit{
+		Requests: l.Requests,
+		Period:   l.Period,
+		Burst:    l.Burst,
+	}
+}
@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/database"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/tests"
+)
+
+func TestTakeShouldRefillTokens(t *testing.T) {
+	limit := Limit{Requests: 60, Period: time.Minute, Burst: 2}
+	now := time.Now()
+
+	cases := []struct {
+		elapsed    time.Duration
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}{
+		{0, true, 1, 0},
+		{0, true, 0, 0},
+		{0, false, 0, time.Second},
+		{1500 * time.Millisecond, true, 0, 0},
+		{10 * time.Second, true, 1, 0},
+	}
+
+	s := State{}
+	for i, tc := range cases {
+		now = now.Add(tc.elapsed)
+
+		var result Result
+		s, result = take(s, now, limit)
+		if result.Allowed != tc.allowed || result.Remaining != tc.remaining || result.RetryAfter != tc.retryAfter || result.Limit != 2 {
+			t.Errorf("request %d: unexpected result %+v", i, result)
+		}
+	}
+}
+
+func TestFailShouldDoubleBlocks(t *testing.T) {
+	p := Penalty{Threshold: 1, Window: time.Hour, Block: time.Minute, MaxBlock: 3 * time.Minute}
+	now := time.Now()
+
+	// every second failure uses up the threshold
+	expected := []time.Duration{0, time.Minute, 0, 2 * time.Minute, 0, 3 * time.Minute}
+
+	s := State{}
+	for i, block := range expected {
+		s = fail(s, now, p)
+		if blocked := blockedFor(s, now); blocked != block {
+			t.Errorf("failure %d: expected block %v but was %v", i, block, blocked)
+		}
+
+		if block > 0 {
+			now = s.BlockedUntil
+		}
+	}
+
+	// strikes are forgotten after a quiet MaxBlock
+	now = now.Add(p.MaxBlock + time.Second)
+	s = fail(fail(s, now, p), now, p)
+	if blocked := blockedFor(s, now); blocked != time.Minute {
+		t.Errorf("expected block to start over but was %v", blocked)
+	}
+}
+
+func TestDbStoreShouldShareLimits(t *testing.T) {
+	c := &config.Config{}
+	c.Database.Provider = "sqlite"
+	// sqlite fails concurrent writers right away unless they may wait
+	c.Database.ConnectionString = filepath.Join(t.TempDir(), "ratelimit.db") + "?_pragma=busy_timeout(5000)"
+
+	dbf := database.NewFactory(c, logger.NewTestLoggerFactory())
+	if err := tests.MigrateDatabase(context.Background(), dbf); err != nil {
+		t.Fatal(err)
+	}
+
+	limit := Limit{Requests: 10, Period: time.Hour}
+	instances := []Limiter{
+		NewStoreLimiter(NewDbStore(dbf), limit, nil, Penalty{}, logger.NewTestLoggerFactory()),
+		NewStoreLimiter(NewDbStore(dbf), limit, nil, Penalty{}, logger.NewTestLoggerFactory()),
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(l Limiter) {
+			defer wg.Done()
+
+			if l.Take(context.Background(), "client", limit).Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}(instances[i%2])
+	}
+	wg.Wait()
+
+	if allowed != 8 {
+		t.Fatalf("expected 8 allowed requests but was %d", allowed)
+	}
+
+	result := instances[0].Take(context.Background(), "client", limit)
+	if !result.Allowed || result.Remaining != 1 {
+		t.Errorf("expected both instances to share the bucket but was %+v", result)
+	}
+}
+
+func TestLimiterShouldFollowReloadedLimits(t *testing.T) {
+	c := &config.Config{}
+	c.RateLimit.Enabled = true
+	c.RateLimit.Default = config.Limit{Requests: 10, Period: time.Minute}
+
+	store := config.NewStore(c)
+	l, err := NewLimiter(store, nil, logger.NewTestLoggerFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := *c
+	next.RateLimit.Routes = []config.RouteLimit{{Route: "/link", Limit: config.Limit{Requests: 1, Period: time.Second}}}
+	next.RateLimit.Penalty.Threshold = 1
+	next.RateLimit.Penalty.Window = time.Hour
+	next.RateLimit.Penalty.Block = time.Minute
+	if _, err = store.Apply(&next); err != nil {
+		t.Fatal(err)
+	}
+
+	if limit := l.Route("POST", "/link"); limit.Requests != 1 || limit.Period != time.Second {
+		t.Errorf("expected the reloaded route limit but was %+v", limit)
+	}
+
+	if limit := l.Route("GET", "/health"); limit.Requests != 10 {
+		t.Errorf("expected the default limit but was %+v", limit)
+	}
+
+	l.Fail(context.Background(), "client")
+	if blocked := l.Fail(context.Background(), "client"); blocked != time.Minute {
+		t.Errorf("expected the reloaded penalty to block but was %v", blocked)
+	}
+}
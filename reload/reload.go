@@ -0,0 +1,161 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	resultApplied   = "applied"
+	resultUnchanged = "unchanged"
+	resultRejected  = "rejected"
+	resultFailed    = "failed"
+)
+
+var reloadsCounter *prometheus.CounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "password_sharing_config_reloads",
+	Help: "The total number of configuration reloads by result",
+}, []string{"result"})
+
+var lastAppliedGauge prometheus.Gauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "password_sharing_config_last_applied_seconds",
+	Help: "The unix time the configuration was last changed by a reload",
+})
+
+// Watcher reloads the configuration file into a store.
+type Watcher interface {
+	// Reload reads, validates and applies the file. A configuration with
+	// changes that need a restart is rejected as a whole.
+	Reload() error
+	// Run reloads whenever the file changes, the process gets SIGHUP or
+	// Notify is called, until c is done.
+	Run(c context.Context)
+	// Notify asks Run to reload, e.g. after a layer changed.
+	Notify()
+}
+
+type watcher struct {
+	file          string
+	layers        []config.Layer
+	store         config.Store
+	loggerFactory logger.LoggerFactory
+	changes       chan struct{}
+}
+
+// NewWatcher returns a watcher reading file with layers the way
+// config.LoadConfig does.
+func NewWatcher(file string, store config.Store, loggerFactory logger.LoggerFactory, layers ...config.Layer) Watcher {
+	return &watcher{
+		file:          file,
+		layers:        layers,
+		store:         store,
+		loggerFactory: loggerFactory,
+		changes:       make(chan struct{}, 1),
+	}
+}
+
+func (w *watcher) Reload() error {
+	appLogger, loggerClose, err := w.loggerFactory.NewLogger()
+	if err != nil {
+		return err
+	}
+	defer loggerClose()
+
+	result, changed, err := w.reload()
+	reloadsCounter.WithLabelValues(result).Inc()
+
+	switch result {
+	case resultApplied:
+		lastAppliedGauge.SetToCurrentTime()
+		appLogger.Info("configuration reloaded",
+			zap.String("file", w.file),
+			zap.Strings("changed", changed),
+		)
+	case resultUnchanged:
+		appLogger.Debug("configuration unchanged",
+			zap.String("file", w.file),
+		)
+	default:
+		// errors name keys and files, never values
+		appLogger.Error("configuration not reloaded",
+			zap.Error(err),
+			zap.String("file", w.file),
+			zap.String("result", result),
+		)
+	}
+
+	return err
+}
+
+func (w *watcher) reload() (string, []string, error) {
+	c, err := config.Read(w.file, w.layers...)
+	if err != nil {
+		return resultFailed, nil, err
+	}
+
+	if err = config.Validate(c); err != nil {
+		return resultFailed, nil, err
+	}
+
+	changed, err := w.store.Apply(c)
+	var unsafe *config.UnsafeChangeError
+	if errors.As(err, &unsafe) {
+		return resultRejected, nil, err
+	}
+
+	if err != nil {
+		return resultFailed, nil, err
+	}
+
+	if len(changed) == 0 {
+		return resultUnchanged, nil, nil
+	}
+
+	return resultApplied, changed, nil
+}
+
+func (w *watcher) Run(c context.Context) {
+	// viper follows the file through renames and symlink swaps, e.g. of a
+	// Kubernetes config map. Its watch cannot be stopped, changes are only
+	// dropped once c is done.
+	v := viper.New()
+	v.SetConfigFile(w.file)
+	v.OnConfigChange(func(fsnotify.Event) {
+		w.Notify()
+	})
+	v.WatchConfig()
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	for {
+		select {
+		case <-c.Done():
+			return
+		case <-hangups:
+			w.Reload()
+		case <-w.changes:
+			w.Reload()
+		}
+	}
+}
+
+// Notify coalesces bursts, e.g. the events a single save causes.
+func (w *watcher) Notify() {
+	select {
+	case w.changes <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,169 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap/zapcore"
+)
+
+const configuration = `
+database:
+  connectionstring: host=localhost
+app:
+  basepath: http://localhost/api/v1/pwd
+  port: 4000
+request:
+  basepath: http://localhost/api/v1/request
+  maxttl: 24h
+encrypt:
+  secret: bybBGV1Q1sSp9I2tVK0ysd1c
+  iv: [1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16]
+discovery:
+  provider: none
+notify:
+  provider: log
+zap:
+  level: 0
+`
+
+func writeConfig(t *testing.T, file string, replacements ...string) {
+	content := strings.NewReplacer(replacements...).Replace(configuration)
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newStore(t *testing.T, file string) config.Store {
+	writeConfig(t, file)
+
+	c, err := config.Read(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return config.NewStore(c)
+}
+
+func TestReloadShouldApplySafeChanges(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.yaml")
+	store := newStore(t, file)
+	w := NewWatcher(file, store, logger.NewTestLoggerFactory())
+
+	applied := testutil.ToFloat64(reloadsCounter.WithLabelValues(resultApplied))
+	writeConfig(t, file, "level: 0", "level: 1", "maxttl: 24h", "maxttl: 1h")
+
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	c := store.Current()
+	if c.Zap.Level != zapcore.WarnLevel || c.Request.MaxTtl != time.Hour {
+		t.Errorf("expected the new level and ttl but was %v and %v", c.Zap.Level, c.Request.MaxTtl)
+	}
+
+	if actual := testutil.ToFloat64(reloadsCounter.WithLabelValues(resultApplied)); actual != applied+1 {
+		t.Errorf("expected an applied reload to be counted but was %v", actual-applied)
+	}
+}
+
+type layer map[string]interface{}
+
+func (l layer) Values() map[string]interface{} {
+	return l
+}
+
+func TestReloadShouldApplyLayers(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.yaml")
+	store := newStore(t, file)
+
+	kv := layer{"request": map[string]interface{}{"maxttl": "2h"}}
+	if err := NewWatcher(file, store, logger.NewTestLoggerFactory(), kv).Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ttl := store.Current().Request.MaxTtl; ttl != 2*time.Hour {
+		t.Errorf("expected the ttl of the layer but was %v", ttl)
+	}
+}
+
+func TestReloadShouldKeepConfigurationOnErrors(t *testing.T) {
+	cases := []struct {
+		name         string
+		replacements []string
+		result       string
+	}{
+		{"unsafe change", []string{"port: 4000", "port: 4001", "level: 0", "level: 1"}, resultRejected},
+		{"invalid", []string{"maxttl: 24h", "maxttl: -1h"}, resultFailed},
+		{"unreadable", []string{"zap:", "zap"}, resultFailed},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "test.yaml")
+			store := newStore(t, file)
+			initial := store.Current()
+			w := NewWatcher(file, store, logger.NewTestLoggerFactory())
+
+			before := testutil.ToFloat64(reloadsCounter.WithLabelValues(tc.result))
+			writeConfig(t, file, tc.replacements...)
+
+			err := w.Reload()
+			if err == nil {
+				t.Fatal("expected the reload to fail")
+			}
+
+			var unsafe *config.UnsafeChangeError
+			if errors.As(err, &unsafe) != (tc.result == resultRejected) {
+				t.Errorf("unexpected error %v", err)
+			}
+
+			if store.Current() != initial {
+				t.Errorf("expected the configuration to stay as it was")
+			}
+
+			if actual := testutil.ToFloat64(reloadsCounter.WithLabelValues(tc.result)); actual != before+1 {
+				t.Errorf("expected the reload to be counted as %s", tc.result)
+			}
+		})
+	}
+}
+
+func TestRunShouldReloadOnFileChanges(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.yaml")
+	store := newStore(t, file)
+
+	reloaded := make(chan *config.Config, 1)
+	store.Subscribe(func(c *config.Config) {
+		reloaded <- c
+	})
+
+	c, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go NewWatcher(file, store, logger.NewTestLoggerFactory()).Run(c)
+
+	// the watch starts in the background, keep writing until it notices
+	for attempt := 0; attempt < 50; attempt++ {
+		writeConfig(t, file, "level: 0", "level: -1")
+
+		select {
+		case next := <-reloaded:
+			if next.Zap.Level != zapcore.DebugLevel {
+				t.Errorf("expected debug level but was %v", next.Zap.Level)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	t.Fatal("configuration was not reloaded")
+}
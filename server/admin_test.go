@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/controller"
+	"github.com/misikdmitriy/password-sharing/discovery"
+	"github.com/misikdmitriy/password-sharing/health"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/tenant"
+)
+
+func TestAdminListenerShouldServeInternalRoutes(t *testing.T) {
+	c := &config.Config{}
+	c.App.Port = freePort(t)
+	c.App.AdminPort = freePort(t)
+
+	tenants, err := tenant.NewRegistry(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(logger.NewTestLoggerFactory(), c, &testAuthenticator{}, tenants, nil, discovery.NewNoopRegistrar(), nil,
+		[]controller.Controller{controller.NewBuildInfoController(), controller.NewHealthController("/health", health.NewProbe(0, 0))},
+		&clientIpController{}).(*server)
+
+	ctxt, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- s.run(ctxt)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	public := fmt.Sprintf("http://127.0.0.1:%d", c.App.Port)
+	admin := fmt.Sprintf("http://127.0.0.1:%d", c.App.AdminPort)
+
+	get := func(url string) (int, string) {
+		for attempt := 0; ; attempt++ {
+			r, err := http.Get(url)
+			if err != nil {
+				if attempt == 50 {
+					t.Fatal(err)
+				}
+
+				// the server may not listen yet
+				time.Sleep(20 * time.Millisecond)
+				continue
+			}
+			defer r.Body.Close()
+
+			body, _ := io.ReadAll(r.Body)
+			return r.StatusCode, string(body)
+		}
+	}
+
+	// a request to count
+	if status, _ := get(public + apiPrefix + "/ip"); status != http.StatusOK {
+		t.Fatalf("expected the api to be served but was %d", status)
+	}
+
+	cases := []struct {
+		name     string
+		url      string
+		status   int
+		contains string
+	}{
+		{"metrics", admin + metricsPath, http.StatusOK, "gin_request_total"},
+		{"pprof", admin + pprofPrefix + "/goroutine?debug=1", http.StatusOK, "goroutine profile"},
+		{"build info", admin + "/buildinfo", http.StatusOK, `"version":"dev"`},
+		{"health", admin + "/health", http.StatusOK, `"healthy":true`},
+		{"public metrics", public + metricsPath, http.StatusNotFound, ""},
+		{"public pprof", public + pprofPrefix + "/", http.StatusNotFound, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := get(tc.url)
+			if status != tc.status {
+				t.Fatalf("expected status %d but was %d", tc.status, status)
+			}
+
+			if !strings.Contains(body, tc.contains) {
+				t.Errorf("expected the response to contain %s but was %s", tc.contains, body)
+			}
+		})
+	}
+}
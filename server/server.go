@@ -1,46 +1,120 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
-	"os"
+	"net/http/pprof"
 	"os/signal"
 	"syscall"
 	"time"
 
 	ginzap "github.com/gin-contrib/zap"
 	"github.com/gin-gonic/gin"
-	"github.com/hashicorp/consul/api"
+	"github.com/misikdmitriy/password-sharing/auth"
 	"github.com/misikdmitriy/password-sharing/config"
 	"github.com/misikdmitriy/password-sharing/controller"
+	"github.com/misikdmitriy/password-sharing/discovery"
+	pserror "github.com/misikdmitriy/password-sharing/error"
 	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/middleware"
+	"github.com/misikdmitriy/password-sharing/openapi"
+	"github.com/misikdmitriy/password-sharing/ratelimit"
+	"github.com/misikdmitriy/password-sharing/tenant"
+	"github.com/misikdmitriy/password-sharing/tlsconfig"
 	"github.com/penglongli/gin-metrics/ginmetrics"
 	"go.uber.org/zap"
 )
 
 type Server interface {
 	Run() error
+	// OnDrain runs drain when shutdown starts, before the drain period.
+	OnDrain(drain func())
+	// OnStop runs stop after the last request was served. Jobs are stopped
+	// in the order they were added.
+	OnStop(name string, stop func(context.Context) error)
+}
+
+type stopJob struct {
+	name string
+	stop func(context.Context) error
 }
 
 type server struct {
 	controllers   []controller.Controller
+	admin         []controller.Controller
+	internal      []controller.Controller
 	loggerFactory logger.LoggerFactory
 	config        *config.Config
+	authenticator auth.Authenticator
+	tenants       tenant.Registry
+	limiter       ratelimit.Limiter
+	registrar     discovery.Registrar
+	drains        []func()
+	jobs          []stopJob
 }
 
-func NewServer(loggerFactory logger.LoggerFactory, config *config.Config, controllers ...controller.Controller) Server {
-	return &server{
+func NewServer(loggerFactory logger.LoggerFactory,
+	config *config.Config,
+	authenticator auth.Authenticator,
+	tenants tenant.Registry,
+	limiter ratelimit.Limiter,
+	registrar discovery.Registrar,
+	admin []controller.Controller,
+	internal []controller.Controller,
+	controllers ...controller.Controller) Server {
+	s := &server{
 		controllers:   controllers,
+		admin:         admin,
+		internal:      internal,
 		config:        config,
 		loggerFactory: loggerFactory,
+		authenticator: authenticator,
+		tenants:       tenants,
+		limiter:       limiter,
+		registrar:     registrar,
 	}
+
+	return s
+}
+
+const (
+	apiPrefix   = "/api/v1"
+	adminPrefix = "/admin"
+	apiTitle    = "password-sharing"
+	apiVersion  = "1.0.0"
+	openapiPath = "/openapi.json"
+	metricsPath = "/metrics"
+	pprofPrefix = "/debug/pprof"
+)
+
+const (
+	defaultShutdownTimeout = 30 * time.Second
+	deregisterTimeout      = 5 * time.Second
+)
+
+func (s *server) OnDrain(drain func()) {
+	s.drains = append(s.drains, drain)
 }
 
-const serviceName = "passwordsharing"
-const healthCheck = "healthcheck"
+func (s *server) OnStop(name string, stop func(context.Context) error) {
+	s.jobs = append(s.jobs, stopJob{name: name, stop: stop})
+}
 
+// Run serves until SIGINT or SIGTERM and shuts down gracefully.
 func (s *server) Run() error {
+	ctxt, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	return s.run(ctxt)
+}
+
+// run serves until ctxt is done. Shutdown deregisters the instance, reports
+// it unhealthy, waits the drain period, lets in-flight requests finish and
+// then stops the background jobs. The logger is flushed last.
+func (s *server) run(ctxt context.Context) error {
 	appLogger, closeLogger, err := s.loggerFactory.NewLogger()
 	if err != nil {
 		return err
@@ -48,105 +122,390 @@ func (s *server) Run() error {
 	defer closeLogger()
 
 	appLogger.Info("starting web server...")
-	router, err := s.buildRouter(appLogger)
+	servers, err := s.listen(appLogger)
 	if err != nil {
 		return err
 	}
 
-	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.config.App.Port),
-		Handler: router,
+	// buffered, nobody receives once shutdown started
+	served := make(chan error, len(servers))
+	for _, hs := range servers {
+		go func(hs httpServer) {
+			served <- hs.serve()
+		}(hs)
 	}
 
-	startupFailed := make(chan interface{}, 1)
-	defer close(startupFailed)
+	// registration retries until the registry is up, a stop signal in the
+	// meantime is an ordinary shutdown
+	if err = s.registrar.Register(ctxt); err != nil && ctxt.Err() == nil {
+		closeAll(servers)
+		s.stopJobs(appLogger, context.Background())
+		return err
+	}
 
-	go func() {
-		if err := srv.ListenAndServe(); err != nil {
-			startupFailed <- true
-		}
-	}()
+	select {
+	case <-ctxt.Done():
+	case err := <-served:
+		appLogger.Error("web server stopped unexpectedly", zap.Error(err))
+		closeAll(servers)
+		s.deregister(appLogger)
+		s.stopJobs(appLogger, context.Background())
+		return err
+	}
+
+	return s.shutdown(appLogger, servers)
+}
+
+type httpServer struct {
+	name  string
+	srv   *http.Server
+	serve func() error
+}
 
-	deregister, err := s.registerInConsul()
+// listen binds the API port and the admin port. Listening happens before
+// the registration, an instance that cannot bind its ports is never
+// announced.
+func (s *server) listen(appLogger *zap.Logger) ([]httpServer, error) {
+	router, err := s.buildRouter(appLogger)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	tlsConfig, err := tlsconfig.NewConfig(s.config, s.loggerFactory)
+	if err != nil {
+		return nil, err
 	}
 
-	quit := make(chan os.Signal, 1)
-	defer close(quit)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.config.App.Port))
+	if err != nil {
+		return nil, err
+	}
 
-	select {
-	case <-quit:
-		log.Println("shutdown web server ...")
-		deregister()
-		return nil
-	case <-startupFailed:
-		return fmt.Errorf("error on server start")
+	api := &http.Server{
+		Handler:   router,
+		TLSConfig: tlsConfig,
+	}
+
+	servers := []httpServer{
+		{name: "api", srv: api, serve: func() error { return serve(api, listener, tlsConfig) }},
+	}
+
+	if s.config.App.AdminPort <= 0 {
+		return servers, nil
+	}
+
+	adminRouter, err := s.buildAdminRouter(appLogger)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	adminListener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.config.App.AdminPort))
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	admin := &http.Server{
+		Handler: adminRouter,
+	}
+
+	return append(servers, httpServer{name: "admin", srv: admin, serve: func() error { return admin.Serve(adminListener) }}), nil
+}
+
+func serve(srv *http.Server, listener net.Listener, tlsConfig *tls.Config) error {
+	if tlsConfig == nil {
+		return srv.Serve(listener)
+	}
+
+	// the certificate comes from tlsConfig, which reloads it
+	return srv.ServeTLS(listener, "", "")
+}
+
+func closeAll(servers []httpServer) {
+	for _, hs := range servers {
+		hs.srv.Close()
+	}
+}
+
+// shutdown stops the servers in order, the admin server goes last so the
+// drain can still be watched and scraped.
+func (s *server) shutdown(appLogger *zap.Logger, servers []httpServer) error {
+	appLogger.Info("shutting down web server...")
+
+	s.deregister(appLogger)
+	for _, drain := range s.drains {
+		drain()
+	}
+
+	if s.config.App.DrainPeriod > 0 {
+		appLogger.Info("draining", zap.Duration("period", s.config.App.DrainPeriod))
+		time.Sleep(s.config.App.DrainPeriod)
+	}
+
+	timeout := s.config.App.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+
+	ctxt, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var err error
+	for _, hs := range servers {
+		if shutdownErr := hs.srv.Shutdown(ctxt); shutdownErr != nil {
+			appLogger.Error("in-flight requests did not finish in time",
+				zap.Error(shutdownErr),
+				zap.String("server", hs.name),
+			)
+			hs.srv.Close()
+
+			if err == nil {
+				err = shutdownErr
+			}
+		}
+	}
+
+	// jobs get a timeout of their own, requests may have used up the first
+	jobsCtxt, jobsCancel := context.WithTimeout(context.Background(), timeout)
+	defer jobsCancel()
+	s.stopJobs(appLogger, jobsCtxt)
+
+	appLogger.Info("web server stopped")
+	return err
+}
+
+func (s *server) deregister(appLogger *zap.Logger) {
+	ctxt, cancel := context.WithTimeout(context.Background(), deregisterTimeout)
+	defer cancel()
+
+	if err := s.registrar.Deregister(ctxt); err != nil {
+		appLogger.Error("failed to deregister", zap.Error(err))
+	}
+}
+
+func (s *server) stopJobs(appLogger *zap.Logger, ctxt context.Context) {
+	for _, job := range s.jobs {
+		if err := job.stop(ctxt); err != nil {
+			appLogger.Error("failed to stop job",
+				zap.Error(err),
+				zap.String("job", job.name),
+			)
+		}
 	}
 }
 
 func (s *server) buildRouter(appLogger *zap.Logger) (*gin.Engine, error) {
 	router := gin.Default()
+	// lets services read the principal set by the auth middleware from gin.Context
+	router.ContextWithFallback = true
+
+	// gin trusts X-Forwarded-For from everyone by default, allowlists would
+	// be trivial to bypass
+	if err := router.SetTrustedProxies(s.config.App.TrustedProxies); err != nil {
+		return nil, err
+	}
 
 	router.Use(ginzap.Ginzap(appLogger, time.RFC3339, true))
 	router.Use(ginzap.RecoveryWithZap(appLogger, true))
+	router.Use(middleware.RequestId())
 
-	metrics := ginmetrics.GetMonitor()
+	// the metrics are exposed on the admin port only
+	ginmetrics.GetMonitor().UseWithoutExposingEndpoint(router)
 
-	metrics.SetMetricPath("/metrics")
-	metrics.Use(router)
+	api := router.Group(apiPrefix)
+	routes := make([]openapi.Route, 0, len(s.controllers))
+	resolveTenant := middleware.ResolveTenant(s.tenants)
 
 	for _, ctrl := range s.controllers {
-		method := ctrl.Method()
-
-		switch method {
-		case http.MethodGet:
-			router.GET(ctrl.Route(), ctrl.Hander())
-		case http.MethodPost:
-			router.POST(ctrl.Route(), ctrl.Hander())
-		default:
-			return nil, fmt.Errorf("cannot create HTTP handler of method %s", method)
+		requirement := ctrl.Auth()
+		clientCert := s.clientCert(s.createRoute(requirement))
+		authenticate := middleware.Authenticate(s.authenticator, requirement, s.optionalAuth(requirement))
+		// both versions of a route share the buckets
+		rateLimit := s.rateLimit(ctrl.Method(), ctrl.Route())
+
+		if err := handle(api, ctrl.Method(), ctrl.Route(), clientCert, authenticate, rateLimit, resolveTenant, ctrl.Hander()); err != nil {
+			return nil, err
+		}
+
+		// routes existed without version prefix before /api/v1 was introduced
+		legacy := router.Group("", deprecated(apiPrefix+ctrl.Route()))
+		if err := handle(legacy, ctrl.Method(), ctrl.Route(), clientCert, authenticate, rateLimit, resolveTenant, ctrl.Hander()); err != nil {
+			return nil, err
+		}
+
+		route := openapi.Route{
+			Method:    ctrl.Method(),
+			Path:      ctrl.Route(),
+			Operation: s.document(ctrl.Doc(), s.createRoute(requirement)),
 		}
+		if !s.optionalAuth(requirement) {
+			for _, scope := range requirement.Scopes {
+				route.Scopes = append(route.Scopes, string(scope))
+			}
+		}
+
+		routes = append(routes, route)
 	}
 
+	// every admin route needs at least read access, the routes that change
+	// something check for the admin role on top
+	// the admin API works on the tenant of the credential
+	adminGroup := api.Group(adminPrefix, s.clientCert(true), middleware.Authenticate(s.authenticator, auth.Require(auth.ScopeAdminRead), false), resolveTenant)
+	for _, ctrl := range s.admin {
+		rateLimit := s.rateLimit(ctrl.Method(), adminPrefix+ctrl.Route())
+		if err := handle(adminGroup, ctrl.Method(), ctrl.Route(), rateLimit, middleware.Authorize(ctrl.Auth()), ctrl.Hander()); err != nil {
+			return nil, err
+		}
+
+		route := openapi.Route{
+			Method:    ctrl.Method(),
+			Path:      adminPrefix + ctrl.Route(),
+			Operation: s.document(ctrl.Doc(), true),
+		}
+		for _, scope := range ctrl.Auth().Scopes {
+			route.Scopes = append(route.Scopes, string(scope))
+		}
+
+		routes = append(routes, route)
+	}
+
+	routes = append(routes, openapi.Route{
+		Method: http.MethodGet,
+		Path:   openapiPath,
+		Operation: openapi.Operation{
+			Summary: "Get this OpenAPI document",
+		},
+	})
+
+	document := openapi.Build(apiTitle, apiVersion, apiPrefix, routes)
+	api.GET(openapiPath, func(c *gin.Context) {
+		c.JSON(http.StatusOK, document)
+	})
+
 	return router, nil
 }
 
-func (s *server) registerInConsul() (func(), error) {
-	client, err := api.NewClient(&api.Config{
-		Address: s.config.App.ConsulAddress,
-		Scheme:  "http",
-	})
-	if err != nil {
-		return nil, err
+// buildAdminRouter serves the internal routes on the admin port. It is
+// meant for the internal network and has neither TLS nor authentication.
+func (s *server) buildAdminRouter(appLogger *zap.Logger) (*gin.Engine, error) {
+	router := gin.New()
+	router.Use(ginzap.RecoveryWithZap(appLogger, true))
+
+	metrics := ginmetrics.GetMonitor()
+	metrics.SetMetricPath(metricsPath)
+	metrics.Expose(router)
+
+	debug := router.Group(pprofPrefix)
+	debug.GET("/", gin.WrapF(pprof.Index))
+	debug.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	debug.GET("/profile", gin.WrapF(pprof.Profile))
+	debug.GET("/symbol", gin.WrapF(pprof.Symbol))
+	debug.POST("/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/trace", gin.WrapF(pprof.Trace))
+	// heap, goroutine, allocs and the other runtime profiles
+	debug.GET("/:profile", gin.WrapF(pprof.Index))
+
+	for _, ctrl := range s.internal {
+		if err := handle(router.Group(""), ctrl.Method(), ctrl.Route(), ctrl.Hander()); err != nil {
+			return nil, err
+		}
 	}
 
-	registration := &api.AgentServiceRegistration{
-		ID:      fmt.Sprintf("%s-%d", serviceName, s.config.App.ServiceId),
-		Name:    serviceName,
-		Port:    s.config.App.Port,
-		Address: s.config.App.Address,
-		Checks: []*api.AgentServiceCheck{
-			{
-				CheckID:  fmt.Sprintf("%s-%d", healthCheck, s.config.App.ServiceId),
-				Name:     healthCheck,
-				Timeout:  "5s",
-				HTTP:     fmt.Sprintf("http://%s:%d/health", s.config.App.Address, s.config.App.Port),
-				Method:   http.MethodGet,
-				Interval: "15s",
-			},
-		},
+	return router, nil
+}
+
+// optionalAuth reports whether anonymous callers may use a route despite its
+// requirement, which is the case for creation when anonymous creation is on.
+func (s *server) optionalAuth(requirement auth.Requirement) bool {
+	if !s.config.Auth.AnonymousCreate || requirement.IsAnonymous() {
+		return false
 	}
 
-	err = client.Agent().ServiceRegister(registration)
-	if err != nil {
-		return nil, err
+	for _, scope := range requirement.Scopes {
+		if scope != auth.ScopeCreate {
+			return false
+		}
 	}
 
-	deregister := func() {
-		client.Agent().ServiceDeregister(registration.ID)
+	return true
+}
+
+// rateLimit limits a route, it does nothing when rate limiting is off.
+func (s *server) rateLimit(method string, route string) gin.HandlerFunc {
+	if s.limiter == nil {
+		return func(c *gin.Context) {
+			c.Next()
+		}
 	}
 
-	return deregister, nil
+	return middleware.RateLimit(s.limiter, method, route)
+}
+
+// createRoute reports whether a route creates secrets.
+func (s *server) createRoute(requirement auth.Requirement) bool {
+	for _, scope := range requirement.Scopes {
+		if scope == auth.ScopeCreate {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientCert requires a client certificate when mutual TLS is on and
+// required is set, which is the case for admin and creation routes.
+func (s *server) clientCert(required bool) gin.HandlerFunc {
+	if !required || !s.mutualTls() {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	return middleware.RequireClientCert()
+}
+
+func (s *server) mutualTls() bool {
+	return s.config.Tls.Enabled && s.config.Tls.ClientCaFile != ""
+}
+
+// document adds the errors every route may answer with to operation,
+// clientCert tells whether the route needs a client certificate.
+func (s *server) document(operation openapi.Operation, clientCert bool) openapi.Operation {
+	if s.limiter != nil {
+		operation.Errors = append(operation.Errors, pserror.RateLimited)
+	}
+
+	if clientCert && s.mutualTls() {
+		operation.Errors = append(operation.Errors, pserror.ClientCertificateRequired)
+	}
+
+	return operation
+}
+
+func handle(group *gin.RouterGroup, method string, route string, handlers ...gin.HandlerFunc) error {
+	switch method {
+	case http.MethodGet:
+		group.GET(route, handlers...)
+	case http.MethodPost:
+		group.POST(route, handlers...)
+	case http.MethodDelete:
+		group.DELETE(route, handlers...)
+	default:
+		return fmt.Errorf("cannot create HTTP handler of method %s", method)
+	}
+
+	return nil
+}
+
+// deprecated marks unversioned routes and points clients to the successor
+// route, see draft-ietf-httpapi-deprecation-header.
+func deprecated(successor string) gin.HandlerFunc {
+	link := fmt.Sprintf("<%s>; rel=\"successor-version\"", openapi.PathOf(successor))
+
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", link)
+		c.Next()
+	}
 }
@@ -0,0 +1,482 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/misikdmitriy/password-sharing/auth"
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/controller"
+	"github.com/misikdmitriy/password-sharing/discovery"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/health"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/middleware"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/openapi"
+	"github.com/misikdmitriy/password-sharing/ratelimit"
+	"github.com/misikdmitriy/password-sharing/service"
+	"github.com/misikdmitriy/password-sharing/tenant"
+	"go.uber.org/zap"
+)
+
+type testAuthenticator struct {
+	keys map[string]*auth.Principal
+}
+
+func (a *testAuthenticator) Authenticate(_ context.Context, credential string) (*auth.Principal, error) {
+	if p, ok := a.keys[credential]; ok {
+		return p, nil
+	}
+
+	return nil, &pserror.PasswordSharingError{Code: pserror.InvalidCredentials}
+}
+
+func newTestRouter(t *testing.T) *gin.Engine {
+	c := &config.Config{}
+
+	authenticator := &testAuthenticator{
+		keys: map[string]*auth.Principal{
+			"status": {Subject: "status", Scopes: []auth.Scope{auth.ScopeStatus}},
+			"reader": {Subject: "reader", Scopes: []auth.Scope{auth.ScopeAdminRead}},
+		},
+	}
+
+	tenants, err := tenant.NewRegistry(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(logger.NewTestLoggerFactory(), c, authenticator, tenants, nil, discovery.NewNoopRegistrar(),
+		[]controller.Controller{
+			controller.NewAdminStatsController(nil),
+			controller.NewAdminDeleteSecretController(nil),
+		},
+		nil,
+		controller.NewCreateLinkController(nil, nil, c, nil),
+		controller.NewGetLinkController(nil),
+		controller.NewLinkStatusController(nil),
+		controller.NewCreateRequestController(nil, c),
+		controller.NewGetRequestController(nil),
+		controller.NewFulfillRequestController(nil),
+		controller.NewGetRequestSecretController(nil),
+		controller.NewGenerateController(nil, nil, c, nil),
+		controller.NewPublicHealthController("/health", health.NewProbe(0, 0, health.Check{Name: "readiness", Critical: true, Check: health.NewReadiness()})),
+	).(*server)
+
+	router, err := s.buildRouter(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return router
+}
+
+func TestOpenApiShouldDescribeRegisteredRoutes(t *testing.T) {
+	router := newTestRouter(t)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, apiPrefix+openapiPath, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d but was %d", http.StatusOK, w.Code)
+	}
+
+	document := struct {
+		OpenApi string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+
+	if document.OpenApi != openapi.Version {
+		t.Errorf("expected openapi version %s but was %s", openapi.Version, document.OpenApi)
+	}
+
+	registered := map[string]bool{}
+	for _, route := range router.Routes() {
+		if !strings.HasPrefix(route.Path, apiPrefix) {
+			continue
+		}
+
+		key := route.Method + " " + openapi.PathOf(route.Path)
+		registered[key] = true
+
+		if _, ok := document.Paths[openapi.PathOf(route.Path)][strings.ToLower(route.Method)]; !ok {
+			t.Errorf("route %s is not described", key)
+		}
+	}
+
+	for path, item := range document.Paths {
+		for method := range item {
+			key := strings.ToUpper(method) + " " + path
+			if !registered[key] {
+				t.Errorf("described route %s is not registered", key)
+			}
+		}
+	}
+}
+
+func TestLegacyRoutesShouldBeDeprecated(t *testing.T) {
+	router := newTestRouter(t)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	if w.Header().Get("Deprecation") != "true" {
+		t.Errorf("expected legacy route to have Deprecation header")
+	}
+
+	if link := w.Header().Get("Link"); link != `<`+apiPrefix+`/health>; rel="successor-version"` {
+		t.Errorf("unexpected Link header %s", link)
+	}
+}
+
+func TestPublicHealthShouldNotListChecks(t *testing.T) {
+	router := newTestRouter(t)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, apiPrefix+"/health", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d but was %d", http.StatusOK, w.Code)
+	}
+
+	response := map[string]json.RawMessage{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := response["checks"]; ok || string(response["status"]) != `"pass"` {
+		t.Errorf("expected the status only but was %s", w.Body.String())
+	}
+}
+
+func TestProtectedRoutesShouldRequireScope(t *testing.T) {
+	router := newTestRouter(t)
+
+	cases := []struct {
+		name       string
+		credential string
+		code       int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"invalid key", "unknown", http.StatusUnauthorized},
+		{"missing scope", "status", http.StatusForbidden},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, apiPrefix+"/link", strings.NewReader(`{"password":"secret"}`))
+			if tc.credential != "" {
+				r.Header.Set("Authorization", "Bearer "+tc.credential)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != tc.code {
+				t.Errorf("expected status %d but was %d", tc.code, w.Code)
+			}
+		})
+	}
+}
+
+func TestAdminRoutesShouldRequireRole(t *testing.T) {
+	router := newTestRouter(t)
+
+	cases := []struct {
+		name       string
+		credential string
+		code       pserror.ErrorCodes
+	}{
+		{"anonymous", "", pserror.Unauthorized},
+		{"no admin scope", "status", pserror.Forbidden},
+		{"read only", "reader", pserror.InsufficientRole},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodDelete, apiPrefix+adminPrefix+"/secrets/abc", nil)
+			if tc.credential != "" {
+				r.Header.Set("Authorization", "Bearer "+tc.credential)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			problem := struct {
+				Code pserror.ErrorCodes `json:"code"`
+			}{}
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatal(err)
+			}
+
+			if problem.Code != tc.code {
+				t.Errorf("expected error code %d but was %d", tc.code, problem.Code)
+			}
+		})
+	}
+}
+
+// tenantAdminService answers stats for the tenant it is called with.
+type tenantAdminService struct {
+	service.AdminService
+}
+
+func (s *tenantAdminService) SecretStats(c context.Context) ([]service.SecretStats, error) {
+	t := tenant.From(c)
+	if t == nil {
+		return nil, nil
+	}
+
+	return []service.SecretStats{{TenantId: t.Id}}, nil
+}
+
+func TestAdminRoutesShouldUseTenantOfCredential(t *testing.T) {
+	c := &config.Config{}
+	c.Tenancy.Tenants = []config.Tenant{{Id: "default"}, {Id: "finance"}}
+
+	tenants, err := tenant.NewRegistry(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator := &testAuthenticator{
+		keys: map[string]*auth.Principal{
+			"finance-admin": {Subject: "finance-admin", Tenant: "finance", Scopes: []auth.Scope{auth.ScopeAdmin}},
+		},
+	}
+
+	s := NewServer(logger.NewTestLoggerFactory(), c, authenticator, tenants, nil, discovery.NewNoopRegistrar(),
+		[]controller.Controller{
+			controller.NewAdminStatsController(&tenantAdminService{}),
+		},
+		nil,
+	).(*server)
+
+	router, err := s.buildRouter(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, apiPrefix+adminPrefix+"/secrets/stats", nil)
+	r.Header.Set("Authorization", "Bearer finance-admin")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+
+	response := model.SecretStatsResponse{}
+	if err = json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusOK || len(response.Tenants) != 1 || response.Tenants[0].Tenant != "finance" {
+		t.Errorf("expected the stats of finance but was %d %s", w.Code, w.Body.String())
+	}
+}
+
+type clientIpController struct{}
+
+func (ctrl *clientIpController) Hander() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.String(http.StatusOK, c.ClientIP())
+	}
+}
+
+func (ctrl *clientIpController) Route() string {
+	return "/ip"
+}
+
+func (ctrl *clientIpController) Method() string {
+	return http.MethodGet
+}
+
+func (ctrl *clientIpController) Doc() openapi.Operation {
+	return openapi.Operation{}
+}
+
+func (ctrl *clientIpController) Auth() auth.Requirement {
+	return auth.Anonymous
+}
+
+func TestForwardedForShouldOnlyBeTrustedFromProxies(t *testing.T) {
+	c := &config.Config{}
+	c.App.TrustedProxies = []string{"10.0.0.0/8"}
+
+	tenants, err := tenant.NewRegistry(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(logger.NewTestLoggerFactory(), c, &testAuthenticator{}, tenants, nil, discovery.NewNoopRegistrar(), nil, nil, &clientIpController{}).(*server)
+	router, err := s.buildRouter(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		expected   string
+	}{
+		{"trusted proxy", "10.1.2.3:40000", "203.0.113.7"},
+		{"direct client", "198.51.100.4:40000", "198.51.100.4"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, apiPrefix+"/ip", nil)
+			r.RemoteAddr = tc.remoteAddr
+			r.Header.Set("X-Forwarded-For", "203.0.113.7")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Body.String() != tc.expected {
+				t.Errorf("expected client ip %s but was %s", tc.expected, w.Body.String())
+			}
+		})
+	}
+}
+
+type notFoundController struct{}
+
+func (ctrl *notFoundController) Hander() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		middleware.WriteError(c, &pserror.PasswordSharingError{Code: pserror.PasswordNotFound})
+	}
+}
+
+func (ctrl *notFoundController) Route() string {
+	return "/pwd/:link"
+}
+
+func (ctrl *notFoundController) Method() string {
+	return http.MethodGet
+}
+
+func (ctrl *notFoundController) Doc() openapi.Operation {
+	return openapi.Operation{}
+}
+
+func (ctrl *notFoundController) Auth() auth.Requirement {
+	return auth.Anonymous
+}
+
+func TestRateLimitShouldFollowReloadedLimits(t *testing.T) {
+	c := &config.Config{}
+	c.RateLimit.Enabled = true
+
+	tenants, err := tenant.NewRegistry(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := config.NewStore(c)
+	limiter, err := ratelimit.NewLimiter(store, nil, logger.NewTestLoggerFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(logger.NewTestLoggerFactory(), c, &testAuthenticator{}, tenants, limiter, discovery.NewNoopRegistrar(), nil, nil,
+		&clientIpController{}).(*server)
+	router, err := s.buildRouter(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, apiPrefix+"/ip", nil)
+		r.RemoteAddr = "198.51.100.4:40000"
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := get(); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected %d without a limit but was %d", i, http.StatusOK, w.Code)
+		}
+	}
+
+	next := *c
+	next.RateLimit.Routes = []config.RouteLimit{{Route: "/ip", Limit: config.Limit{Requests: 1, Period: time.Minute}}}
+	if _, err = store.Apply(&next); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := get(); w.Code != http.StatusOK || w.Header().Get(middleware.RateLimitLimitHeader) != "1" {
+		t.Fatalf("expected %d with the reloaded limit but was %d with %s", http.StatusOK, w.Code, w.Header().Get(middleware.RateLimitLimitHeader))
+	}
+
+	if w := get(); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected %d after the reloaded limit was used but was %d", http.StatusTooManyRequests, w.Code)
+	}
+}
+
+func TestRateLimitShouldRejectExhaustedClients(t *testing.T) {
+	c := &config.Config{}
+
+	tenants, err := tenant.NewRegistry(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limiter := ratelimit.NewStoreLimiter(ratelimit.NewMemoryStore(),
+		ratelimit.Limit{Requests: 100, Period: time.Minute},
+		[]config.RouteLimit{{Route: "/ip", Limit: config.Limit{Requests: 2, Period: time.Minute}}},
+		ratelimit.Penalty{Threshold: 2, Window: time.Hour, Block: time.Minute, MaxBlock: time.Hour},
+		logger.NewTestLoggerFactory())
+
+	s := NewServer(logger.NewTestLoggerFactory(), c, &testAuthenticator{}, tenants, limiter, discovery.NewNoopRegistrar(), nil, nil,
+		&clientIpController{}, &notFoundController{}).(*server)
+	router, err := s.buildRouter(zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string, remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, apiPrefix+path, nil)
+		r.RemoteAddr = remoteAddr
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	for i, remaining := range []string{"1", "0"} {
+		w := get("/ip", "198.51.100.4:40000")
+		if w.Code != http.StatusOK || w.Header().Get(middleware.RateLimitRemainingHeader) != remaining {
+			t.Fatalf("request %d: expected %d with %s remaining but was %d with %s", i, http.StatusOK, remaining,
+				w.Code, w.Header().Get(middleware.RateLimitRemainingHeader))
+		}
+	}
+
+	w := get("/ip", "198.51.100.4:40000")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get(middleware.RetryAfterHeader) != "30" {
+		t.Errorf("expected %d with retry after 30 but was %d with %s", http.StatusTooManyRequests, w.Code, w.Header().Get(middleware.RetryAfterHeader))
+	}
+
+	if w = get("/ip", "198.51.100.5:40000"); w.Code != http.StatusOK {
+		t.Errorf("expected other clients to have their own bucket but was %d", w.Code)
+	}
+
+	// the third unknown link blocks the client from every route
+	for i := 0; i < 3; i++ {
+		if w = get("/pwd/unknown", "203.0.113.7:40000"); w.Code != http.StatusNotFound {
+			t.Fatalf("expected %d but was %d", http.StatusNotFound, w.Code)
+		}
+	}
+
+	w = get("/ip", "203.0.113.7:40000")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get(middleware.RetryAfterHeader) != "60" {
+		t.Errorf("expected blocked client to get %d with retry after 60 but was %d with %s", http.StatusTooManyRequests, w.Code, w.Header().Get(middleware.RetryAfterHeader))
+	}
+}
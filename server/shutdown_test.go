@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/misikdmitriy/password-sharing/auth"
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/openapi"
+	"github.com/misikdmitriy/password-sharing/tenant"
+)
+
+type slowController struct {
+	started  chan struct{}
+	release  chan struct{}
+	finished func()
+}
+
+func (ctrl *slowController) Hander() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		close(ctrl.started)
+		<-ctrl.release
+		c.String(http.StatusOK, "done")
+		ctrl.finished()
+	}
+}
+
+func (ctrl *slowController) Route() string {
+	return "/slow"
+}
+
+func (ctrl *slowController) Method() string {
+	return http.MethodGet
+}
+
+func (ctrl *slowController) Doc() openapi.Operation {
+	return openapi.Operation{}
+}
+
+func (ctrl *slowController) Auth() auth.Requirement {
+	return auth.Anonymous
+}
+
+type lifecycle struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (l *lifecycle) add(event string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.events = append(l.events, event)
+}
+
+func (l *lifecycle) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return strings.Join(l.events, ", ")
+}
+
+type lifecycleRegistrar struct {
+	events *lifecycle
+}
+
+func (r *lifecycleRegistrar) Register(context.Context) error {
+	r.events.add("registered")
+	return nil
+}
+
+func (r *lifecycleRegistrar) Deregister(context.Context) error {
+	r.events.add("deregistered")
+	return nil
+}
+
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestShutdownShouldFinishInFlightRequests(t *testing.T) {
+	c := &config.Config{}
+	c.App.Port = freePort(t)
+	c.App.DrainPeriod = 50 * time.Millisecond
+	c.App.ShutdownTimeout = 5 * time.Second
+
+	tenants, err := tenant.NewRegistry(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := &lifecycle{}
+	ctrl := &slowController{
+		started:  make(chan struct{}),
+		release:  make(chan struct{}),
+		finished: func() { events.add("request finished") },
+	}
+	s := NewServer(logger.NewTestLoggerFactory(), c, &testAuthenticator{}, tenants, nil, &lifecycleRegistrar{events: events}, nil, nil, ctrl).(*server)
+
+	s.OnDrain(func() { events.add("draining") })
+	s.OnStop("job", func(context.Context) error {
+		events.add("job stopped")
+		return nil
+	})
+
+	ctxt, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- s.run(ctxt)
+	}()
+
+	url := fmt.Sprintf("http://127.0.0.1:%d%s/slow", c.App.Port, apiPrefix)
+	response := make(chan string, 1)
+	go func() {
+		for attempt := 0; attempt < 50; attempt++ {
+			r, err := http.Get(url)
+			if err != nil {
+				// the server may not listen yet
+				time.Sleep(20 * time.Millisecond)
+				continue
+			}
+			defer r.Body.Close()
+
+			body, _ := io.ReadAll(r.Body)
+			response <- fmt.Sprintf("%d %s", r.StatusCode, body)
+			return
+		}
+
+		response <- "server did not start"
+	}()
+
+	select {
+	case <-ctrl.started:
+	case r := <-response:
+		t.Fatal(r)
+	}
+
+	cancel()
+	// shutdown waits for the request, release it once the drain is over
+	time.Sleep(2 * c.App.DrainPeriod)
+	close(ctrl.release)
+
+	if r := <-response; r != "200 done" {
+		t.Errorf("expected in-flight request to finish but was %s", r)
+	}
+
+	select {
+	case err = <-stopped:
+		if err != nil {
+			t.Errorf("expected clean shutdown but was %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+	}
+
+	expected := "registered, deregistered, draining, request finished, job stopped"
+	if events.String() != expected {
+		t.Errorf("expected lifecycle %s but was %s", expected, events.String())
+	}
+
+	if _, err = http.Get(url); err == nil {
+		t.Errorf("expected the server to be closed")
+	}
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/misikdmitriy/password-sharing/auth"
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/controller"
+	"github.com/misikdmitriy/password-sharing/discovery"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/openapi"
+	"github.com/misikdmitriy/password-sharing/tenant"
+	"github.com/misikdmitriy/password-sharing/tests"
+)
+
+type createController struct{}
+
+func (ctrl *createController) Hander() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.String(http.StatusCreated, "created")
+	}
+}
+
+func (ctrl *createController) Route() string {
+	return "/create"
+}
+
+func (ctrl *createController) Method() string {
+	return http.MethodPost
+}
+
+func (ctrl *createController) Doc() openapi.Operation {
+	return openapi.Operation{}
+}
+
+func (ctrl *createController) Auth() auth.Requirement {
+	return auth.Require(auth.ScopeCreate)
+}
+
+func TestMutualTlsShouldGuardCreationAndAdminRoutes(t *testing.T) {
+	dir := t.TempDir()
+
+	ca, err := tests.WriteCertificate(dir, "ca", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverCert, err := tests.WriteCertificate(dir, "server", ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientCert, err := tests.WriteCertificate(dir, "client", ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// clients only offer certificates of the CAs the server asks for
+	otherCa, err := tests.WriteCertificate(dir, "other-ca", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	strangerCert, err := tests.WriteCertificate(dir, "stranger", otherCa)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &config.Config{}
+	c.App.Port = freePort(t)
+	c.Auth.AnonymousCreate = true
+	c.Tls.Enabled = true
+	c.Tls.CertFile = serverCert.CertFile
+	c.Tls.KeyFile = serverCert.KeyFile
+	c.Tls.MinVersion = "1.3"
+	c.Tls.ClientCaFile = ca.CertFile
+
+	tenants, err := tenant.NewRegistry(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(logger.NewTestLoggerFactory(), c, &testAuthenticator{}, tenants, nil, discovery.NewNoopRegistrar(),
+		[]controller.Controller{controller.NewAdminStatsController(nil)}, nil,
+		&clientIpController{}, &createController{}).(*server)
+
+	ctxt, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- s.run(ctxt)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate)
+
+	clientOf := func(cert *tests.Certificate) *http.Client {
+		tlsConfig := &tls.Config{RootCAs: roots}
+		if cert != nil {
+			pair, err := tls.LoadX509KeyPair(cert.CertFile, cert.KeyFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	}
+
+	base := fmt.Sprintf("https://localhost:%d%s", c.App.Port, apiPrefix)
+
+	// wait until the server listens
+	for attempt := 0; ; attempt++ {
+		r, err := clientOf(nil).Get(base + "/ip")
+		if err == nil {
+			r.Body.Close()
+			break
+		}
+
+		if attempt == 50 {
+			t.Fatal(err)
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	cases := []struct {
+		name   string
+		cert   *tests.Certificate
+		method string
+		path   string
+		status int
+		code   int
+	}{
+		{"anonymous route without certificate", nil, http.MethodGet, "/ip", http.StatusOK, 0},
+		{"creation without certificate", nil, http.MethodPost, "/create", http.StatusUnauthorized, 40108},
+		{"creation with certificate of another CA", strangerCert, http.MethodPost, "/create", http.StatusUnauthorized, 40108},
+		{"creation with certificate", clientCert, http.MethodPost, "/create", http.StatusCreated, 0},
+		{"admin without certificate", nil, http.MethodGet, adminPrefix + "/secrets/stats", http.StatusUnauthorized, 40108},
+		// the certificate gets the request to the api key check
+		{"admin with certificate", clientCert, http.MethodGet, adminPrefix + "/secrets/stats", http.StatusUnauthorized, 40102},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			request, err := http.NewRequest(tc.method, base+tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := clientOf(tc.cert).Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Body.Close()
+
+			if r.StatusCode != tc.status {
+				t.Fatalf("expected status %d but was %d", tc.status, r.StatusCode)
+			}
+
+			if tc.code == 0 {
+				return
+			}
+
+			problem := model.ProblemResponse{}
+			if err = json.NewDecoder(r.Body).Decode(&problem); err != nil {
+				t.Fatal(err)
+			}
+
+			if problem.Code != tc.code {
+				t.Errorf("expected code %d but was %d", tc.code, problem.Code)
+			}
+		})
+	}
+}
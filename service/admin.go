@@ -0,0 +1,429 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/audit"
+	"github.com/misikdmitriy/password-sharing/database"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/tenant"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// AdminService backs the operator API. It works on the tenant of the caller
+// only and never returns secret contents, neither encrypted nor decrypted.
+type AdminService interface {
+	SecretStats(context.Context) ([]SecretStats, error)
+	DeleteSecret(context.Context, string) error
+	PurgeExpired(context.Context) (int64, error)
+	ApiKeys(context.Context) ([]model.ApiKey, error)
+	RevokeApiKey(context.Context, string) error
+	AuditEvents(context.Context, AuditQuery) ([]model.AuditEvent, error)
+}
+
+// SecretStats counts the active secrets of a tenant by age, the counts are
+// cumulative. Secrets created before ages were tracked only count to Total.
+type SecretStats struct {
+	TenantId string
+	Total    int64
+	LastHour int64
+	LastDay  int64
+	LastWeek int64
+}
+
+type AuditQuery struct {
+	// Before pages backwards, only events with a lower id are returned.
+	Before int64
+	Limit  int
+}
+
+const (
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 1000
+)
+
+const (
+	adminStats      = "admin_stats"
+	adminDelete     = "admin_delete"
+	adminPurge      = "admin_purge"
+	adminApiKeys    = "admin_api_keys"
+	adminRevokeKey  = "admin_revoke_key"
+	adminAuditQuery = "admin_audit"
+)
+
+const (
+	activeCondition  = "(expires_at IS NULL OR expires_at > ?) AND (max_views = 0 OR views < max_views)"
+	expiredCondition = "(expires_at IS NOT NULL AND expires_at <= ?) OR (max_views > 0 AND views >= max_views)"
+)
+
+type adminService struct {
+	dbFactory     database.DbFactory
+	loggerFactory logger.LoggerFactory
+	recorder      audit.Recorder
+	tenants       tenant.Registry
+}
+
+func NewAdminService(dbFactory database.DbFactory,
+	loggerFactory logger.LoggerFactory,
+	recorder audit.Recorder,
+	tenants tenant.Registry) AdminService {
+	return &adminService{
+		dbFactory:     dbFactory,
+		loggerFactory: loggerFactory,
+		recorder:      recorder,
+		tenants:       tenants,
+	}
+}
+
+func (s *adminService) SecretStats(c context.Context) ([]SecretStats, error) {
+	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
+	if err != nil {
+		return nil, err
+	}
+	defer loggerClose()
+
+	db, dbClose, err := s.dbFactory.InitDB(c)
+	if err != nil {
+		return nil, initDbError(appLogger)
+	}
+	defer dbClose()
+
+	now := time.Now().UTC()
+	result := []SecretStats{}
+	var query *gorm.DB
+	measureTime(func() {
+		query = forTenant(db.Model(&model.Password{}), tenantOf(c, s.tenants)).
+			Select("tenant_id, COUNT(*) AS total, "+
+				"SUM(CASE WHEN created_at >= ? THEN 1 ELSE 0 END) AS last_hour, "+
+				"SUM(CASE WHEN created_at >= ? THEN 1 ELSE 0 END) AS last_day, "+
+				"SUM(CASE WHEN created_at >= ? THEN 1 ELSE 0 END) AS last_week",
+				now.Add(-time.Hour), now.Add(-24*time.Hour), now.Add(-7*24*time.Hour)).
+			Where(activeCondition, now).
+			Group("tenant_id").
+			Order("tenant_id").
+			Scan(&result)
+	}, dbTime.WithLabelValues(adminStats))
+	dbCounter.WithLabelValues(adminStats).Inc()
+
+	if err := query.Error; err != nil {
+		return nil, dbQueryError(appLogger, err)
+	}
+
+	return result, nil
+}
+
+// DeleteSecret removes a secret whatever its state. Operators identify it by
+// the hash of its link, so they never need the link itself.
+func (s *adminService) DeleteSecret(c context.Context, linkHash string) error {
+	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
+	if err != nil {
+		return err
+	}
+	defer loggerClose()
+
+	db, dbClose, err := s.dbFactory.InitDB(c)
+	if err != nil {
+		return initDbError(appLogger)
+	}
+	defer dbClose()
+
+	password := &model.Password{}
+	var query *gorm.DB
+	measureTime(func() {
+		query = forTenant(db, tenantOf(c, s.tenants)).Select("id", "tenant_id").Where(&model.Password{LinkHash: linkHash}).First(password)
+	}, dbTime.WithLabelValues(adminDelete))
+	dbCounter.WithLabelValues(adminDelete).Inc()
+
+	if err := query.Error; err != nil {
+		if err.Error() == recordNotFoundError {
+			const message = "no secret with this link hash"
+
+			dbErrorsCounter.WithLabelValues(notFound).Inc()
+			appLogger.Warn(message,
+				zap.String("linkHash", linkHash),
+			)
+
+			return &pserror.PasswordSharingError{
+				Code:    pserror.LinkHashNotFound,
+				Message: message,
+			}
+		}
+
+		return dbQueryError(appLogger, err)
+	}
+
+	measureTime(func() {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("password_id = ?", password.Id).Delete(&model.Verification{}).Error; err != nil {
+				return err
+			}
+
+			return tx.Delete(&model.Password{}, password.Id).Error
+		})
+	}, dbTime.WithLabelValues(adminDelete))
+	dbCounter.WithLabelValues(adminDelete).Inc()
+
+	if err != nil {
+		return dbCommandError(appLogger, err)
+	}
+
+	appLogger.Info("secret deleted by operator",
+		zap.String("linkHash", linkHash),
+		zap.String("tenant", password.TenantId),
+		zap.String("actor", audit.ActorOf(c)),
+	)
+
+	s.record(c, audit.Event{
+		TenantId: password.TenantId,
+		Action:   audit.ActionDeleteSecret,
+		Target:   linkHash,
+		Outcome:  audit.OutcomeSuccess,
+	})
+
+	return nil
+}
+
+// PurgeExpired deletes the expired and used up secrets of the tenant and
+// returns how many were deleted.
+func (s *adminService) PurgeExpired(c context.Context) (int64, error) {
+	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
+	if err != nil {
+		return 0, err
+	}
+	defer loggerClose()
+
+	db, dbClose, err := s.dbFactory.InitDB(c)
+	if err != nil {
+		return 0, initDbError(appLogger)
+	}
+	defer dbClose()
+
+	t := tenantOf(c, s.tenants)
+	now := time.Now().UTC()
+	expired := []model.Password{}
+	var purged int64
+	measureTime(func() {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := forTenant(tx, t).Select("id", "link_hash", "tenant_id", "expires_at").Where(expiredCondition, now).Find(&expired).Error
+			if err != nil || len(expired) == 0 {
+				return err
+			}
+
+			ids := make([]int64, len(expired))
+			for i, p := range expired {
+				ids[i] = p.Id
+			}
+
+			if err := tx.Where("password_id IN ?", ids).Delete(&model.Verification{}).Error; err != nil {
+				return err
+			}
+
+			command := tx.Where("id IN ?", ids).Delete(&model.Password{})
+			purged = command.RowsAffected
+
+			return command.Error
+		})
+	}, dbTime.WithLabelValues(adminPurge))
+	dbCounter.WithLabelValues(adminPurge).Inc()
+
+	if err != nil {
+		return 0, dbCommandError(appLogger, err)
+	}
+
+	// used up secrets were recorded as expired on their last view
+	for _, p := range expired {
+		if p.Expired(now) {
+			s.record(c, audit.Event{
+				TenantId: p.TenantId,
+				Action:   audit.ActionExpireSecret,
+				Target:   p.LinkHash,
+				Outcome:  audit.OutcomeTtl,
+			})
+		}
+	}
+
+	appLogger.Info("expired secrets purged",
+		zap.Int64("count", purged),
+		zap.String("tenant", t.Id),
+		zap.String("actor", audit.ActorOf(c)),
+	)
+
+	s.record(c, audit.Event{
+		TenantId: t.Id,
+		Action:   audit.ActionPurgeExpired,
+		Target:   strconv.FormatInt(purged, 10),
+		Outcome:  audit.OutcomeSuccess,
+	})
+
+	return purged, nil
+}
+
+// ApiKeys lists the API keys of the tenant without their hash.
+func (s *adminService) ApiKeys(c context.Context) ([]model.ApiKey, error) {
+	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
+	if err != nil {
+		return nil, err
+	}
+	defer loggerClose()
+
+	db, dbClose, err := s.dbFactory.InitDB(c)
+	if err != nil {
+		return nil, initDbError(appLogger)
+	}
+	defer dbClose()
+
+	result := []model.ApiKey{}
+	var query *gorm.DB
+	measureTime(func() {
+		query = forTenant(db, tenantOf(c, s.tenants)).Omit("hash").Order("id").Find(&result)
+	}, dbTime.WithLabelValues(adminApiKeys))
+	dbCounter.WithLabelValues(adminApiKeys).Inc()
+
+	if err := query.Error; err != nil {
+		return nil, dbQueryError(appLogger, err)
+	}
+
+	return result, nil
+}
+
+func (s *adminService) RevokeApiKey(c context.Context, keyId string) error {
+	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
+	if err != nil {
+		return err
+	}
+	defer loggerClose()
+
+	db, dbClose, err := s.dbFactory.InitDB(c)
+	if err != nil {
+		return initDbError(appLogger)
+	}
+	defer dbClose()
+
+	key := &model.ApiKey{}
+	var query *gorm.DB
+	measureTime(func() {
+		query = forTenant(db, tenantOf(c, s.tenants)).Omit("hash").Where(&model.ApiKey{KeyId: keyId}).First(key)
+	}, dbTime.WithLabelValues(adminRevokeKey))
+	dbCounter.WithLabelValues(adminRevokeKey).Inc()
+
+	if err := query.Error; err != nil {
+		if err.Error() == recordNotFoundError {
+			const message = "api key not found"
+
+			dbErrorsCounter.WithLabelValues(notFound).Inc()
+			appLogger.Warn(message,
+				zap.String("keyId", keyId),
+			)
+
+			return &pserror.PasswordSharingError{
+				Code:    pserror.ApiKeyNotFound,
+				Message: message,
+			}
+		}
+
+		return dbQueryError(appLogger, err)
+	}
+
+	// the condition keeps the first revocation time when revoked twice
+	// concurrently
+	var command *gorm.DB
+	measureTime(func() {
+		command = db.Model(&model.ApiKey{}).
+			Where("id = ? AND revoked_at IS NULL", key.Id).
+			Update("revoked_at", time.Now().UTC())
+	}, dbTime.WithLabelValues(adminRevokeKey))
+	dbCounter.WithLabelValues(adminRevokeKey).Inc()
+
+	if err := command.Error; err != nil {
+		return dbCommandError(appLogger, err)
+	}
+
+	if command.RowsAffected == 0 {
+		const message = "api key already revoked"
+
+		appLogger.Warn(message,
+			zap.String("keyId", keyId),
+		)
+
+		return &pserror.PasswordSharingError{
+			Code:    pserror.ApiKeyRevoked,
+			Message: message,
+		}
+	}
+
+	appLogger.Info("api key revoked",
+		zap.String("keyId", keyId),
+		zap.String("actor", audit.ActorOf(c)),
+	)
+
+	s.record(c, audit.Event{
+		TenantId: key.TenantId,
+		Action:   audit.ActionRevokeApiKey,
+		Target:   keyId,
+		Outcome:  audit.OutcomeSuccess,
+	})
+
+	return nil
+}
+
+// AuditEvents returns the newest events of the tenant first.
+func (s *adminService) AuditEvents(c context.Context, q AuditQuery) ([]model.AuditEvent, error) {
+	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
+	if err != nil {
+		return nil, err
+	}
+	defer loggerClose()
+
+	if q.Limit < 0 || q.Limit > MaxAuditLimit || q.Before < 0 {
+		const message = "invalid audit query"
+
+		appLogger.Warn(message,
+			zap.Int("limit", q.Limit),
+			zap.Int64("before", q.Before),
+		)
+
+		return nil, &pserror.PasswordSharingError{
+			Code:    pserror.InvalidAdminQuery,
+			Message: message,
+		}
+	}
+
+	if q.Limit == 0 {
+		q.Limit = DefaultAuditLimit
+	}
+
+	db, dbClose, err := s.dbFactory.InitDB(c)
+	if err != nil {
+		return nil, initDbError(appLogger)
+	}
+	defer dbClose()
+
+	result := []model.AuditEvent{}
+	var query *gorm.DB
+	measureTime(func() {
+		query = forTenant(db.Model(&model.AuditEvent{}), tenantOf(c, s.tenants))
+		if q.Before > 0 {
+			query = query.Where("id < ?", q.Before)
+		}
+
+		query = query.Order("id DESC").Limit(q.Limit).Find(&result)
+	}, dbTime.WithLabelValues(adminAuditQuery))
+	dbCounter.WithLabelValues(adminAuditQuery).Inc()
+
+	if err := query.Error; err != nil {
+		return nil, dbQueryError(appLogger, err)
+	}
+
+	return result, nil
+}
+
+// record ignores failures, the recorder logs them and the action already
+// happened.
+func (s *adminService) record(c context.Context, event audit.Event) {
+	_ = s.recorder.Record(c, event)
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/audit"
+	"github.com/misikdmitriy/password-sharing/auth"
+	"github.com/misikdmitriy/password-sharing/config"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/helper"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/tenant"
+)
+
+func TestAdminShouldManageSecrets(t *testing.T) {
+	c := &config.Config{}
+	c.Tenancy.Tenants = []config.Tenant{{Id: "finance"}, {Id: "engineering"}}
+
+	s, tenants, dbf := newTenantTestService(t, c, nil)
+	loggerFactory := logger.NewTestLoggerFactory()
+	admin := NewAdminService(dbf, loggerFactory, audit.NewSinkRecorder(loggerFactory, audit.NewDbSink(dbf)), tenants)
+
+	finance, _ := tenants.Get("finance")
+	engineering, _ := tenants.Get("engineering")
+	financeCtxt := tenant.WithTenant(context.Background(), finance)
+	engineeringCtxt := tenant.WithTenant(context.Background(), engineering)
+
+	links := []string{}
+	for _, ctxt := range []context.Context{financeCtxt, financeCtxt, financeCtxt, engineeringCtxt} {
+		created, err := s.CreateLinkFromPassword(ctxt, "secret", LinkOptions{MaxViews: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		links = append(links, created.Link)
+	}
+
+	db, dbClose, err := dbf.InitDB(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbClose()
+
+	// one finance secret is old, one was used up
+	old := time.Now().UTC().Add(-48 * time.Hour)
+	if err = db.Model(&model.Password{}).Where("link = ?", links[1]).Update("created_at", old).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.GetPasswordFromLink(financeCtxt, links[2], RevealOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	linkHasher := helper.NewLinkHasher(c.Encrypt.Secret)
+	operator := &auth.Principal{Subject: "operator", Scopes: []auth.Scope{auth.ScopeAdmin}}
+	financeAdmin := auth.WithPrincipal(financeCtxt, operator)
+	engineeringAdmin := auth.WithPrincipal(engineeringCtxt, operator)
+
+	stats, err := admin.SecretStats(financeAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := SecretStats{TenantId: "finance", Total: 2, LastHour: 1, LastDay: 1, LastWeek: 2}
+	if len(stats) != 1 || stats[0] != expected {
+		t.Fatalf("expected stats %+v but was %+v", expected, stats)
+	}
+
+	err = admin.DeleteSecret(engineeringAdmin, linkHasher.Hash("unknown"))
+	if !errors.Is(err, pserror.LinkHashNotFound) {
+		t.Errorf("expected link hash not found but was %v", err)
+	}
+
+	// the secret of another tenant is not found
+	if err = admin.DeleteSecret(financeAdmin, linkHasher.Hash(links[3])); !errors.Is(err, pserror.LinkHashNotFound) {
+		t.Errorf("expected link hash of another tenant not to be found but was %v", err)
+	}
+
+	if err = admin.DeleteSecret(engineeringAdmin, linkHasher.Hash(links[3])); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.GetPasswordFromLink(engineeringCtxt, links[3], RevealOptions{}); !errors.Is(err, pserror.PasswordNotFound) {
+		t.Errorf("expected deleted secret not to be found but was %v", err)
+	}
+
+	if purged, err := admin.PurgeExpired(engineeringAdmin); err != nil || purged != 0 {
+		t.Errorf("expected nothing to purge for engineering but was %d, %v", purged, err)
+	}
+
+	purged, err := admin.PurgeExpired(financeAdmin)
+	if err != nil || purged != 1 {
+		t.Errorf("expected 1 purged secret but was %d, %v", purged, err)
+	}
+
+	var remaining int64
+	if err = db.Model(&model.Password{}).Count(&remaining).Error; err != nil || remaining != 2 {
+		t.Errorf("expected 2 remaining secrets but was %d", remaining)
+	}
+
+	events, err := admin.AuditEvents(engineeringAdmin, AuditQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) < 2 || events[0].Action != audit.ActionPurgeExpired || events[1].Action != audit.ActionDeleteSecret {
+		t.Fatalf("unexpected audit events %+v", events)
+	}
+
+	for _, e := range events {
+		if e.TenantId != "engineering" {
+			t.Errorf("expected only events of engineering but was %+v", e)
+		}
+	}
+
+	if events[1].Target != linkHasher.Hash(links[3]) || events[1].Actor != "operator" {
+		t.Errorf("unexpected delete event %+v", events[1])
+	}
+
+	if events, err = admin.AuditEvents(engineeringAdmin, AuditQuery{Before: events[0].Id, Limit: 1}); err != nil || len(events) != 1 || events[0].Action != audit.ActionDeleteSecret {
+		t.Errorf("expected the delete event before the purge but was %+v, %v", events, err)
+	}
+
+	if _, err = admin.AuditEvents(financeAdmin, AuditQuery{Limit: MaxAuditLimit + 1}); !errors.Is(err, pserror.InvalidAdminQuery) {
+		t.Errorf("expected invalid admin query but was %v", err)
+	}
+}
+
+func TestAdminShouldRevokeApiKeys(t *testing.T) {
+	c := &config.Config{}
+	c.Tenancy.Tenants = []config.Tenant{{Id: "finance"}, {Id: "engineering"}}
+
+	_, tenants, dbf := newTenantTestService(t, c, nil)
+	loggerFactory := logger.NewTestLoggerFactory()
+	admin := NewAdminService(dbf, loggerFactory, audit.NewSinkRecorder(loggerFactory, audit.NewDbSink(dbf)), tenants)
+	apiKeys := NewApiKeyService(dbf, helper.NewRandomFactory(), loggerFactory)
+
+	finance, _ := tenants.Get("finance")
+	engineering, _ := tenants.Get("engineering")
+	ctxt := tenant.WithTenant(context.Background(), finance)
+	engineeringCtxt := tenant.WithTenant(context.Background(), engineering)
+
+	key, secret, err := apiKeys.CreateApiKey(ctxt, "ci", finance.Id, []auth.Scope{auth.ScopeCreate}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listed, err := admin.ApiKeys(ctxt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(listed) != 1 || listed[0].KeyId != key.KeyId || listed[0].Hash != "" {
+		t.Errorf("expected the key to be listed without hash but was %+v", listed)
+	}
+
+	if listed, err = admin.ApiKeys(engineeringCtxt); err != nil || len(listed) != 0 {
+		t.Errorf("expected no keys of another tenant but was %+v, %v", listed, err)
+	}
+
+	if err = admin.RevokeApiKey(engineeringCtxt, key.KeyId); !errors.Is(err, pserror.ApiKeyNotFound) {
+		t.Errorf("expected the key of another tenant not to be found but was %v", err)
+	}
+
+	if err = admin.RevokeApiKey(ctxt, "unknown"); !errors.Is(err, pserror.ApiKeyNotFound) {
+		t.Errorf("expected api key not found but was %v", err)
+	}
+
+	if err = admin.RevokeApiKey(ctxt, key.KeyId); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = admin.RevokeApiKey(ctxt, key.KeyId); !errors.Is(err, pserror.ApiKeyRevoked) {
+		t.Errorf("expected api key revoked but was %v", err)
+	}
+
+	if _, err = apiKeys.Authenticate(ctxt, secret); !errors.Is(err, pserror.InvalidCredentials) {
+		t.Errorf("expected revoked key to be rejected but was %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"fmt"
+
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/helper"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const MaxAllowedCidrs = 50
+
+const (
+	denyPassword = "deny_password"
+
+	deniedBySecret = "secret"
+	deniedByTenant = "tenant"
+)
+
+var deniedRevealsCounter *prometheus.CounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "password_sharing_denied_reveals",
+	Help: "The total number of reveals refused because of the client address by the allowlist that refused them",
+}, []string{"allowlist"})
+
+// normalizeAllowlist validates the networks a password may be revealed from
+// and returns them in canonical form.
+func normalizeAllowlist(appLogger *zap.Logger, cidrs []string) ([]string, error) {
+	if len(cidrs) > MaxAllowedCidrs {
+		return nil, invalidAllowlistError(appLogger, fmt.Sprintf("at most %d networks are allowed", MaxAllowedCidrs))
+	}
+
+	networks, err := helper.ParseCidrs(cidrs)
+	if err != nil {
+		return nil, invalidAllowlistError(appLogger, err.Error())
+	}
+
+	result := make([]string, 0, len(networks))
+	seen := map[string]bool{}
+	for _, n := range networks {
+		cidr := n.String()
+		if !seen[cidr] {
+			seen[cidr] = true
+			result = append(result, cidr)
+		}
+	}
+
+	return result, nil
+}
+
+// checkAddress enforces the allowlists of the tenant and of the password,
+// the client address has to be in both. Refusals are counted on the password
+// and do not consume a view.
+func (s *passwordService) checkAddress(db *gorm.DB, appLogger *zap.Logger, t *tenant.Tenant, password *model.Password, clientIp string) error {
+	allowlist := ""
+	if len(t.Policy.AllowedNetworks) > 0 && !helper.IpAllowed(clientIp, t.Policy.AllowedNetworks) {
+		allowlist = deniedByTenant
+	} else if cidrs := password.AllowedCidrList(); len(cidrs) > 0 {
+		// stored networks were validated on creation, an unparsable list
+		// denies everyone
+		networks, err := helper.ParseCidrs(cidrs)
+		if err != nil || !helper.IpAllowed(clientIp, networks) {
+			allowlist = deniedBySecret
+		}
+	}
+
+	if allowlist == "" {
+		return nil
+	}
+
+	var command *gorm.DB
+	measureTime(func() {
+		command = db.Model(&model.Password{}).
+			Where("id = ?", password.Id).
+			Update("denied_views", gorm.Expr("denied_views + 1"))
+	}, dbTime.WithLabelValues(denyPassword))
+	dbCounter.WithLabelValues(denyPassword).Inc()
+
+	if err := command.Error; err != nil {
+		return dbCommandError(appLogger, err)
+	}
+
+	const message = "client address is not allowed"
+
+	deniedRevealsCounter.WithLabelValues(allowlist).Inc()
+	appLogger.Warn(message,
+		zap.String("link", password.Link),
+		zap.String("tenant", t.Id),
+		zap.String("clientIp", clientIp),
+		zap.String("allowlist", allowlist),
+	)
+
+	return &pserror.PasswordSharingError{
+		Code:    pserror.AddressNotAllowed,
+		Message: message,
+	}
+}
+
+func invalidAllowlistError(log *zap.Logger, message string) error {
+	log.Warn(message)
+
+	return &pserror.PasswordSharingError{
+		Code:    pserror.InvalidAllowlist,
+		Message: message,
+	}
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/auth"
+	"github.com/misikdmitriy/password-sharing/database"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/helper"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type ApiKeyService interface {
+	auth.Authenticator
+	CreateApiKey(context.Context, string, string, []auth.Scope, time.Duration) (*model.ApiKey, string, error)
+}
+
+type apiKeyService struct {
+	dbFactory     database.DbFactory
+	randomFactory helper.RandomGeneratorFactory
+	loggerFactory logger.LoggerFactory
+}
+
+func NewApiKeyService(dbFactory database.DbFactory,
+	rf helper.RandomGeneratorFactory,
+	loggerFactory logger.LoggerFactory) ApiKeyService {
+	return &apiKeyService{
+		dbFactory:     dbFactory,
+		randomFactory: rf,
+		loggerFactory: loggerFactory,
+	}
+}
+
+// keys look like ps_<key id>_<secret>, the key id is stored in plain text to
+// find the key, the secret only as a hash
+const (
+	ApiKeyPrefix       = "ps_"
+	apiKeyIdLength     = 12
+	apiKeySecretLength = 40
+	lastUsedPrecision  = time.Minute
+)
+
+const (
+	newApiKey = "new_api_key"
+	getApiKey = "get_api_key"
+	useApiKey = "use_api_key"
+)
+
+// CreateApiKey issues a key acting on behalf of tenantId.
+func (s *apiKeyService) CreateApiKey(c context.Context, name string, tenantId string, scopes []auth.Scope, ttl time.Duration) (*model.ApiKey, string, error) {
+	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
+	if err != nil {
+		return nil, "", err
+	}
+	defer loggerClose()
+
+	db, dbClose, err := s.dbFactory.InitDB(c)
+	if err != nil {
+		return nil, "", initDbError(appLogger)
+	}
+	defer dbClose()
+
+	rg := s.randomFactory.NewRandomGenerator()
+	keyId, err := rg.RandomString(apiKeyIdLength)
+	if err != nil {
+		return nil, "", randomizerError(appLogger, err, apiKeyIdLength)
+	}
+
+	secret, err := rg.RandomString(apiKeySecretLength)
+	if err != nil {
+		return nil, "", randomizerError(appLogger, err, apiKeySecretLength)
+	}
+
+	now := time.Now().UTC()
+	key := &model.ApiKey{
+		KeyId:     keyId,
+		Name:      name,
+		TenantId:  tenantId,
+		Hash:      helper.Hash(secret),
+		Scopes:    auth.JoinScopes(scopes),
+		CreatedAt: now,
+	}
+
+	if ttl > 0 {
+		expiresAt := now.Add(ttl)
+		key.ExpiresAt = &expiresAt
+	}
+
+	var command *gorm.DB
+	measureTime(func() {
+		command = db.Create(key)
+	}, dbTime.WithLabelValues(newApiKey))
+	dbCounter.WithLabelValues(newApiKey).Inc()
+
+	if err := command.Error; err != nil {
+		return nil, "", dbCommandError(appLogger, err)
+	}
+
+	appLogger.Info("api key created",
+		zap.String("keyId", keyId),
+		zap.String("name", name),
+		zap.String("tenant", tenantId),
+		zap.String("scopes", key.Scopes),
+	)
+
+	return key, fmt.Sprintf("%s%s_%s", ApiKeyPrefix, keyId, secret), nil
+}
+
+func (s *apiKeyService) Authenticate(c context.Context, credential string) (*auth.Principal, error) {
+	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
+	if err != nil {
+		return nil, err
+	}
+	defer loggerClose()
+
+	keyId, secret, ok := strings.Cut(strings.TrimPrefix(credential, ApiKeyPrefix), "_")
+	if !ok || !strings.HasPrefix(credential, ApiKeyPrefix) {
+		return nil, invalidCredentialsError(appLogger, "malformed api key")
+	}
+
+	db, dbClose, err := s.dbFactory.InitDB(c)
+	if err != nil {
+		return nil, initDbError(appLogger)
+	}
+	defer dbClose()
+
+	key := &model.ApiKey{}
+	var query *gorm.DB
+	measureTime(func() {
+		query = db.Where(&model.ApiKey{KeyId: keyId}).First(key)
+	}, dbTime.WithLabelValues(getApiKey))
+	dbCounter.WithLabelValues(getApiKey).Inc()
+
+	if err := query.Error; err != nil {
+		if err.Error() == recordNotFoundError {
+			dbErrorsCounter.WithLabelValues(notFound).Inc()
+			return nil, invalidCredentialsError(appLogger, "unknown api key")
+		}
+
+		const message = "error on db query"
+
+		dbErrorsCounter.WithLabelValues(unknownError).Inc()
+		appLogger.Error(message,
+			zap.Error(err),
+		)
+
+		return nil, &pserror.PasswordSharingError{
+			Code:    pserror.DbQueryError,
+			Message: message,
+			Cause:   err,
+		}
+	}
+
+	now := time.Now().UTC()
+	if !helper.HashEquals(secret, key.Hash) || !key.Active(now) {
+		return nil, invalidCredentialsError(appLogger, "api key is invalid, expired or revoked")
+	}
+
+	// last usage is tracked with minute precision to avoid a write per request
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedPrecision {
+		var command *gorm.DB
+		measureTime(func() {
+			command = db.Model(key).Update("last_used_at", now)
+		}, dbTime.WithLabelValues(useApiKey))
+		dbCounter.WithLabelValues(useApiKey).Inc()
+
+		if err := command.Error; err != nil {
+			dbErrorsCounter.WithLabelValues(unknownError).Inc()
+			appLogger.Warn("cannot update api key usage",
+				zap.Error(err),
+			)
+		}
+	}
+
+	scopes, _ := auth.ParseScopes(key.Scopes)
+	return &auth.Principal{
+		Subject: "apikey:" + key.KeyId,
+		Method:  auth.MethodApiKey,
+		KeyId:   key.KeyId,
+		Tenant:  key.TenantId,
+		Scopes:  scopes,
+	}, nil
+}
+
+func invalidCredentialsError(log *zap.Logger, reason string) error {
+	const message = "invalid credentials"
+
+	log.Warn(message,
+		zap.String("reason", reason),
+	)
+
+	return &pserror.PasswordSharingError{
+		Code:    pserror.InvalidCredentials,
+		Message: message,
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/auth"
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/database"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/helper"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/tenant"
+	"github.com/misikdmitriy/password-sharing/tests"
+)
+
+func TestApiKeyShouldAuthenticateUntilRevoked(t *testing.T) {
+	c := &config.Config{}
+	c.Database.ConnectionString = "inmemdb"
+	c.Database.Provider = "sqlite"
+
+	ctxt := context.Background()
+
+	loggerFactory := logger.NewTestLoggerFactory()
+	dbf := database.NewFactory(c, loggerFactory)
+	err := tests.MigrateDatabase(ctxt, dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewApiKeyService(dbf, helper.NewRandomFactory(), loggerFactory)
+
+	key, secret, err := s.CreateApiKey(ctxt, "ci", tenant.DefaultId, []auth.Scope{auth.ScopeCreate, auth.ScopeStatus}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	principal, err := s.Authenticate(ctxt, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if principal.KeyId != key.KeyId || !principal.Satisfies(auth.Require(auth.ScopeCreate, auth.ScopeStatus)) {
+		t.Errorf("unexpected principal %+v", principal)
+	}
+
+	if principal.HasScope(auth.ScopeAdmin) {
+		t.Errorf("expected principal not to have admin scope")
+	}
+
+	db, dbClose, err := dbf.InitDB(ctxt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbClose()
+
+	stored := &model.ApiKey{}
+	if err = db.Where(&model.ApiKey{KeyId: key.KeyId}).First(stored).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.LastUsedAt == nil || stored.Hash == secret {
+		t.Errorf("expected last usage to be tracked and secret to be hashed")
+	}
+
+	if err = db.Model(stored).Update("revoked_at", time.Now()).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, credential := range []string{secret, secret + "x", "ps_" + key.KeyId} {
+		_, err = s.Authenticate(ctxt, credential)
+		if code := pserror.AsPasswordSharingError(err).Code; code != pserror.InvalidCredentials {
+			t.Errorf("expected code %d but was %d", pserror.InvalidCredentials, code)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/helper"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"go.uber.org/zap"
+)
+
+type GeneratorService interface {
+	Generate(context.Context, helper.GeneratorPolicy, int) ([]*helper.GeneratedPassword, error)
+}
+
+type generatorService struct {
+	generator     helper.PasswordGenerator
+	loggerFactory logger.LoggerFactory
+}
+
+func NewGeneratorService(generator helper.PasswordGenerator, loggerFactory logger.LoggerFactory) GeneratorService {
+	return &generatorService{
+		generator:     generator,
+		loggerFactory: loggerFactory,
+	}
+}
+
+const MaxGeneratedPasswords = 20
+
+// MaxSharedPasswords caps the links one request may create, anonymous
+// clients pay a challenge for a single link.
+const MaxSharedPasswords = 5
+
+func (s *generatorService) Generate(c context.Context, policy helper.GeneratorPolicy, count int) ([]*helper.GeneratedPassword, error) {
+	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
+	if err != nil {
+		return nil, err
+	}
+	defer loggerClose()
+
+	if count == 0 {
+		count = 1
+	}
+
+	if count < 0 || count > MaxGeneratedPasswords {
+		const message = "invalid number of passwords requested"
+
+		appLogger.Warn(message,
+			zap.Int("count", count),
+		)
+
+		return nil, &pserror.PasswordSharingError{
+			Code:    pserror.InvalidGeneratorPolicy,
+			Message: message,
+		}
+	}
+
+	result := make([]*helper.GeneratedPassword, count)
+	for i := range result {
+		generated, err := s.generator.Generate(policy)
+		if err != nil {
+			if errors.Is(err, helper.ErrInvalidPolicy) {
+				appLogger.Warn("invalid generator policy",
+					zap.Error(err),
+				)
+
+				return nil, &pserror.PasswordSharingError{
+					Code:    pserror.InvalidGeneratorPolicy,
+					Message: err.Error(),
+					Cause:   err,
+				}
+			}
+
+			return nil, randomizerError(appLogger, err, policy.Length)
+		}
+
+		result[i] = generated
+	}
+
+	appLogger.Debug("passwords generated",
+		zap.String("mode", string(policy.Mode)),
+		zap.Int("count", count),
+	)
+
+	return result, nil
+}
@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/auth"
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/database"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/helper"
+	"github.com/misikdmitriy/password-sharing/keys"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/tenant"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// IdempotencyService lets clients retry a request without repeating its
+// effect. Keys are scoped to the tenant and the caller.
+type IdempotencyService interface {
+	// Begin claims key for a request. It returns the response of an earlier
+	// request with the same key and body, or nil when the caller has to
+	// handle the request and then Complete or Release the key.
+	Begin(c context.Context, key string, request []byte) (*IdempotentResponse, error)
+	// Complete stores the response of a claimed key.
+	Complete(c context.Context, key string, response IdempotentResponse) error
+	// Release gives up a claimed key after a failed request, so it can be
+	// retried.
+	Release(c context.Context, key string) error
+}
+
+type IdempotentResponse struct {
+	Status int
+	Body   []byte
+}
+
+type idempotencyService struct {
+	dbFactory     database.DbFactory
+	configuration *config.Config
+	loggerFactory logger.LoggerFactory
+	keys          keys.Provider
+	tenants       tenant.Registry
+	// bodies hold passwords, so only a keyed hash of them is stored
+	requestHasher helper.Hasher
+}
+
+const requestHashInfo = "password-sharing idempotency request"
+
+func NewIdempotencyService(dbFactory database.DbFactory,
+	configuration *config.Config,
+	loggerFactory logger.LoggerFactory,
+	keys keys.Provider,
+	tenants tenant.Registry) IdempotencyService {
+	return &idempotencyService{
+		dbFactory:     dbFactory,
+		configuration: configuration,
+		loggerFactory: loggerFactory,
+		keys:          keys,
+		tenants:       tenants,
+		requestHasher: helper.NewKeyedHasher(configuration.Encrypt.Secret, requestHashInfo),
+	}
+}
+
+const (
+	MaxIdempotencyKeyLength = 255
+	defaultIdempotencyTtl   = 24 * time.Hour
+	// a claim older than this belongs to a request that never finished
+	idempotencyClaimTimeout = time.Minute
+	maxClaimAttempts        = 3
+)
+
+const (
+	claimIdempotencyKey    = "claim_idempotency_key"
+	completeIdempotencyKey = "complete_idempotency_key"
+	releaseIdempotencyKey  = "release_idempotency_key"
+)
+
+func (s *idempotencyService) Begin(c context.Context, key string, request []byte) (*IdempotentResponse, error) {
+	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
+	if err != nil {
+		return nil, err
+	}
+	defer loggerClose()
+
+	if key == "" || len(key) > MaxIdempotencyKeyLength {
+		const message = "idempotency key must have 1 to 255 characters"
+
+		appLogger.Warn(message)
+
+		return nil, &pserror.PasswordSharingError{
+			Code:    pserror.InvalidIdempotencyKey,
+			Message: message,
+		}
+	}
+
+	db, dbClose, err := s.dbFactory.InitDB(c)
+	if err != nil {
+		return nil, initDbError(appLogger)
+	}
+	defer dbClose()
+
+	// responses are only kept for the window
+	if err = db.Where("expires_at <= ?", time.Now().UTC()).Delete(&model.IdempotencyKey{}).Error; err != nil {
+		return nil, dbCommandError(appLogger, err)
+	}
+
+	t := tenantOf(c, s.tenants)
+	keyHash := s.keyHash(c, t, key)
+	requestHash := s.requestHasher.Hash(string(request))
+
+	for attempt := 0; attempt < maxClaimAttempts; attempt++ {
+		now := time.Now().UTC()
+
+		var command *gorm.DB
+		measureTime(func() {
+			command = db.Create(&model.IdempotencyKey{
+				KeyHash:     keyHash,
+				TenantId:    t.Id,
+				RequestHash: requestHash,
+				CreatedAt:   now,
+				ExpiresAt:   now.Add(s.ttl()),
+			})
+		}, dbTime.WithLabelValues(claimIdempotencyKey))
+		dbCounter.WithLabelValues(claimIdempotencyKey).Inc()
+
+		if command.Error == nil {
+			return nil, nil
+		}
+
+		if !database.IsUniqueViolation(command.Error) {
+			return nil, dbCommandError(appLogger, command.Error)
+		}
+
+		existing := &model.IdempotencyKey{}
+		if err = db.Where("key_hash = ?", keyHash).Take(existing).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// released in between
+				continue
+			}
+
+			return nil, dbQueryError(appLogger, err)
+		}
+
+		abandoned := existing.Status == 0 && existing.CreatedAt.Before(now.Add(-idempotencyClaimTimeout))
+		if !existing.ExpiresAt.After(now) || abandoned {
+			if err = db.Where("id = ?", existing.Id).Delete(&model.IdempotencyKey{}).Error; err != nil {
+				return nil, dbCommandError(appLogger, err)
+			}
+
+			continue
+		}
+
+		if existing.RequestHash != requestHash {
+			const message = "idempotency key was used for a different request"
+
+			appLogger.Warn(message,
+				zap.String("tenant", t.Id),
+			)
+
+			return nil, &pserror.PasswordSharingError{
+				Code:    pserror.IdempotencyKeyReused,
+				Message: message,
+			}
+		}
+
+		if existing.Status == 0 {
+			return nil, &pserror.PasswordSharingError{
+				Code:    pserror.IdempotencyKeyInProgress,
+				Message: "a request with this idempotency key is in progress",
+			}
+		}
+
+		return s.decode(appLogger, t, existing)
+	}
+
+	return nil, &pserror.PasswordSharingError{
+		Code:    pserror.IdempotencyKeyInProgress,
+		Message: "idempotency key is used concurrently",
+	}
+}
+
+func (s *idempotencyService) Complete(c context.Context, key string, response IdempotentResponse) error {
+	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
+	if err != nil {
+		return err
+	}
+	defer loggerClose()
+
+	db, dbClose, err := s.dbFactory.InitDB(c)
+	if err != nil {
+		return initDbError(appLogger)
+	}
+	defer dbClose()
+
+	t := tenantOf(c, s.tenants)
+
+	// the response contains the link, so it is stored like a secret
+	encoder, keyId, err := s.keys.Active(t.Id)
+	if err != nil {
+		return keyProviderError(appLogger, err, t.Id)
+	}
+
+	encoded, err := encoder.Encode(string(response.Body))
+	if err != nil {
+		const message = "failed on encoding"
+
+		appLogger.Error(message)
+
+		return &pserror.PasswordSharingError{
+			Code:    pserror.EncodeError,
+			Message: message,
+		}
+	}
+
+	var command *gorm.DB
+	measureTime(func() {
+		command = db.Model(&model.IdempotencyKey{}).
+			Where("key_hash = ? AND status = 0", s.keyHash(c, t, key)).
+			Updates(map[string]interface{}{
+				"status":   response.Status,
+				"key_id":   keyId,
+				"response": encoded,
+			})
+	}, dbTime.WithLabelValues(completeIdempotencyKey))
+	dbCounter.WithLabelValues(completeIdempotencyKey).Inc()
+
+	if command.Error != nil {
+		return dbCommandError(appLogger, command.Error)
+	}
+
+	return nil
+}
+
+func (s *idempotencyService) Release(c context.Context, key string) error {
+	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
+	if err != nil {
+		return err
+	}
+	defer loggerClose()
+
+	db, dbClose, err := s.dbFactory.InitDB(c)
+	if err != nil {
+		return initDbError(appLogger)
+	}
+	defer dbClose()
+
+	t := tenantOf(c, s.tenants)
+
+	var command *gorm.DB
+	measureTime(func() {
+		command = db.Where("key_hash = ? AND status = 0", s.keyHash(c, t, key)).Delete(&model.IdempotencyKey{})
+	}, dbTime.WithLabelValues(releaseIdempotencyKey))
+	dbCounter.WithLabelValues(releaseIdempotencyKey).Inc()
+
+	if command.Error != nil {
+		return dbCommandError(appLogger, command.Error)
+	}
+
+	return nil
+}
+
+func (s *idempotencyService) decode(appLogger *zap.Logger, t *tenant.Tenant, existing *model.IdempotencyKey) (*IdempotentResponse, error) {
+	encoder, err := s.keys.Encoder(t.Id, existing.KeyId)
+	if err != nil {
+		return nil, keyProviderError(appLogger, err, t.Id)
+	}
+
+	body, err := encoder.Decode(existing.Response)
+	if err != nil {
+		const message = "failed on decoding"
+
+		appLogger.Error(message)
+
+		return nil, &pserror.PasswordSharingError{
+			Code:    pserror.DecodeError,
+			Message: message,
+		}
+	}
+
+	appLogger.Debug("replaying idempotent response",
+		zap.String("tenant", t.Id),
+	)
+
+	return &IdempotentResponse{
+		Status: existing.Status,
+		Body:   []byte(body),
+	}, nil
+}
+
+// keyHash scopes key to the tenant and the caller, anonymous callers of a
+// tenant share a scope.
+func (s *idempotencyService) keyHash(c context.Context, t *tenant.Tenant, key string) string {
+	caller := ""
+	if principal := auth.PrincipalFrom(c); principal != nil {
+		caller = principal.Subject
+	}
+
+	return helper.Hash(t.Id + "\x00" + caller + "\x00" + key)
+}
+
+func (s *idempotencyService) ttl() time.Duration {
+	if s.configuration.Idempotency.Ttl > 0 {
+		return s.configuration.Idempotency.Ttl
+	}
+
+	return defaultIdempotencyTtl
+}
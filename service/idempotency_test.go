@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/misikdmitriy/password-sharing/auth"
+	"github.com/misikdmitriy/password-sharing/config"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/helper"
+	"github.com/misikdmitriy/password-sharing/keys"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/model"
+)
+
+func TestIdempotencyShouldReplayResponses(t *testing.T) {
+	c := &config.Config{}
+
+	_, tenants, dbf := newTenantTestService(t, c, nil)
+	s := NewIdempotencyService(dbf, c, logger.NewTestLoggerFactory(), keys.NewProvider(config.NewStore(c)), tenants)
+
+	ctxt := context.Background()
+	response := IdempotentResponse{Status: 201, Body: []byte(`{"url":"http://localhost/abcdefgh"}`)}
+
+	if replayed, err := s.Begin(ctxt, "retry-1", []byte("body")); err != nil || replayed != nil {
+		t.Fatalf("expected the key to be claimed but was %v, %v", replayed, err)
+	}
+
+	if _, err := s.Begin(ctxt, "retry-1", []byte("body")); !errors.Is(err, pserror.IdempotencyKeyInProgress) {
+		t.Errorf("expected key in progress but was %v", err)
+	}
+
+	if err := s.Complete(ctxt, "retry-1", response); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, err := s.Begin(ctxt, "retry-1", []byte("body"))
+	if err != nil || replayed == nil || replayed.Status != response.Status || string(replayed.Body) != string(response.Body) {
+		t.Fatalf("expected the response to be replayed but was %v, %v", replayed, err)
+	}
+
+	if _, err = s.Begin(ctxt, "retry-1", []byte("other body")); !errors.Is(err, pserror.IdempotencyKeyReused) {
+		t.Errorf("expected key reused but was %v", err)
+	}
+
+	// keys of other callers do not collide
+	other := auth.WithPrincipal(ctxt, &auth.Principal{Subject: "ci"})
+	if replayed, err = s.Begin(other, "retry-1", []byte("body")); err != nil || replayed != nil {
+		t.Errorf("expected the key of another caller to be claimed but was %v, %v", replayed, err)
+	}
+
+	db, dbClose, err := dbf.InitDB(ctxt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbClose()
+
+	var stored []model.IdempotencyKey
+	if err = db.Find(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, row := range stored {
+		if strings.Contains(row.Response, "abcdefgh") || strings.Contains(row.KeyHash, "retry-1") || row.RequestHash == helper.Hash("body") {
+			t.Errorf("expected responses and keys not to be stored in plain text but was %+v", row)
+		}
+	}
+}
+
+func TestIdempotencyShouldReleaseFailedRequests(t *testing.T) {
+	c := &config.Config{}
+
+	_, tenants, dbf := newTenantTestService(t, c, nil)
+	s := NewIdempotencyService(dbf, c, logger.NewTestLoggerFactory(), keys.NewProvider(config.NewStore(c)), tenants)
+
+	ctxt := context.Background()
+
+	if _, err := s.Begin(ctxt, strings.Repeat("k", MaxIdempotencyKeyLength+1), []byte("body")); !errors.Is(err, pserror.InvalidIdempotencyKey) {
+		t.Errorf("expected invalid idempotency key but was %v", err)
+	}
+
+	if _, err := s.Begin(ctxt, "retry-2", []byte("body")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Release(ctxt, "retry-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if replayed, err := s.Begin(ctxt, "retry-2", []byte("other body")); err != nil || replayed != nil {
+		t.Errorf("expected a released key to be claimed again but was %v, %v", replayed, err)
+	}
+}
@@ -2,14 +2,21 @@ package service
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgconn"
+	"github.com/misikdmitriy/password-sharing/audit"
+	"github.com/misikdmitriy/password-sharing/auth"
 	"github.com/misikdmitriy/password-sharing/config"
 	"github.com/misikdmitriy/password-sharing/database"
 	pserror "github.com/misikdmitriy/password-sharing/error"
 	"github.com/misikdmitriy/password-sharing/helper"
+	"github.com/misikdmitriy/password-sharing/keys"
 	"github.com/misikdmitriy/password-sharing/logger"
 	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/notify"
+	"github.com/misikdmitriy/password-sharing/tenant"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"go.uber.org/zap"
@@ -17,8 +24,44 @@ import (
 )
 
 type PasswordService interface {
-	GetPasswordFromLink(context.Context, string) (string, error)
-	CreateLinkFromPassword(context.Context, string) (string, error)
+	GetPasswordFromLink(context.Context, string, RevealOptions) (string, error)
+	CreateLinkFromPassword(context.Context, string, LinkOptions) (*CreatedLink, error)
+	LinkExists(context.Context, string) (bool, error)
+	DeleteLink(context.Context, string) error
+}
+
+// LinkOptions are requested by the creator, the tenant policy caps them.
+// Zero values fall back to the policy.
+type LinkOptions struct {
+	Ttl        time.Duration
+	MaxViews   int
+	Passphrase string
+	// Recipients restricts the link to these email addresses, they prove
+	// ownership with a one-time code.
+	Recipients []string
+	// AllowedCidrs restricts the link to client addresses in these networks.
+	AllowedCidrs []string
+}
+
+type RevealOptions struct {
+	Passphrase string
+	Email      string
+	Code       string
+	// ClientIp is checked against the allowlists of the tenant and the link.
+	ClientIp string
+}
+
+type PasswordStrength struct {
+	*helper.Strength
+	BreachCount int
+}
+
+type CreatedLink struct {
+	Link      string
+	ExpiresAt *time.Time
+	MaxViews  int
+	// Strength is nil when strength evaluation is disabled.
+	Strength *PasswordStrength
 }
 
 type passwordService struct {
@@ -26,20 +69,37 @@ type passwordService struct {
 	configuration *config.Config
 	randomFactory helper.RandomGeneratorFactory
 	loggerFactory logger.LoggerFactory
-	encoder       helper.Encoder
+	keys          keys.Provider
+	tenants       tenant.Registry
+	estimator     helper.StrengthEstimator
+	breachChecker helper.BreachChecker
+	notifier      notify.Notifier
+	recorder      audit.Recorder
+	linkHasher    helper.Hasher
 }
 
 func NewPasswordService(dbFactory database.DbFactory,
 	conf *config.Config,
 	rf helper.RandomGeneratorFactory,
 	loggerFactory logger.LoggerFactory,
-	encoder helper.Encoder) PasswordService {
+	keys keys.Provider,
+	tenants tenant.Registry,
+	estimator helper.StrengthEstimator,
+	breachChecker helper.BreachChecker,
+	notifier notify.Notifier,
+	recorder audit.Recorder) PasswordService {
 	return &passwordService{
 		dbFactory:     dbFactory,
 		configuration: conf,
 		randomFactory: rf,
 		loggerFactory: loggerFactory,
-		encoder:       encoder,
+		keys:          keys,
+		tenants:       tenants,
+		estimator:     estimator,
+		breachChecker: breachChecker,
+		notifier:      notifier,
+		recorder:      recorder,
+		linkHasher:    helper.NewLinkHasher(conf.Encrypt.Secret),
 	}
 }
 
@@ -66,58 +126,107 @@ var (
 const (
 	newPassword     = "new_password"
 	getPassword     = "get_password"
+	viewPassword    = "view_password"
+	linkStatus      = "link_status"
+	deletePassword  = "delete_password"
 	uniqueViolation = "unique_violation"
 	unknownError    = "unknown_error"
 	notFound        = "not_found"
 )
 
-func (s *passwordService) CreateLinkFromPassword(c context.Context, password string) (string, error) {
+func (s *passwordService) CreateLinkFromPassword(c context.Context, password string, options LinkOptions) (*CreatedLink, error) {
 	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer loggerClose()
 
+	t := tenantOf(c, s.tenants)
+	options, err = applyPolicy(appLogger, t, password, options)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients, err := normalizeRecipients(appLogger, options.Recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	allowedCidrs, err := normalizeAllowlist(appLogger, options.AllowedCidrs)
+	if err != nil {
+		return nil, err
+	}
+
+	strength, err := s.evaluateStrength(appLogger, password)
+	if err != nil {
+		return nil, err
+	}
+
 	db, dbClose, err := s.dbFactory.InitDB(c)
 	if err != nil {
-		return "", initDbError(appLogger)
+		return nil, initDbError(appLogger)
 	}
 	defer dbClose()
 
-	encoded, err := s.encoder.Encode(password)
+	encoder, keyId, err := s.keys.Active(t.Id)
+	if err != nil {
+		return nil, keyProviderError(appLogger, err, t.Id)
+	}
+
+	encoded, err := encoder.Encode(password)
 	if err != nil {
 		const message = "failed on encoding"
 
 		appLogger.Error(message)
 
-		return "", &pserror.PasswordSharingError{
+		return nil, &pserror.PasswordSharingError{
 			Code:    pserror.EncodeError,
 			Message: message,
 		}
 	}
 
+	passphraseHash := ""
+	if options.Passphrase != "" {
+		passphraseHash, err = helper.HashPassphrase(options.Passphrase)
+		if err != nil {
+			return nil, randomizerError(appLogger, err, 0)
+		}
+	}
+
+	now := time.Now().UTC()
+	var expiresAt *time.Time
+	if options.Ttl > 0 {
+		at := now.Add(options.Ttl)
+		expiresAt = &at
+	}
+
+	owner := ""
+	if principal := auth.PrincipalFrom(c); principal != nil {
+		owner = principal.Subject
+	}
+
 	for {
 		rg := s.randomFactory.NewRandomGenerator()
 		link, err := rg.RandomString(s.configuration.App.LinkLength)
 		if err != nil {
-			const message = "error on randomizing"
-
-			appLogger.Error(message,
-				zap.Error(err),
-				zap.Int("length", s.configuration.App.LinkLength),
-			)
-
-			return "", &pserror.PasswordSharingError{
-				Code:    pserror.RandomizerError,
-				Message: message,
-			}
+			return nil, randomizerError(appLogger, err, s.configuration.App.LinkLength)
 		}
 
 		var command *gorm.DB
 		measureTime(func() {
 			command = db.Save(&model.Password{
-				Link:     link,
-				Password: encoded,
+				Link:           link,
+				LinkHash:       s.linkHasher.Hash(link),
+				Password:       encoded,
+				Owner:          owner,
+				TenantId:       t.Id,
+				KeyId:          keyId,
+				CreatedAt:      &now,
+				ExpiresAt:      expiresAt,
+				MaxViews:       options.MaxViews,
+				PassphraseHash: passphraseHash,
+				Recipients:     strings.Join(recipients, ","),
+				AllowedCidrs:   strings.Join(allowedCidrs, ","),
 			})
 		}, dbTime.WithLabelValues(newPassword))
 		dbCounter.WithLabelValues(newPassword).Inc()
@@ -130,33 +239,141 @@ func (s *passwordService) CreateLinkFromPassword(c context.Context, password str
 				continue
 			}
 
-			const message = "error on db command"
+			return nil, dbCommandError(appLogger, err)
+		}
 
-			dbErrorsCounter.WithLabelValues(unknownError).Inc()
-			appLogger.Error(message,
-				zap.Error(err),
-			)
+		appLogger.Debug("link generated",
+			zap.String("tenant", t.Id),
+		)
 
-			return "", &pserror.PasswordSharingError{
-				Code:    pserror.DbCommandError,
+		s.record(c, audit.Event{
+			TenantId: t.Id,
+			Action:   audit.ActionCreateSecret,
+			Target:   s.linkHasher.Hash(link),
+			Outcome:  audit.OutcomeSuccess,
+		})
+		return &CreatedLink{
+			Link:      link,
+			ExpiresAt: expiresAt,
+			MaxViews:  options.MaxViews,
+			Strength:  strength,
+		}, nil
+	}
+}
+
+// applyPolicy enforces the tenant policy on a new secret and fills in the
+// policy limits for options the creator left out.
+func applyPolicy(appLogger *zap.Logger, t *tenant.Tenant, password string, options LinkOptions) (LinkOptions, error) {
+	policy := t.Policy
+
+	if policy.MaxSize > 0 && len(password) > policy.MaxSize {
+		const message = "secret is too large"
+
+		appLogger.Warn(message,
+			zap.String("tenant", t.Id),
+			zap.Int("size", len(password)),
+			zap.Int("maxSize", policy.MaxSize),
+		)
+
+		return options, &pserror.PasswordSharingError{
+			Code:    pserror.SecretTooLarge,
+			Message: message,
+		}
+	}
+
+	if policy.RequirePassphrase && options.Passphrase == "" {
+		const message = "passphrase is required"
+
+		appLogger.Warn(message,
+			zap.String("tenant", t.Id),
+		)
+
+		return options, &pserror.PasswordSharingError{
+			Code:    pserror.PassphraseRequired,
+			Message: message,
+		}
+	}
+
+	if policy.MaxTtl > 0 && (options.Ttl <= 0 || options.Ttl > policy.MaxTtl) {
+		options.Ttl = policy.MaxTtl
+	}
+
+	if policy.MaxViews > 0 && (options.MaxViews <= 0 || options.MaxViews > policy.MaxViews) {
+		options.MaxViews = policy.MaxViews
+	}
+
+	return options, nil
+}
+
+// evaluateStrength returns advisory strength information and enforces the
+// configured policy. It returns nil when the evaluation is disabled.
+func (s *passwordService) evaluateStrength(appLogger *zap.Logger, password string) (*PasswordStrength, error) {
+	policy := s.configuration.Strength
+	if !policy.Enabled {
+		return nil, nil
+	}
+
+	result := &PasswordStrength{
+		Strength: s.estimator.Estimate(password),
+	}
+
+	count, err := s.breachChecker.Count(password)
+	if err != nil {
+		const message = "error on breach check"
+
+		appLogger.Error(message,
+			zap.Error(err),
+		)
+
+		if policy.RejectBreached {
+			return nil, &pserror.PasswordSharingError{
+				Code:    pserror.BreachCheckError,
 				Message: message,
+				Cause:   err,
 			}
 		}
+	}
+	result.BreachCount = count
+
+	if result.Score < policy.MinScore {
+		const message = "password is too weak"
+
+		appLogger.Warn(message,
+			zap.Int("score", result.Score),
+			zap.Int("minScore", policy.MinScore),
+		)
 
-		appLogger.Debug("link generated")
-		return link, nil
+		return nil, &pserror.PasswordSharingError{
+			Code:    pserror.WeakPassword,
+			Message: message,
+		}
 	}
+
+	if policy.RejectBreached && result.BreachCount > 0 {
+		const message = "password was found in a data breach"
+
+		appLogger.Warn(message)
+
+		return nil, &pserror.PasswordSharingError{
+			Code:    pserror.BreachedPassword,
+			Message: message,
+		}
+	}
+
+	return result, nil
 }
 
 const recordNotFoundError = "record not found"
 
-func (s *passwordService) GetPasswordFromLink(c context.Context, link string) (string, error) {
+func (s *passwordService) GetPasswordFromLink(c context.Context, link string, options RevealOptions) (string, error) {
 	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
 	if err != nil {
 		return "", err
 	}
 	defer loggerClose()
 
+	t := tenantOf(c, s.tenants)
+
 	db, dbClose, err := s.dbFactory.InitDB(c)
 	if err != nil {
 		return "", initDbError(appLogger)
@@ -166,7 +383,7 @@ func (s *passwordService) GetPasswordFromLink(c context.Context, link string) (s
 	result := &model.Password{}
 	var query *gorm.DB
 	measureTime(func() {
-		query = db.Where(&model.Password{Link: link}).First(result)
+		query = forTenant(db, t).Where(&model.Password{Link: link}).First(result)
 	}, dbTime.WithLabelValues(getPassword))
 	dbCounter.WithLabelValues(getPassword).Inc()
 
@@ -177,6 +394,7 @@ func (s *passwordService) GetPasswordFromLink(c context.Context, link string) (s
 			dbErrorsCounter.WithLabelValues(notFound).Inc()
 			appLogger.Warn(message,
 				zap.String("link", link),
+				zap.String("tenant", t.Id),
 			)
 
 			return "", &pserror.PasswordSharingError{
@@ -193,12 +411,85 @@ func (s *passwordService) GetPasswordFromLink(c context.Context, link string) (s
 		)
 
 		return "", &pserror.PasswordSharingError{
-			Code:    pserror.RandomizerError,
+			Code:    pserror.DbQueryError,
 			Message: message,
+			Cause:   err,
+		}
+	}
+
+	password, err := s.reveal(c, db, appLogger, t, result, options)
+	s.record(c, audit.Event{
+		TenantId: t.Id,
+		Action:   audit.ActionViewSecret,
+		Target:   result.LinkHash,
+		Outcome:  outcomeOf(err),
+	})
+
+	if err == nil && result.MaxViews > 0 && result.Views+1 >= result.MaxViews {
+		s.record(c, audit.Event{
+			TenantId: t.Id,
+			Action:   audit.ActionExpireSecret,
+			Target:   result.LinkHash,
+			Outcome:  audit.OutcomeExhausted,
+		})
+	}
+
+	return password, err
+}
+
+// reveal checks every restriction of a found password, decrypts it and
+// counts the view.
+func (s *passwordService) reveal(c context.Context, db *gorm.DB, appLogger *zap.Logger, t *tenant.Tenant, result *model.Password, options RevealOptions) (string, error) {
+	if result.Expired(time.Now()) || result.Exhausted() {
+		return "", passwordExpiredError(appLogger, result.Link)
+	}
+
+	// the address is checked first, so callers outside of the allowlist can
+	// neither guess passphrases nor trigger one-time codes
+	if err := s.checkAddress(db, appLogger, t, result, options.ClientIp); err != nil {
+		return "", err
+	}
+
+	if result.PassphraseHash != "" {
+		if options.Passphrase == "" {
+			const message = "passphrase is required"
+
+			appLogger.Debug(message,
+				zap.String("link", result.Link),
+			)
+
+			return "", &pserror.PasswordSharingError{
+				Code:    pserror.PassphraseRequired,
+				Message: message,
+			}
 		}
+
+		if !helper.PassphraseEquals(options.Passphrase, result.PassphraseHash) {
+			const message = "invalid passphrase"
+
+			appLogger.Warn(message,
+				zap.String("link", result.Link),
+			)
+
+			return "", &pserror.PasswordSharingError{
+				Code:    pserror.InvalidPassphrase,
+				Message: message,
+			}
+		}
+	}
+
+	if result.Recipients != "" {
+		if err := s.verifyRecipient(c, db, appLogger, result, options); err != nil {
+			return "", err
+		}
+	}
+
+	encoder, err := s.keys.Encoder(result.TenantId, result.KeyId)
+	if err != nil {
+		return "", keyProviderError(appLogger, err, result.TenantId)
 	}
 
-	decoded, err := s.encoder.Decode(result.Password)
+	decoded, err := encoder.Decode(result.Password)
 	if err != nil {
 		const message = "failed on decoding"
 
@@ -210,9 +501,167 @@ func (s *passwordService) GetPasswordFromLink(c context.Context, link string) (s
 		}
 	}
 
+	// the view limit condition makes concurrent reveals safe, the last view
+	// goes to exactly one caller
+	var command *gorm.DB
+	measureTime(func() {
+		command = db.Model(&model.Password{}).
+			Where("id = ? AND (max_views = 0 OR views < max_views)", result.Id).
+			Update("views", gorm.Expr("views + 1"))
+	}, dbTime.WithLabelValues(viewPassword))
+	dbCounter.WithLabelValues(viewPassword).Inc()
+
+	if err := command.Error; err != nil {
+		return "", dbCommandError(appLogger, err)
+	}
+
+	if command.RowsAffected == 0 {
+		return "", passwordExpiredError(appLogger, result.Link)
+	}
+
 	return decoded, nil
 }
 
+func (s *passwordService) LinkExists(c context.Context, link string) (bool, error) {
+	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
+	if err != nil {
+		return false, err
+	}
+	defer loggerClose()
+
+	db, dbClose, err := s.dbFactory.InitDB(c)
+	if err != nil {
+		return false, initDbError(appLogger)
+	}
+	defer dbClose()
+
+	var count int64
+	var query *gorm.DB
+	measureTime(func() {
+		query = forTenant(db, tenantOf(c, s.tenants)).
+			Model(&model.Password{}).
+			Where(&model.Password{Link: link}).
+			Where("expires_at IS NULL OR expires_at > ?", time.Now().UTC()).
+			Where("max_views = 0 OR views < max_views").
+			Count(&count)
+	}, dbTime.WithLabelValues(linkStatus))
+	dbCounter.WithLabelValues(linkStatus).Inc()
+
+	if err := query.Error; err != nil {
+		const message = "error on db query"
+
+		dbErrorsCounter.WithLabelValues(unknownError).Inc()
+		appLogger.Error(message,
+			zap.Error(err),
+		)
+
+		return false, &pserror.PasswordSharingError{
+			Code:    pserror.DbQueryError,
+			Message: message,
+			Cause:   err,
+		}
+	}
+
+	return count > 0, nil
+}
+
+// DeleteLink removes a link of the tenant, it takes back links created as
+// part of a request that failed later on.
+func (s *passwordService) DeleteLink(c context.Context, link string) error {
+	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
+	if err != nil {
+		return err
+	}
+	defer loggerClose()
+
+	db, dbClose, err := s.dbFactory.InitDB(c)
+	if err != nil {
+		return initDbError(appLogger)
+	}
+	defer dbClose()
+
+	t := tenantOf(c, s.tenants)
+	linkHash := s.linkHasher.Hash(link)
+
+	var command *gorm.DB
+	measureTime(func() {
+		command = forTenant(db, t).Where(&model.Password{LinkHash: linkHash}).Delete(&model.Password{})
+	}, dbTime.WithLabelValues(deletePassword))
+	dbCounter.WithLabelValues(deletePassword).Inc()
+
+	if err := command.Error; err != nil {
+		return dbCommandError(appLogger, err)
+	}
+
+	s.record(c, audit.Event{
+		TenantId: t.Id,
+		Action:   audit.ActionDeleteSecret,
+		Target:   linkHash,
+		Outcome:  audit.OutcomeSuccess,
+	})
+	return nil
+}
+
+// tenantOf returns the tenant resolved for the request, calls outside of
+// requests act on behalf of the default tenant.
+func tenantOf(c context.Context, tenants tenant.Registry) *tenant.Tenant {
+	if t := tenant.From(c); t != nil {
+		return t
+	}
+
+	return tenants.Default()
+}
+
+// forTenant scopes a query to the rows of t. Every query of tenant owned rows
+// starts from it, so a link of one tenant is never found by another.
+func forTenant(db *gorm.DB, t *tenant.Tenant) *gorm.DB {
+	return db.Where("tenant_id = ?", t.Id)
+}
+
+// record ignores failures, the recorder logs them and the audit log must not
+// decide whether a secret can be shared.
+func (s *passwordService) record(c context.Context, event audit.Event) {
+	_ = s.recorder.Record(c, event)
+}
+
+// outcomeOf names the result of an audited action, failures by their error
+// type, e.g. invalid-passphrase.
+func outcomeOf(err error) string {
+	if err == nil {
+		return audit.OutcomeSuccess
+	}
+
+	return pserror.Lookup(pserror.AsPasswordSharingError(err).Code).Slug()
+}
+
+func passwordExpiredError(log *zap.Logger, link string) error {
+	const message = "password expired"
+
+	log.Warn(message,
+		zap.String("link", link),
+	)
+
+	return &pserror.PasswordSharingError{
+		Code:    pserror.PasswordExpired,
+		Message: message,
+	}
+}
+
+func keyProviderError(log *zap.Logger, err error, tenantId string) error {
+	const message = "failed to get data key"
+
+	log.Error(message,
+		zap.Error(err),
+		zap.String("tenant", tenantId),
+	)
+
+	return &pserror.PasswordSharingError{
+		Code:    pserror.KeyProviderError,
+		Message: message,
+		Cause:   err,
+	}
+}
+
 func measureTime(action func(), metric prometheus.Observer) {
 	timer := prometheus.NewTimer(metric)
 	action()
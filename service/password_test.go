@@ -2,13 +2,23 @@ package service
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/misikdmitriy/password-sharing/audit"
+	"github.com/misikdmitriy/password-sharing/auth"
 	"github.com/misikdmitriy/password-sharing/config"
 	"github.com/misikdmitriy/password-sharing/database"
+	pserror "github.com/misikdmitriy/password-sharing/error"
 	"github.com/misikdmitriy/password-sharing/helper"
+	"github.com/misikdmitriy/password-sharing/keys"
 	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/notify"
+	"github.com/misikdmitriy/password-sharing/tenant"
 	"github.com/misikdmitriy/password-sharing/tests"
 )
 
@@ -23,7 +33,7 @@ func TestCreateLinkFromPasswordShouldDoIt(t *testing.T) {
 	c.App.LinkLength = 8
 
 	loggerFactory := logger.NewTestLoggerFactory()
-	encoder := helper.NewEncoder(c)
+	tenants, _ := tenant.NewRegistry(c)
 	dbf := database.NewFactory(c, loggerFactory)
 	err := tests.MigrateDatabase(ctxt, dbf)
 	if err != nil {
@@ -31,14 +41,345 @@ func TestCreateLinkFromPasswordShouldDoIt(t *testing.T) {
 	}
 
 	rf := helper.NewRandomFactory()
-	s := NewPasswordService(dbf, c, rf, loggerFactory, encoder)
+	s := NewPasswordService(dbf, c, rf, loggerFactory, keys.NewProvider(config.NewStore(c)), tenants, helper.NewStrengthEstimator(), helper.NewBreachChecker(""), notify.NewLogNotifier(loggerFactory),
+		audit.NewSinkRecorder(loggerFactory, audit.NewDbSink(dbf)))
 
-	result, err := s.CreateLinkFromPassword(ctxt, uuid.New().String())
+	result, err := s.CreateLinkFromPassword(ctxt, uuid.New().String(), LinkOptions{})
 	if err != nil {
 		t.Error(err)
 	}
 
-	if len(result) != c.App.LinkLength {
-		t.Errorf("expected password length to be %d but was %d", c.App.LinkLength, len(result))
+	if len(result.Link) != c.App.LinkLength {
+		t.Errorf("expected password length to be %d but was %d", c.App.LinkLength, len(result.Link))
+	}
+}
+
+func TestCreateLinkFromPasswordShouldRejectWeakPassword(t *testing.T) {
+	c := &config.Config{}
+	c.Database.ConnectionString = "inmemdb"
+	c.Database.Provider = "sqlite"
+	c.Encrypt.Secret = "123456789123456789012345"
+	c.Encrypt.IV = []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	c.App.LinkLength = 8
+	c.Strength.Enabled = true
+	c.Strength.MinScore = 3
+
+	ctxt := context.Background()
+
+	loggerFactory := logger.NewTestLoggerFactory()
+	tenants, _ := tenant.NewRegistry(c)
+	dbf := database.NewFactory(c, loggerFactory)
+	err := tests.MigrateDatabase(ctxt, dbf)
+	if err != nil {
+		t.Error(err)
+	}
+
+	rf := helper.NewRandomFactory()
+	s := NewPasswordService(dbf, c, rf, loggerFactory, keys.NewProvider(config.NewStore(c)), tenants, helper.NewStrengthEstimator(), helper.NewBreachChecker(""), notify.NewLogNotifier(loggerFactory),
+		audit.NewSinkRecorder(loggerFactory, audit.NewDbSink(dbf)))
+
+	_, err = s.CreateLinkFromPassword(ctxt, "password", LinkOptions{})
+	if code := pserror.AsPasswordSharingError(err).Code; code != pserror.WeakPassword {
+		t.Errorf("expected code %d but was %d", pserror.WeakPassword, code)
+	}
+
+	result, err := s.CreateLinkFromPassword(ctxt, uuid.New().String(), LinkOptions{})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if result.Strength == nil || result.Strength.Score < c.Strength.MinScore {
+		t.Errorf("expected strength report with score at least %d", c.Strength.MinScore)
+	}
+}
+
+func TestCreateLinkFromPasswordShouldRecordOwner(t *testing.T) {
+	c := &config.Config{}
+	c.Database.ConnectionString = "inmemdb"
+	c.Database.Provider = "sqlite"
+	c.Encrypt.Secret = "123456789123456789012345"
+	c.Encrypt.IV = []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	c.App.LinkLength = 8
+
+	ctxt := auth.WithPrincipal(context.Background(), &auth.Principal{
+		Subject: "user-1",
+		Method:  auth.MethodJwt,
+	})
+
+	loggerFactory := logger.NewTestLoggerFactory()
+	tenants, _ := tenant.NewRegistry(c)
+	dbf := database.NewFactory(c, loggerFactory)
+	err := tests.MigrateDatabase(ctxt, dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rf := helper.NewRandomFactory()
+	s := NewPasswordService(dbf, c, rf, loggerFactory, keys.NewProvider(config.NewStore(c)), tenants, helper.NewStrengthEstimator(), helper.NewBreachChecker(""), notify.NewLogNotifier(loggerFactory),
+		audit.NewSinkRecorder(loggerFactory, audit.NewDbSink(dbf)))
+
+	result, err := s.CreateLinkFromPassword(ctxt, uuid.New().String(), LinkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, dbClose, err := dbf.InitDB(ctxt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbClose()
+
+	stored := &model.Password{}
+	if err = db.Where(&model.Password{Link: result.Link}).First(stored).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.Owner != "user-1" {
+		t.Errorf("expected owner to be user-1 but was %q", stored.Owner)
+	}
+}
+
+func newTenantTestService(t *testing.T, c *config.Config, notifier notify.Notifier) (PasswordService, tenant.Registry, database.DbFactory) {
+	c.Database.ConnectionString = "inmemdb"
+	c.Database.Provider = "sqlite"
+	c.Encrypt.Secret = "123456789123456789012345"
+	c.Encrypt.IV = []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	c.App.LinkLength = 8
+
+	tenants, err := tenant.NewRegistry(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loggerFactory := logger.NewTestLoggerFactory()
+	dbf := database.NewFactory(c, loggerFactory)
+	if err = tests.MigrateDatabase(context.Background(), dbf); err != nil {
+		t.Fatal(err)
+	}
+
+	if notifier == nil {
+		notifier = notify.NewLogNotifier(loggerFactory)
+	}
+
+	s := NewPasswordService(dbf, c, helper.NewRandomFactory(), loggerFactory, keys.NewProvider(config.NewStore(c)), tenants,
+		helper.NewStrengthEstimator(), helper.NewBreachChecker(""), notifier, audit.NewSinkRecorder(loggerFactory, audit.NewDbSink(dbf)))
+
+	return s, tenants, dbf
+}
+
+func TestGetPasswordFromLinkShouldNotCrossTenants(t *testing.T) {
+	c := &config.Config{}
+	c.Tenancy.Tenants = []config.Tenant{{Id: "finance"}, {Id: "engineering"}}
+
+	s, tenants, dbf := newTenantTestService(t, c, nil)
+
+	finance, _ := tenants.Get("finance")
+	engineering, _ := tenants.Get("engineering")
+	financeCtxt := tenant.WithTenant(context.Background(), finance)
+	engineeringCtxt := tenant.WithTenant(context.Background(), engineering)
+
+	created, err := s.CreateLinkFromPassword(financeCtxt, "finance secret", LinkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.GetPasswordFromLink(engineeringCtxt, created.Link, RevealOptions{})
+	if !errors.Is(err, pserror.PasswordNotFound) {
+		t.Errorf("expected password not found for another tenant but was %v", err)
+	}
+
+	exists, err := s.LinkExists(engineeringCtxt, created.Link)
+	if err != nil || exists {
+		t.Errorf("expected link not to exist for another tenant")
+	}
+
+	// even a row read past the tenant scope does not decrypt with the key of
+	// another tenant
+	db, dbClose, err := dbf.InitDB(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbClose()
+
+	stored := &model.Password{}
+	if err = db.Where(&model.Password{Link: created.Link}).First(stored).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.TenantId != "finance" || stored.Password == "finance secret" {
+		t.Errorf("expected row to belong to finance and to be encrypted")
+	}
+
+	engineeringEncoder, err := keys.NewProvider(config.NewStore(c)).Encoder("engineering", stored.KeyId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = engineeringEncoder.Decode(stored.Password); err == nil {
+		t.Errorf("expected decryption with another tenant key to fail")
+	}
+
+	password, err := s.GetPasswordFromLink(financeCtxt, created.Link, RevealOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if password != "finance secret" {
+		t.Errorf("expected password to be 'finance secret' but was '%s'", password)
+	}
+}
+
+func TestDeleteLinkShouldOnlyDeleteLinksOfTenant(t *testing.T) {
+	c := &config.Config{}
+	c.Tenancy.Tenants = []config.Tenant{{Id: "finance"}, {Id: "engineering"}}
+
+	s, tenants, _ := newTenantTestService(t, c, nil)
+
+	finance, _ := tenants.Get("finance")
+	engineering, _ := tenants.Get("engineering")
+	financeCtxt := tenant.WithTenant(context.Background(), finance)
+	engineeringCtxt := tenant.WithTenant(context.Background(), engineering)
+
+	created, err := s.CreateLinkFromPassword(financeCtxt, "finance secret", LinkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.DeleteLink(engineeringCtxt, created.Link); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, err := s.LinkExists(financeCtxt, created.Link); err != nil || !exists {
+		t.Fatalf("expected another tenant not to delete the link")
+	}
+
+	if err = s.DeleteLink(financeCtxt, created.Link); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, err := s.LinkExists(financeCtxt, created.Link); err != nil || exists {
+		t.Errorf("expected the link to be deleted")
+	}
+}
+
+func TestCreateLinkFromPasswordShouldApplyTenantPolicy(t *testing.T) {
+	c := &config.Config{}
+	c.Tenancy.Tenants = []config.Tenant{{
+		Id:                "strict",
+		MaxTtl:            time.Hour,
+		MaxViews:          2,
+		MaxSize:           32,
+		RequirePassphrase: true,
+	}}
+
+	s, _, _ := newTenantTestService(t, c, nil)
+	ctxt := context.Background()
+
+	_, err := s.CreateLinkFromPassword(ctxt, strings.Repeat("x", 33), LinkOptions{Passphrase: "open sesame"})
+	if !errors.Is(err, pserror.SecretTooLarge) {
+		t.Errorf("expected secret too large but was %v", err)
+	}
+
+	_, err = s.CreateLinkFromPassword(ctxt, "secret", LinkOptions{})
+	if !errors.Is(err, pserror.PassphraseRequired) {
+		t.Errorf("expected passphrase required but was %v", err)
+	}
+
+	created, err := s.CreateLinkFromPassword(ctxt, "secret", LinkOptions{
+		Ttl:        24 * time.Hour,
+		MaxViews:   10,
+		Passphrase: "open sesame",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if created.MaxViews != 2 || created.ExpiresAt == nil || time.Until(*created.ExpiresAt) > time.Hour {
+		t.Errorf("expected ttl and views to be capped but were %v and %d", created.ExpiresAt, created.MaxViews)
+	}
+
+	cases := []struct {
+		passphrase string
+		err        error
+	}{
+		{"", pserror.PassphraseRequired},
+		{"wrong", pserror.InvalidPassphrase},
+		{"open sesame", nil},
+		{"open sesame", nil},
+		{"open sesame", pserror.PasswordExpired},
+	}
+
+	for i, tc := range cases {
+		password, err := s.GetPasswordFromLink(ctxt, created.Link, RevealOptions{Passphrase: tc.passphrase})
+		if tc.err == nil && (err != nil || password != "secret") {
+			t.Errorf("attempt %d: expected password but was %v", i, err)
+		}
+
+		if tc.err != nil && !errors.Is(err, tc.err) {
+			t.Errorf("attempt %d: expected %v but was %v", i, tc.err, err)
+		}
+	}
+}
+
+func TestGetPasswordFromLinkShouldEnforceAllowlists(t *testing.T) {
+	c := &config.Config{}
+	c.Tenancy.Tenants = []config.Tenant{{Id: "infra", AllowedCidrs: []string{"10.0.0.0/8"}}}
+
+	s, _, dbf := newTenantTestService(t, c, nil)
+	ctxt := context.Background()
+
+	_, err := s.CreateLinkFromPassword(ctxt, "secret", LinkOptions{AllowedCidrs: []string{"vpn"}})
+	if !errors.Is(err, pserror.InvalidAllowlist) {
+		t.Errorf("expected invalid allowlist but was %v", err)
+	}
+
+	created, err := s.CreateLinkFromPassword(ctxt, "secret", LinkOptions{
+		MaxViews:     1,
+		AllowedCidrs: []string{"10.8.0.0/16", "192.168.1.10"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name     string
+		clientIp string
+	}{
+		{"unknown address", ""},
+		{"outside of secret allowlist", "10.9.0.1"},
+		// the secret allows it but the tenant does not
+		{"outside of tenant allowlist", "192.168.1.10"},
+	}
+
+	for _, tc := range cases {
+		_, err = s.GetPasswordFromLink(ctxt, created.Link, RevealOptions{ClientIp: tc.clientIp})
+		if !errors.Is(err, pserror.AddressNotAllowed) {
+			t.Errorf("%s: expected address not allowed but was %v", tc.name, err)
+		}
+	}
+
+	// denied attempts do not consume the only view
+	password, err := s.GetPasswordFromLink(ctxt, created.Link, RevealOptions{ClientIp: "10.8.1.1"})
+	if err != nil || password != "secret" {
+		t.Fatalf("expected password to be revealed but was %v", err)
+	}
+
+	db, dbClose, err := dbf.InitDB(ctxt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbClose()
+
+	stored := &model.Password{}
+	if err = db.Where(&model.Password{Link: created.Link}).First(stored).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.DeniedViews != len(cases) || stored.Views != 1 {
+		t.Errorf("expected %d denied and 1 view but was %d and %d", len(cases), stored.DeniedViews, stored.Views)
+	}
+
+	if stored.AllowedCidrs != "10.8.0.0/16,192.168.1.10/32" {
+		t.Errorf("unexpected stored allowlist %s", stored.AllowedCidrs)
 	}
 }
@@ -0,0 +1,359 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/database"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/helper"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/tenant"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type SecretRequestService interface {
+	CreateSecretRequest(context.Context, string, time.Duration) (*model.SecretRequest, string, error)
+	GetSecretRequest(context.Context, string) (*model.SecretRequest, error)
+	FulfillSecretRequest(context.Context, string, string) error
+	GetSecretFromRequest(context.Context, string, string, string) (string, error)
+}
+
+type secretRequestService struct {
+	dbFactory       database.DbFactory
+	configuration   config.Source
+	randomFactory   helper.RandomGeneratorFactory
+	loggerFactory   logger.LoggerFactory
+	tenants         tenant.Registry
+	passwordService PasswordService
+}
+
+func NewSecretRequestService(dbFactory database.DbFactory,
+	conf config.Source,
+	rf helper.RandomGeneratorFactory,
+	loggerFactory logger.LoggerFactory,
+	tenants tenant.Registry,
+	passwordService PasswordService) SecretRequestService {
+	return &secretRequestService{
+		dbFactory:       dbFactory,
+		configuration:   conf,
+		randomFactory:   rf,
+		loggerFactory:   loggerFactory,
+		tenants:         tenants,
+		passwordService: passwordService,
+	}
+}
+
+const requestTokenLength = 32
+
+const (
+	newRequest     = "new_request"
+	getRequest     = "get_request"
+	fulfillRequest = "fulfill_request"
+	discardSecret  = "discard_secret"
+)
+
+// CreateSecretRequest stores a pending request and returns it together with
+// the plain requester token. Only the token hash is persisted, so the token
+// cannot be recovered later.
+func (s *secretRequestService) CreateSecretRequest(c context.Context, description string, ttl time.Duration) (*model.SecretRequest, string, error) {
+	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
+	if err != nil {
+		return nil, "", err
+	}
+	defer loggerClose()
+
+	conf := s.configuration.Current()
+	if ttl <= 0 {
+		ttl = conf.Request.DefaultTtl
+	}
+	if max := conf.Request.MaxTtl; max > 0 && ttl > max {
+		ttl = max
+	}
+
+	db, dbClose, err := s.dbFactory.InitDB(c)
+	if err != nil {
+		return nil, "", initDbError(appLogger)
+	}
+	defer dbClose()
+
+	rg := s.randomFactory.NewRandomGenerator()
+	token, err := rg.RandomString(requestTokenLength)
+	if err != nil {
+		return nil, "", randomizerError(appLogger, err, requestTokenLength)
+	}
+
+	for {
+		link, err := rg.RandomString(conf.App.LinkLength)
+		if err != nil {
+			return nil, "", randomizerError(appLogger, err, conf.App.LinkLength)
+		}
+
+		request := &model.SecretRequest{
+			Link:        link,
+			TenantId:    tenantOf(c, s.tenants).Id,
+			TokenHash:   helper.Hash(token),
+			Description: description,
+			ExpiresAt:   time.Now().UTC().Add(ttl),
+		}
+
+		var command *gorm.DB
+		measureTime(func() {
+			command = db.Create(request)
+		}, dbTime.WithLabelValues(newRequest))
+		dbCounter.WithLabelValues(newRequest).Inc()
+
+		if err := command.Error; err != nil {
+			pgErr, ok := err.(*pgconn.PgError)
+			if ok && pgErr.Code == pgUniqueViolationCode {
+				dbErrorsCounter.WithLabelValues(uniqueViolation).Inc()
+				appLogger.Warn("retry after unique key violation")
+				continue
+			}
+
+			return nil, "", dbCommandError(appLogger, err)
+		}
+
+		appLogger.Debug("secret request created")
+		return request, token, nil
+	}
+}
+
+func (s *secretRequestService) GetSecretRequest(c context.Context, link string) (*model.SecretRequest, error) {
+	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
+	if err != nil {
+		return nil, err
+	}
+	defer loggerClose()
+
+	db, dbClose, err := s.dbFactory.InitDB(c)
+	if err != nil {
+		return nil, initDbError(appLogger)
+	}
+	defer dbClose()
+
+	return s.findRequest(c, db, appLogger, link)
+}
+
+func (s *secretRequestService) FulfillSecretRequest(c context.Context, link string, password string) error {
+	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
+	if err != nil {
+		return err
+	}
+	defer loggerClose()
+
+	db, dbClose, err := s.dbFactory.InitDB(c)
+	if err != nil {
+		return initDbError(appLogger)
+	}
+	defer dbClose()
+
+	request, err := s.findRequest(c, db, appLogger, link)
+	if err != nil {
+		return err
+	}
+
+	if request.Expired(time.Now()) {
+		return requestExpiredError(appLogger, link)
+	}
+
+	if request.Fulfilled() {
+		return requestFulfilledError(appLogger, link)
+	}
+
+	// the requester has request.defaultttl to pick the secret up, the tenant
+	// policy may shorten it
+	ttl := s.configuration.Current().Request.DefaultTtl
+	created, err := s.passwordService.CreateLinkFromPassword(c, password, LinkOptions{Ttl: ttl})
+	if err != nil {
+		return err
+	}
+
+	// the empty password_link condition makes concurrent submissions safe:
+	// only the first one wins, the others see zero affected rows and
+	// discard the secret they created
+	var command *gorm.DB
+	measureTime(func() {
+		command = db.Model(&model.SecretRequest{}).
+			Where("id = ? AND password_link = ?", request.Id, "").
+			Update("password_link", created.Link)
+	}, dbTime.WithLabelValues(fulfillRequest))
+	dbCounter.WithLabelValues(fulfillRequest).Inc()
+
+	if err := command.Error; err != nil {
+		s.discardSecret(db, appLogger, created.Link)
+		return dbCommandError(appLogger, err)
+	}
+
+	if command.RowsAffected == 0 {
+		s.discardSecret(db, appLogger, created.Link)
+		return requestFulfilledError(appLogger, link)
+	}
+
+	appLogger.Debug("secret request fulfilled")
+	return nil
+}
+
+// discardSecret deletes a secret that lost the race to fulfil a request, no
+// one will ever get its link.
+func (s *secretRequestService) discardSecret(db *gorm.DB, appLogger *zap.Logger, link string) {
+	var command *gorm.DB
+	measureTime(func() {
+		command = db.Where("link = ?", link).Delete(&model.Password{})
+	}, dbTime.WithLabelValues(discardSecret))
+	dbCounter.WithLabelValues(discardSecret).Inc()
+
+	if err := command.Error; err != nil {
+		// the secret expires like every other one
+		appLogger.Error("failed to discard the secret of a fulfilled request",
+			zap.Error(err),
+		)
+	}
+}
+
+func (s *secretRequestService) GetSecretFromRequest(c context.Context, link string, token string, clientIp string) (string, error) {
+	appLogger, loggerClose, err := s.loggerFactory.NewLogger()
+	if err != nil {
+		return "", err
+	}
+	defer loggerClose()
+
+	db, dbClose, err := s.dbFactory.InitDB(c)
+	if err != nil {
+		return "", initDbError(appLogger)
+	}
+	defer dbClose()
+
+	request, err := s.findRequest(c, db, appLogger, link)
+	if err != nil {
+		return "", err
+	}
+
+	if !helper.HashEquals(token, request.TokenHash) {
+		const message = "invalid request token"
+
+		appLogger.Warn(message,
+			zap.String("link", link),
+		)
+
+		return "", &pserror.PasswordSharingError{
+			Code:    pserror.InvalidRequestToken,
+			Message: message,
+		}
+	}
+
+	if !request.Fulfilled() {
+		const message = "secret request is not fulfilled yet"
+
+		appLogger.Debug(message,
+			zap.String("link", link),
+		)
+
+		return "", &pserror.PasswordSharingError{
+			Code:    pserror.SecretRequestPending,
+			Message: message,
+		}
+	}
+
+	return s.passwordService.GetPasswordFromLink(c, request.PasswordLink, RevealOptions{ClientIp: clientIp})
+}
+
+func (s *secretRequestService) findRequest(c context.Context, db *gorm.DB, appLogger *zap.Logger, link string) (*model.SecretRequest, error) {
+	result := &model.SecretRequest{}
+	var query *gorm.DB
+	measureTime(func() {
+		query = forTenant(db, tenantOf(c, s.tenants)).Where(&model.SecretRequest{Link: link}).First(result)
+	}, dbTime.WithLabelValues(getRequest))
+	dbCounter.WithLabelValues(getRequest).Inc()
+
+	if err := query.Error; err != nil {
+		if err.Error() == recordNotFoundError {
+			const message = "secret request not found"
+
+			dbErrorsCounter.WithLabelValues(notFound).Inc()
+			appLogger.Warn(message,
+				zap.String("link", link),
+			)
+
+			return nil, &pserror.PasswordSharingError{
+				Code:    pserror.SecretRequestNotFound,
+				Message: message,
+			}
+		}
+
+		const message = "error on db query"
+
+		dbErrorsCounter.WithLabelValues(unknownError).Inc()
+		appLogger.Error(message,
+			zap.Error(err),
+		)
+
+		return nil, &pserror.PasswordSharingError{
+			Code:    pserror.DbQueryError,
+			Message: message,
+			Cause:   err,
+		}
+	}
+
+	return result, nil
+}
+
+func requestExpiredError(log *zap.Logger, link string) error {
+	const message = "secret request expired"
+
+	log.Warn(message,
+		zap.String("link", link),
+	)
+
+	return &pserror.PasswordSharingError{
+		Code:    pserror.SecretRequestExpired,
+		Message: message,
+	}
+}
+
+func requestFulfilledError(log *zap.Logger, link string) error {
+	const message = "secret request already fulfilled"
+
+	log.Warn(message,
+		zap.String("link", link),
+	)
+
+	return &pserror.PasswordSharingError{
+		Code:    pserror.SecretRequestFulfilled,
+		Message: message,
+	}
+}
+
+func randomizerError(log *zap.Logger, err error, length int) error {
+	const message = "error on randomizing"
+
+	log.Error(message,
+		zap.Error(err),
+		zap.Int("length", length),
+	)
+
+	return &pserror.PasswordSharingError{
+		Code:    pserror.RandomizerError,
+		Message: message,
+		Cause:   err,
+	}
+}
+
+func dbCommandError(log *zap.Logger, err error) error {
+	const message = "error on db command"
+
+	dbErrorsCounter.WithLabelValues(unknownError).Inc()
+	log.Error(message,
+		zap.Error(err),
+	)
+
+	return &pserror.PasswordSharingError{
+		Code:    pserror.DbCommandError,
+		Message: message,
+		Cause:   err,
+	}
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/misikdmitriy/password-sharing/audit"
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/database"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/helper"
+	"github.com/misikdmitriy/password-sharing/keys"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/misikdmitriy/password-sharing/notify"
+	"github.com/misikdmitriy/password-sharing/tenant"
+	"github.com/misikdmitriy/password-sharing/tests"
+)
+
+func newTestRequestService(t *testing.T, ctxt context.Context) SecretRequestService {
+	s, _ := newRacingRequestService(t, ctxt, nil)
+	return s
+}
+
+// racingPasswordService runs afterCreate after a secret was created, e.g.
+// to let another submission win the race.
+type racingPasswordService struct {
+	PasswordService
+	afterCreate func()
+}
+
+func (s *racingPasswordService) CreateLinkFromPassword(c context.Context, password string, options LinkOptions) (*CreatedLink, error) {
+	created, err := s.PasswordService.CreateLinkFromPassword(c, password, options)
+	if err == nil && s.afterCreate != nil {
+		s.afterCreate()
+	}
+
+	return created, err
+}
+
+func newRacingRequestService(t *testing.T, ctxt context.Context, afterCreate func()) (SecretRequestService, database.DbFactory) {
+	c := &config.Config{}
+	c.Database.ConnectionString = "inmemdb"
+	c.Database.Provider = "sqlite"
+	c.Encrypt.Secret = "123456789123456789012345"
+	c.Encrypt.IV = []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	c.App.LinkLength = 8
+	c.Request.DefaultTtl = time.Hour
+
+	loggerFactory := logger.NewTestLoggerFactory()
+	tenants, _ := tenant.NewRegistry(c)
+	dbf := database.NewFactory(c, loggerFactory)
+	err := tests.MigrateDatabase(ctxt, dbf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rf := helper.NewRandomFactory()
+	ps := NewPasswordService(dbf, c, rf, loggerFactory, keys.NewProvider(config.NewStore(c)), tenants, helper.NewStrengthEstimator(), helper.NewBreachChecker(""), notify.NewLogNotifier(loggerFactory),
+		audit.NewSinkRecorder(loggerFactory, audit.NewDbSink(dbf)))
+	return NewSecretRequestService(dbf, config.NewStore(c), rf, loggerFactory, tenants, &racingPasswordService{PasswordService: ps, afterCreate: afterCreate}), dbf
+}
+
+func TestSecretRequestShouldReturnSubmittedSecretToRequester(t *testing.T) {
+	ctxt := context.Background()
+	s := newTestRequestService(t, ctxt)
+
+	request, token, err := s.CreateSecretRequest(ctxt, "vpn credentials", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.GetSecretFromRequest(ctxt, request.Link, token, "")
+	if code := pserror.AsPasswordSharingError(err).Code; code != pserror.SecretRequestPending {
+		t.Errorf("expected code %d but was %d", pserror.SecretRequestPending, code)
+	}
+
+	secret := uuid.New().String()
+	if err = s.FulfillSecretRequest(ctxt, request.Link, secret); err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.FulfillSecretRequest(ctxt, request.Link, secret)
+	if code := pserror.AsPasswordSharingError(err).Code; code != pserror.SecretRequestFulfilled {
+		t.Errorf("expected code %d but was %d", pserror.SecretRequestFulfilled, code)
+	}
+
+	_, err = s.GetSecretFromRequest(ctxt, request.Link, "wrong token", "")
+	if code := pserror.AsPasswordSharingError(err).Code; code != pserror.InvalidRequestToken {
+		t.Errorf("expected code %d but was %d", pserror.InvalidRequestToken, code)
+	}
+
+	result, err := s.GetSecretFromRequest(ctxt, request.Link, token, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result != secret {
+		t.Errorf("expected secret to be '%s' but was '%s'", secret, result)
+	}
+}
+
+func TestFulfillSecretRequestShouldExpireSecret(t *testing.T) {
+	ctxt := context.Background()
+	s, dbf := newRacingRequestService(t, ctxt, nil)
+
+	request, _, err := s.CreateSecretRequest(ctxt, "vpn credentials", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now().UTC()
+	if err = s.FulfillSecretRequest(ctxt, request.Link, uuid.New().String()); err != nil {
+		t.Fatal(err)
+	}
+
+	db, dbClose, err := dbf.InitDB(ctxt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbClose()
+
+	fulfilled := &model.SecretRequest{}
+	if err = db.Where("id = ?", request.Id).First(fulfilled).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	stored := &model.Password{}
+	if err = db.Where(&model.Password{Link: fulfilled.PasswordLink}).First(stored).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// request.defaultttl is an hour
+	if stored.ExpiresAt == nil || stored.ExpiresAt.Before(before.Add(time.Hour)) || stored.ExpiresAt.After(time.Now().UTC().Add(time.Hour)) {
+		t.Errorf("expected the secret to expire in an hour but was %v", stored.ExpiresAt)
+	}
+}
+
+func TestFulfillSecretRequestShouldDiscardSecretOfLosingSubmission(t *testing.T) {
+	ctxt := context.Background()
+
+	var request *model.SecretRequest
+	var dbf database.DbFactory
+	s, dbf := newRacingRequestService(t, ctxt, func() {
+		// another submission fulfils the request in between
+		db, dbClose, err := dbf.InitDB(ctxt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dbClose()
+
+		if err = db.Model(&model.SecretRequest{}).Where("id = ?", request.Id).Update("password_link", "winner").Error; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	request, _, err := s.CreateSecretRequest(ctxt, "vpn credentials", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.FulfillSecretRequest(ctxt, request.Link, uuid.New().String())
+	if code := pserror.AsPasswordSharingError(err).Code; code != pserror.SecretRequestFulfilled {
+		t.Errorf("expected code %d but was %d", pserror.SecretRequestFulfilled, code)
+	}
+
+	db, dbClose, err := dbf.InitDB(ctxt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbClose()
+
+	var secrets int64
+	if err = db.Model(&model.Password{}).Count(&secrets).Error; err != nil || secrets != 0 {
+		t.Errorf("expected the secret of the losing submission to be discarded but %d remain", secrets)
+	}
+}
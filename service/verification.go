@@ -0,0 +1,352 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/database"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+	"github.com/misikdmitriy/password-sharing/helper"
+	"github.com/misikdmitriy/password-sharing/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const MaxRecipients = 20
+
+const (
+	oneTimeCodeDigits     = 6
+	oneTimeCodeSpace      = 1000000
+	defaultOneTimeCodeTtl = 10 * time.Minute
+	defaultMaxAttempts    = 5
+	defaultResendInterval = time.Minute
+	oneTimeCodeSubject    = "Your one-time code"
+	oneTimeCodeBody       = "Your one-time code to open the shared secret is %s. It expires in %s."
+)
+
+const (
+	newVerification  = "new_verification"
+	getVerification  = "get_verification"
+	failVerification = "fail_verification"
+	useVerification  = "use_verification"
+
+	verificationSent          = "sent"
+	verificationSuppressed    = "suppressed"
+	verificationSucceeded     = "succeeded"
+	verificationFailed        = "failed"
+	verificationAttemptsLimit = "attempts_limit"
+)
+
+var verificationCounter *prometheus.CounterVec = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "password_sharing_verifications",
+	Help: "The total number of recipient verification steps by outcome",
+}, []string{"outcome"})
+
+// normalizeRecipients validates recipient addresses and returns them
+// lowercased and without duplicates.
+func normalizeRecipients(appLogger *zap.Logger, recipients []string) ([]string, error) {
+	if len(recipients) > MaxRecipients {
+		return nil, invalidRecipientError(appLogger, fmt.Sprintf("at most %d recipients are allowed", MaxRecipients))
+	}
+
+	result := make([]string, 0, len(recipients))
+	seen := map[string]bool{}
+	for _, r := range recipients {
+		address, err := mail.ParseAddress(r)
+		if err != nil || address.Name != "" {
+			return nil, invalidRecipientError(appLogger, "invalid recipient address")
+		}
+
+		email := strings.ToLower(address.Address)
+		if !seen[email] {
+			seen[email] = true
+			result = append(result, email)
+		}
+	}
+
+	return result, nil
+}
+
+// verifyRecipient is the one-time code state machine of recipient restricted
+// passwords. Without an email the caller is asked to identify, with an email
+// but no code a code is sent, and with both the code is checked and consumed.
+// It returns nil only once the caller proved to own a recipient address.
+func (s *passwordService) verifyRecipient(c context.Context, db *gorm.DB, appLogger *zap.Logger, password *model.Password, options RevealOptions) error {
+	email := strings.ToLower(strings.TrimSpace(options.Email))
+	if email == "" {
+		return verificationRequiredError(appLogger, "recipient email is required")
+	}
+
+	recipient := false
+	for _, r := range password.RecipientList() {
+		if r == email {
+			recipient = true
+		}
+	}
+
+	if options.Code == "" {
+		// unknown addresses get the same answer, so recipients cannot be
+		// probed, but nothing is sent to them
+		if !recipient {
+			verificationCounter.WithLabelValues(verificationSuppressed).Inc()
+			return verificationRequiredError(appLogger, "one-time code sent")
+		}
+
+		if err := s.sendCode(c, db, appLogger, password, email); err != nil {
+			return err
+		}
+
+		return verificationRequiredError(appLogger, "one-time code sent")
+	}
+
+	verification := &model.Verification{}
+	var query *gorm.DB
+	measureTime(func() {
+		query = db.Where(&model.Verification{PasswordId: password.Id, Email: email}).First(verification)
+	}, dbTime.WithLabelValues(getVerification))
+	dbCounter.WithLabelValues(getVerification).Inc()
+
+	if err := query.Error; err != nil {
+		if err.Error() == recordNotFoundError {
+			verificationCounter.WithLabelValues(verificationFailed).Inc()
+			return invalidOneTimeCodeError(appLogger)
+		}
+
+		return dbQueryError(appLogger, err)
+	}
+
+	if verification.Attempts >= s.maxAttempts() {
+		const message = "too many attempts"
+
+		verificationCounter.WithLabelValues(verificationAttemptsLimit).Inc()
+		appLogger.Warn(message,
+			zap.String("link", password.Link),
+		)
+
+		return &pserror.PasswordSharingError{
+			Code:    pserror.TooManyAttempts,
+			Message: message,
+		}
+	}
+
+	if verification.Expired(time.Now()) {
+		const message = "one-time code expired"
+
+		appLogger.Debug(message,
+			zap.String("link", password.Link),
+		)
+
+		return &pserror.PasswordSharingError{
+			Code:    pserror.OneTimeCodeExpired,
+			Message: message,
+		}
+	}
+
+	if !helper.HashEquals(password.Link+options.Code, verification.CodeHash) {
+		var command *gorm.DB
+		measureTime(func() {
+			command = db.Model(&model.Verification{}).
+				Where("id = ?", verification.Id).
+				Update("attempts", gorm.Expr("attempts + 1"))
+		}, dbTime.WithLabelValues(failVerification))
+		dbCounter.WithLabelValues(failVerification).Inc()
+
+		if err := command.Error; err != nil {
+			return dbCommandError(appLogger, err)
+		}
+
+		verificationCounter.WithLabelValues(verificationFailed).Inc()
+		return invalidOneTimeCodeError(appLogger)
+	}
+
+	// deleting the verification consumes the code, a concurrent request
+	// with the same code sees zero affected rows
+	var command *gorm.DB
+	measureTime(func() {
+		command = db.Where("id = ? AND attempts < ?", verification.Id, s.maxAttempts()).Delete(&model.Verification{})
+	}, dbTime.WithLabelValues(useVerification))
+	dbCounter.WithLabelValues(useVerification).Inc()
+
+	if err := command.Error; err != nil {
+		return dbCommandError(appLogger, err)
+	}
+
+	if command.RowsAffected == 0 {
+		verificationCounter.WithLabelValues(verificationFailed).Inc()
+		return invalidOneTimeCodeError(appLogger)
+	}
+
+	verificationCounter.WithLabelValues(verificationSucceeded).Inc()
+	return nil
+}
+
+// sendCode replaces the pending code of a recipient with a fresh one. Codes
+// are resent at most once per resend interval. The attempt counter belongs to
+// the recipient of the password and survives resends, so a recipient who used
+// up the attempts is locked out of the link.
+func (s *passwordService) sendCode(c context.Context, db *gorm.DB, appLogger *zap.Logger, password *model.Password, email string) error {
+	now := time.Now().UTC()
+
+	existing := &model.Verification{}
+	var query *gorm.DB
+	measureTime(func() {
+		query = db.Where(&model.Verification{PasswordId: password.Id, Email: email}).Limit(1).Find(existing)
+	}, dbTime.WithLabelValues(getVerification))
+	dbCounter.WithLabelValues(getVerification).Inc()
+
+	if err := query.Error; err != nil {
+		return dbQueryError(appLogger, err)
+	}
+
+	if query.RowsAffected > 0 && existing.Attempts >= s.maxAttempts() {
+		const message = "too many attempts"
+
+		verificationCounter.WithLabelValues(verificationAttemptsLimit).Inc()
+		appLogger.Warn(message,
+			zap.String("link", password.Link),
+		)
+
+		return &pserror.PasswordSharingError{
+			Code:    pserror.TooManyAttempts,
+			Message: message,
+		}
+	}
+
+	if query.RowsAffected > 0 && now.Sub(existing.SentAt) < s.resendInterval() {
+		verificationCounter.WithLabelValues(verificationSuppressed).Inc()
+		appLogger.Debug("one-time code was sent recently",
+			zap.String("link", password.Link),
+		)
+
+		return nil
+	}
+
+	n, err := s.randomFactory.NewRandomGenerator().RandomInt(oneTimeCodeSpace)
+	if err != nil {
+		return randomizerError(appLogger, err, oneTimeCodeDigits)
+	}
+	code := fmt.Sprintf("%0*d", oneTimeCodeDigits, n)
+
+	ttl := s.configuration.Otp.Ttl
+	if ttl <= 0 {
+		ttl = defaultOneTimeCodeTtl
+	}
+
+	measureTime(func() {
+		if query.RowsAffected == 0 {
+			err = db.Create(&model.Verification{
+				PasswordId: password.Id,
+				Email:      email,
+				CodeHash:   helper.Hash(password.Link + code),
+				SentAt:     now,
+				ExpiresAt:  now.Add(ttl),
+			}).Error
+			return
+		}
+
+		err = db.Model(&model.Verification{}).
+			Where("id = ?", existing.Id).
+			Updates(map[string]interface{}{
+				"code_hash":  helper.Hash(password.Link + code),
+				"sent_at":    now,
+				"expires_at": now.Add(ttl),
+			}).Error
+	}, dbTime.WithLabelValues(newVerification))
+	dbCounter.WithLabelValues(newVerification).Inc()
+
+	if err != nil && database.IsUniqueViolation(err) {
+		// a concurrent request created the row and sends the code
+		verificationCounter.WithLabelValues(verificationSuppressed).Inc()
+		appLogger.Debug("one-time code is being sent",
+			zap.String("link", password.Link),
+		)
+
+		return nil
+	}
+
+	if err != nil {
+		return dbCommandError(appLogger, err)
+	}
+
+	if err := s.notifier.Notify(c, email, oneTimeCodeSubject, fmt.Sprintf(oneTimeCodeBody, code, ttl)); err != nil {
+		const message = "failed to send one-time code"
+
+		appLogger.Error(message,
+			zap.Error(err),
+		)
+
+		return &pserror.PasswordSharingError{
+			Code:    pserror.NotificationError,
+			Message: message,
+			Cause:   err,
+		}
+	}
+
+	verificationCounter.WithLabelValues(verificationSent).Inc()
+	return nil
+}
+
+func (s *passwordService) maxAttempts() int {
+	if s.configuration.Otp.MaxAttempts > 0 {
+		return s.configuration.Otp.MaxAttempts
+	}
+
+	return defaultMaxAttempts
+}
+
+func (s *passwordService) resendInterval() time.Duration {
+	if s.configuration.Otp.ResendInterval > 0 {
+		return s.configuration.Otp.ResendInterval
+	}
+
+	return defaultResendInterval
+}
+
+func verificationRequiredError(log *zap.Logger, message string) error {
+	log.Debug(message)
+
+	return &pserror.PasswordSharingError{
+		Code:    pserror.VerificationRequired,
+		Message: message,
+	}
+}
+
+func invalidOneTimeCodeError(log *zap.Logger) error {
+	const message = "invalid one-time code"
+
+	log.Warn(message)
+
+	return &pserror.PasswordSharingError{
+		Code:    pserror.InvalidOneTimeCode,
+		Message: message,
+	}
+}
+
+func invalidRecipientError(log *zap.Logger, message string) error {
+	log.Warn(message)
+
+	return &pserror.PasswordSharingError{
+		Code:    pserror.InvalidRecipient,
+		Message: message,
+	}
+}
+
+func dbQueryError(log *zap.Logger, err error) error {
+	const message = "error on db query"
+
+	dbErrorsCounter.WithLabelValues(unknownError).Inc()
+	log.Error(message,
+		zap.Error(err),
+	)
+
+	return &pserror.PasswordSharingError{
+		Code:    pserror.DbQueryError,
+		Message: message,
+		Cause:   err,
+	}
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	pserror "github.com/misikdmitriy/password-sharing/error"
+)
+
+type sentMessage struct {
+	to   string
+	body string
+}
+
+type recordingNotifier struct {
+	sent []sentMessage
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, to string, _ string, body string) error {
+	n.sent = append(n.sent, sentMessage{to: to, body: body})
+	return nil
+}
+
+var codePattern = regexp.MustCompile(`\b\d{6}\b`)
+
+func (n *recordingNotifier) lastCode(t *testing.T) string {
+	if len(n.sent) == 0 {
+		t.Fatal("expected a one-time code to be sent")
+	}
+
+	return codePattern.FindString(n.sent[len(n.sent)-1].body)
+}
+
+func TestGetPasswordFromLinkShouldRequireRecipientCode(t *testing.T) {
+	c := &config.Config{}
+	c.Otp.MaxAttempts = 2
+	c.Otp.ResendInterval = time.Hour
+
+	notifier := &recordingNotifier{}
+	s, _, _ := newTenantTestService(t, c, notifier)
+	ctxt := context.Background()
+
+	_, err := s.CreateLinkFromPassword(ctxt, "secret", LinkOptions{Recipients: []string{"not an email"}})
+	if !errors.Is(err, pserror.InvalidRecipient) {
+		t.Errorf("expected invalid recipient but was %v", err)
+	}
+
+	created, err := s.CreateLinkFromPassword(ctxt, "secret", LinkOptions{Recipients: []string{"Alice@Example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reveal := func(email string, code string) (string, error) {
+		return s.GetPasswordFromLink(ctxt, created.Link, RevealOptions{Email: email, Code: code})
+	}
+
+	if _, err = reveal("", ""); !errors.Is(err, pserror.VerificationRequired) {
+		t.Errorf("expected verification required but was %v", err)
+	}
+
+	// strangers get the same answer but no code
+	if _, err = reveal("eve@example.com", ""); !errors.Is(err, pserror.VerificationRequired) || len(notifier.sent) != 0 {
+		t.Errorf("expected no code to be sent to a stranger but was %v", err)
+	}
+
+	if _, err = reveal("alice@example.com", ""); !errors.Is(err, pserror.VerificationRequired) {
+		t.Errorf("expected verification required but was %v", err)
+	}
+
+	if len(notifier.sent) != 1 || notifier.sent[0].to != "alice@example.com" {
+		t.Fatalf("expected a code to be sent to alice but was %+v", notifier.sent)
+	}
+	code := notifier.lastCode(t)
+
+	// a second request within the resend interval does not send a new code
+	if _, err = reveal("alice@example.com", ""); !errors.Is(err, pserror.VerificationRequired) || len(notifier.sent) != 1 {
+		t.Errorf("expected resend to be throttled")
+	}
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	if _, err = reveal("eve@example.com", code); !errors.Is(err, pserror.InvalidOneTimeCode) {
+		t.Errorf("expected code of alice not to work for eve but was %v", err)
+	}
+
+	if _, err = reveal("alice@example.com", wrong); !errors.Is(err, pserror.InvalidOneTimeCode) {
+		t.Errorf("expected invalid code but was %v", err)
+	}
+
+	password, err := reveal("ALICE@example.com", code)
+	if err != nil || password != "secret" {
+		t.Fatalf("expected password to be revealed but was %v", err)
+	}
+
+	// codes are single use
+	if _, err = reveal("alice@example.com", code); !errors.Is(err, pserror.InvalidOneTimeCode) {
+		t.Errorf("expected used code to be rejected but was %v", err)
+	}
+}
+
+func TestGetPasswordFromLinkShouldLimitCodeAttempts(t *testing.T) {
+	c := &config.Config{}
+	c.Otp.MaxAttempts = 2
+	c.Otp.ResendInterval = time.Nanosecond
+
+	notifier := &recordingNotifier{}
+	s, _, _ := newTenantTestService(t, c, notifier)
+	ctxt := context.Background()
+
+	created, err := s.CreateLinkFromPassword(ctxt, "secret", LinkOptions{Recipients: []string{"alice@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reveal := func(code string) error {
+		_, err := s.GetPasswordFromLink(ctxt, created.Link, RevealOptions{Email: "alice@example.com", Code: code})
+		return err
+	}
+
+	if err = reveal(""); !errors.Is(err, pserror.VerificationRequired) {
+		t.Fatalf("expected verification required but was %v", err)
+	}
+
+	wrongCode := func() string {
+		if notifier.lastCode(t) == "000000" {
+			return "111111"
+		}
+
+		return "000000"
+	}
+
+	if err = reveal(wrongCode()); !errors.Is(err, pserror.InvalidOneTimeCode) {
+		t.Errorf("expected invalid code but was %v", err)
+	}
+
+	// a new code does not bring the attempts back
+	if err = reveal(""); !errors.Is(err, pserror.VerificationRequired) || len(notifier.sent) != 2 {
+		t.Fatalf("expected a new code to be sent but was %v", err)
+	}
+
+	if err = reveal(wrongCode()); !errors.Is(err, pserror.InvalidOneTimeCode) {
+		t.Errorf("expected invalid code but was %v", err)
+	}
+
+	if err = reveal(notifier.lastCode(t)); !errors.Is(err, pserror.TooManyAttempts) {
+		t.Errorf("expected too many attempts even for the right code but was %v", err)
+	}
+
+	sent := len(notifier.sent)
+	if err = reveal(""); !errors.Is(err, pserror.TooManyAttempts) || len(notifier.sent) != sent {
+		t.Errorf("expected no code to be sent after too many attempts but was %v", err)
+	}
+}
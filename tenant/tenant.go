@@ -0,0 +1,208 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/helper"
+)
+
+// DefaultId is used when no tenants are configured.
+const DefaultId = "default"
+
+// Policy limits the secrets of a tenant. Zero values mean no limit.
+type Policy struct {
+	MaxTtl            time.Duration
+	MaxViews          int
+	MaxSize           int
+	RequirePassphrase bool
+	// AllowedNetworks restricts retrieval to client addresses in these
+	// networks, empty allows every address.
+	AllowedNetworks []*net.IPNet
+}
+
+type Tenant struct {
+	Id              string
+	Name            string
+	Hosts           []string
+	BasePath        string
+	RequestBasePath string
+	Policy          Policy
+}
+
+type Registry interface {
+	Get(string) (*Tenant, bool)
+	ByHost(string) (*Tenant, bool)
+	Default() *Tenant
+	All() []*Tenant
+}
+
+type registry struct {
+	tenants  []*Tenant
+	byId     map[string]*Tenant
+	byHost   map[string]*Tenant
+	fallback *Tenant
+}
+
+// NewRegistry builds the tenants from configuration. Without configured
+// tenants everything belongs to a single default tenant.
+func NewRegistry(conf *config.Config) (Registry, error) {
+	r := &registry{
+		byId:   map[string]*Tenant{},
+		byHost: map[string]*Tenant{},
+	}
+
+	configured := conf.Tenancy.Tenants
+	if len(configured) == 0 {
+		configured = []config.Tenant{{Id: DefaultId}}
+	}
+
+	for _, c := range configured {
+		if c.Id == "" {
+			return nil, fmt.Errorf("tenant id is required")
+		}
+
+		if _, ok := r.byId[c.Id]; ok {
+			return nil, fmt.Errorf("duplicate tenant %s", c.Id)
+		}
+
+		networks, err := helper.ParseCidrs(c.AllowedCidrs)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", c.Id, err)
+		}
+
+		t := &Tenant{
+			Id:              c.Id,
+			Name:            c.Name,
+			Hosts:           c.Hosts,
+			BasePath:        c.BasePath,
+			RequestBasePath: c.RequestBasePath,
+			Policy: Policy{
+				MaxTtl:            c.MaxTtl,
+				MaxViews:          c.MaxViews,
+				MaxSize:           c.MaxSize,
+				RequirePassphrase: c.RequirePassphrase,
+				AllowedNetworks:   networks,
+			},
+		}
+
+		if t.BasePath == "" {
+			t.BasePath = conf.App.BasePath
+		}
+		if t.RequestBasePath == "" {
+			t.RequestBasePath = conf.Request.BasePath
+		}
+
+		for _, host := range c.Hosts {
+			host = strings.ToLower(host)
+			if other, ok := r.byHost[host]; ok {
+				return nil, fmt.Errorf("host %s is used by tenants %s and %s", host, other.Id, t.Id)
+			}
+
+			r.byHost[host] = t
+		}
+
+		r.byId[t.Id] = t
+		r.tenants = append(r.tenants, t)
+	}
+
+	defaultId := conf.Tenancy.DefaultTenant
+	if defaultId == "" {
+		defaultId = r.tenants[0].Id
+	}
+
+	fallback, ok := r.byId[defaultId]
+	if !ok {
+		return nil, fmt.Errorf("default tenant %s is not configured", defaultId)
+	}
+	r.fallback = fallback
+
+	return r, nil
+}
+
+// reloadingRegistry rebuilds the tenants from every applied configuration,
+// so their policies follow reloads. Requests keep the tenant they resolved.
+type reloadingRegistry struct {
+	current atomic.Pointer[registry]
+}
+
+// NewReloadingRegistry is NewRegistry over a configuration source. Only the
+// policies of tenants are reloadable, a configuration that fails to build
+// keeps the previous tenants.
+func NewReloadingRegistry(conf config.Source) (Registry, error) {
+	initial, err := NewRegistry(conf.Current())
+	if err != nil {
+		return nil, err
+	}
+
+	r := &reloadingRegistry{}
+	r.current.Store(initial.(*registry))
+
+	conf.Subscribe(func(c *config.Config) {
+		if next, err := NewRegistry(c); err == nil {
+			r.current.Store(next.(*registry))
+		}
+	})
+
+	return r, nil
+}
+
+func (r *reloadingRegistry) Get(id string) (*Tenant, bool) {
+	return r.current.Load().Get(id)
+}
+
+func (r *reloadingRegistry) ByHost(host string) (*Tenant, bool) {
+	return r.current.Load().ByHost(host)
+}
+
+func (r *reloadingRegistry) Default() *Tenant {
+	return r.current.Load().Default()
+}
+
+func (r *reloadingRegistry) All() []*Tenant {
+	return r.current.Load().All()
+}
+
+func (r *registry) Get(id string) (*Tenant, bool) {
+	t, ok := r.byId[id]
+	return t, ok
+}
+
+// ByHost finds the tenant of a Host header value, the port is ignored.
+func (r *registry) ByHost(host string) (*Tenant, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	t, ok := r.byHost[strings.ToLower(host)]
+	return t, ok
+}
+
+func (r *registry) Default() *Tenant {
+	return r.fallback
+}
+
+func (r *registry) All() []*Tenant {
+	result := make([]*Tenant, len(r.tenants))
+	copy(result, r.tenants)
+
+	return result
+}
+
+type tenantKey struct{}
+
+func WithTenant(c context.Context, t *Tenant) context.Context {
+	return context.WithValue(c, tenantKey{}, t)
+}
+
+// From returns the tenant resolved for the request or nil outside of
+// requests.
+func From(c context.Context) *Tenant {
+	t, _ := c.Value(tenantKey{}).(*Tenant)
+	return t
+}
@@ -0,0 +1,113 @@
+package tenant
+
+import (
+	"testing"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/config"
+)
+
+func TestRegistryShouldResolveTenants(t *testing.T) {
+	c := &config.Config{}
+	c.App.BasePath = "http://localhost/api/v1/pwd"
+	c.Tenancy.DefaultTenant = "shared"
+	c.Tenancy.Tenants = []config.Tenant{
+		{Id: "shared"},
+		{Id: "finance", Hosts: []string{"Finance.example.com"}, BasePath: "https://finance.example.com/api/v1/pwd"},
+	}
+
+	r, err := NewRegistry(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Default().Id != "shared" || r.Default().BasePath != c.App.BasePath {
+		t.Errorf("unexpected default tenant %+v", r.Default())
+	}
+
+	cases := []struct {
+		host   string
+		tenant string
+	}{
+		{"finance.example.com", "finance"},
+		{"finance.example.com:8080", "finance"},
+		{"FINANCE.example.com", "finance"},
+		{"other.example.com", ""},
+	}
+
+	for _, tc := range cases {
+		resolved, ok := r.ByHost(tc.host)
+		if tc.tenant == "" && ok {
+			t.Errorf("expected host %s not to be resolved", tc.host)
+		}
+
+		if tc.tenant != "" && (!ok || resolved.Id != tc.tenant) {
+			t.Errorf("expected host %s to resolve to %s", tc.host, tc.tenant)
+		}
+	}
+}
+
+func TestRegistryShouldRejectInvalidTenants(t *testing.T) {
+	cases := []struct {
+		name          string
+		defaultTenant string
+		tenants       []config.Tenant
+	}{
+		{"missing id", "", []config.Tenant{{}}},
+		{"duplicate id", "", []config.Tenant{{Id: "a"}, {Id: "a"}}},
+		{"duplicate host", "", []config.Tenant{{Id: "a", Hosts: []string{"x"}}, {Id: "b", Hosts: []string{"X"}}}},
+		{"unknown default", "c", []config.Tenant{{Id: "a"}}},
+		{"invalid allowlist", "", []config.Tenant{{Id: "a", AllowedCidrs: []string{"10.0.0.0/33"}}}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &config.Config{}
+			c.Tenancy.DefaultTenant = tc.defaultTenant
+			c.Tenancy.Tenants = tc.tenants
+
+			if _, err := NewRegistry(c); err == nil {
+				t.Errorf("expected configuration to be rejected")
+			}
+		})
+	}
+}
+
+func TestRegistryShouldFallBackToDefaultTenant(t *testing.T) {
+	r, err := NewRegistry(&config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Default().Id != DefaultId || len(r.All()) != 1 {
+		t.Errorf("expected a single default tenant")
+	}
+}
+
+func TestReloadingRegistryShouldFollowPolicyChanges(t *testing.T) {
+	c := &config.Config{}
+	c.Tenancy.Tenants = []config.Tenant{{Id: "finance", Hosts: []string{"finance.example.com"}, MaxViews: 5}}
+
+	store := config.NewStore(c)
+	r, err := NewReloadingRegistry(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := *c
+	next.Tenancy.Tenants = []config.Tenant{{Id: "finance", Hosts: []string{"finance.example.com"}, MaxViews: 1, MaxTtl: time.Hour}}
+	if _, err = store.Apply(&next); err != nil {
+		t.Fatal(err)
+	}
+
+	finance, ok := r.ByHost("finance.example.com")
+	if !ok || finance.Policy.MaxViews != 1 || finance.Policy.MaxTtl != time.Hour {
+		t.Errorf("expected the reloaded policy but was %+v", finance)
+	}
+
+	moved := next
+	moved.Tenancy.Tenants = []config.Tenant{{Id: "finance", Hosts: []string{"other.example.com"}, MaxViews: 1, MaxTtl: time.Hour}}
+	if _, err = store.Apply(&moved); err == nil {
+		t.Errorf("expected a change of the hosts to need a restart")
+	}
+}
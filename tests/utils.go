@@ -4,7 +4,6 @@ import (
 	"context"
 
 	"github.com/misikdmitriy/password-sharing/database"
-	"github.com/misikdmitriy/password-sharing/model"
 )
 
 func MigrateDatabase(c context.Context, f database.DbFactory) error {
@@ -14,12 +13,12 @@ func MigrateDatabase(c context.Context, f database.DbFactory) error {
 	}
 	defer close()
 
-	err = db.Migrator().DropTable(&model.Password{})
+	err = db.Migrator().DropTable(database.Models()...)
 	if err != nil {
 		return err
 	}
 
-	err = db.AutoMigrate(&model.Password{})
+	err = db.AutoMigrate(database.Models()...)
 	if err != nil {
 		return err
 	}
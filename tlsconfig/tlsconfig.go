@@ -0,0 +1,257 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"go.uber.org/zap"
+)
+
+const defaultReloadInterval = 30 * time.Second
+
+var versions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// NewConfig returns the server configuration of tls, or nil when TLS is
+// disabled. The certificate and the client CAs are read again once their
+// files change, connections opened before keep their certificate.
+func NewConfig(conf *config.Config, loggerFactory logger.LoggerFactory) (*tls.Config, error) {
+	if !conf.Tls.Enabled {
+		return nil, nil
+	}
+
+	if conf.Tls.CertFile == "" || conf.Tls.KeyFile == "" {
+		return nil, errors.New("tls.certfile and tls.keyfile are required")
+	}
+
+	minVersion := uint16(tls.VersionTLS12)
+	if conf.Tls.MinVersion != "" {
+		version, ok := versions[conf.Tls.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported tls version %s", conf.Tls.MinVersion)
+		}
+
+		minVersion = version
+	}
+
+	cipherSuites, err := cipherSuitesOf(conf.Tls.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := conf.Tls.ReloadInterval
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+
+	r := &reloader{
+		certFile:      conf.Tls.CertFile,
+		keyFile:       conf.Tls.KeyFile,
+		caFile:        conf.Tls.ClientCaFile,
+		interval:      interval,
+		loggerFactory: loggerFactory,
+		now:           time.Now,
+	}
+	if err = r.load(); err != nil {
+		return nil, err
+	}
+
+	base := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: r.certificate,
+	}
+
+	if r.caFile == "" {
+		return base, nil
+	}
+
+	// the client CAs can only change per connection through a config of
+	// its own
+	server := base.Clone()
+	server.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		client := base.Clone()
+		// certificates are optional here, the routes that need one check
+		// for it
+		client.ClientAuth = tls.VerifyClientCertIfGiven
+		client.ClientCAs = r.clientCas()
+
+		return client, nil
+	}
+
+	return server, nil
+}
+
+func cipherSuitesOf(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	result := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %s", name)
+		}
+
+		result = append(result, id)
+	}
+
+	return result, nil
+}
+
+// stamp tells whether a file changed since it was read.
+type stamp struct {
+	modified time.Time
+	size     int64
+}
+
+type reloader struct {
+	certFile      string
+	keyFile       string
+	caFile        string
+	interval      time.Duration
+	loggerFactory logger.LoggerFactory
+	now           func() time.Time
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	cas     *x509.CertPool
+	stamps  map[string]stamp
+	checked time.Time
+}
+
+func (r *reloader) certificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reload()
+	return r.cert, nil
+}
+
+func (r *reloader) clientCas() *x509.CertPool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reload()
+	return r.cas
+}
+
+// reload reads the files again when they changed, at most once per
+// interval. A broken file is logged and the previous certificate stays in
+// use until it is fixed.
+func (r *reloader) reload() {
+	now := r.now()
+	if now.Sub(r.checked) < r.interval {
+		return
+	}
+	r.checked = now
+
+	stamps, err := r.stat()
+	if err == nil && equal(stamps, r.stamps) {
+		return
+	}
+
+	if err == nil {
+		err = r.load()
+	}
+
+	appLogger, loggerClose, loggerErr := r.loggerFactory.NewLogger()
+	if loggerErr != nil {
+		return
+	}
+	defer loggerClose()
+
+	if err != nil {
+		appLogger.Error("failed to reload tls certificate, keeping the previous one",
+			zap.Error(err),
+			zap.String("certFile", r.certFile),
+		)
+		return
+	}
+
+	appLogger.Info("reloaded tls certificate",
+		zap.String("certFile", r.certFile),
+		zap.Time("notAfter", r.cert.Leaf.NotAfter),
+	)
+}
+
+// load reads every file, it changes nothing unless all of them are valid.
+func (r *reloader) load() error {
+	stamps, err := r.stat()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return err
+	}
+
+	var cas *x509.CertPool
+	if r.caFile != "" {
+		content, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+
+		cas = x509.NewCertPool()
+		if !cas.AppendCertsFromPEM(content) {
+			return fmt.Errorf("no certificates in %s", r.caFile)
+		}
+	}
+
+	r.cert, r.cas, r.stamps = &cert, cas, stamps
+	return nil
+}
+
+func (r *reloader) stat() (map[string]stamp, error) {
+	stamps := make(map[string]stamp)
+	for _, file := range []string{r.certFile, r.keyFile, r.caFile} {
+		if file == "" {
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+
+		stamps[file] = stamp{modified: info.ModTime(), size: info.Size()}
+	}
+
+	return stamps, nil
+}
+
+func equal(a map[string]stamp, b map[string]stamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for file, s := range a {
+		if other, ok := b[file]; !ok || !other.modified.Equal(s.modified) || other.size != s.size {
+			return false
+		}
+	}
+
+	return true
+}
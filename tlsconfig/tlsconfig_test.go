@@ -0,0 +1,119 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/misikdmitriy/password-sharing/config"
+	"github.com/misikdmitriy/password-sharing/logger"
+	"github.com/misikdmitriy/password-sharing/tests"
+)
+
+func newTestConfig(t *testing.T) (*config.Config, *tests.Certificate) {
+	dir := t.TempDir()
+
+	ca, err := tests.WriteCertificate(dir, "ca", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := tests.WriteCertificate(dir, "server", ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &config.Config{}
+	c.Tls.Enabled = true
+	c.Tls.CertFile = server.CertFile
+	c.Tls.KeyFile = server.KeyFile
+	c.Tls.ClientCaFile = ca.CertFile
+	// every handshake looks for changes
+	c.Tls.ReloadInterval = time.Nanosecond
+
+	return c, ca
+}
+
+func TestCertificateShouldReloadWhenFilesChange(t *testing.T) {
+	c, ca := newTestConfig(t)
+
+	tlsConfig, err := NewConfig(c, logger.NewTestLoggerFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renewed, err := tests.WriteCertificate(filepath.Dir(c.Tls.CertFile), "server", ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.Leaf.SerialNumber.Cmp(renewed.Certificate.SerialNumber) != 0 || second.Leaf.SerialNumber.Cmp(first.Leaf.SerialNumber) == 0 {
+		t.Fatalf("expected the renewed certificate %v but was %v", renewed.Certificate.SerialNumber, second.Leaf.SerialNumber)
+	}
+
+	// a half written renewal keeps the working certificate
+	if err = os.WriteFile(c.Tls.CertFile, []byte("-----BEGIN CERTIFICATE-----"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	third, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil || third != second {
+		t.Errorf("expected the previous certificate to stay but was %v, %v", third, err)
+	}
+}
+
+func TestClientCertificatesShouldBeVerifiedIfGiven(t *testing.T) {
+	c, _ := newTestConfig(t)
+
+	tlsConfig, err := NewConfig(c, logger.NewTestLoggerFactory())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := tlsConfig.GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.ClientAuth != tls.VerifyClientCertIfGiven || client.ClientCAs == nil {
+		t.Errorf("expected optional client certificates but was %v", client.ClientAuth)
+	}
+
+	if client.GetCertificate == nil || client.MinVersion != tls.VersionTLS12 {
+		t.Errorf("expected the client config to keep the server settings")
+	}
+}
+
+func TestConfigShouldRejectUnknownSettings(t *testing.T) {
+	cases := []struct {
+		name      string
+		configure func(c *config.Config)
+	}{
+		{"version", func(c *config.Config) { c.Tls.MinVersion = "1.0" }},
+		{"cipher suite", func(c *config.Config) { c.Tls.CipherSuites = []string{"TLS_RSA_WITH_RC4_128_SHA"} }},
+		{"missing key", func(c *config.Config) { c.Tls.KeyFile = "" }},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := newTestConfig(t)
+			tc.configure(c)
+
+			if _, err := NewConfig(c, logger.NewTestLoggerFactory()); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}